@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/audit"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// What ends up in the audit log, the first part before the dot is what
+// the action filter matches on, e.g. ?action=auth
+const (
+	auditLoginSuccess    = "auth.login.success"
+	auditLoginFailure    = "auth.login.failure"
+	auditRefresh         = "auth.refresh.success"
+	auditRefreshFailure  = "auth.refresh.failure"
+	auditRevoke          = "auth.revoke"
+	auditEmailChanged    = "user.email_changed"
+	auditPasswordChanged = "user.password_changed"
+	auditChirpDeleted    = "chirp.deleted"
+	auditChirpyRed       = "billing.chirpy_red"
+	auditAdminRequest    = "admin.request"
+	auditAdminDenied     = "admin.denied"
+	auditRoleChanged     = "admin.role_changed"
+	auditStateChanged    = "admin.user_state_changed"
+	auditRuleCreated     = "admin.moderation_rule_created"
+	auditRuleDeleted     = "admin.moderation_rule_deleted"
+	auditLockoutCleared  = "admin.lockout_cleared"
+	auditReset           = "admin.reset"
+)
+
+type requestIDKey struct{}
+
+// Gives every request an ID, using the X-Request-ID a proxy in front of
+// us sent if it looks sensible, and sends it back so it can be quoted
+func middlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// Adds an event to the audit log with the request's address and ID.
+// Failing to record isn't a reason to fail the request, so it's only logged.
+// It's still recorded if the client hangs up, what they did already happened
+func (cfg *ApiConfig) recordAudit(r *http.Request, e audit.Event) {
+	if cfg.audit == nil {
+		return
+	}
+
+	e.IP = clientIP(r)
+	e.RequestID = requestID(r)
+	_, err := cfg.audit.Record(context.WithoutCancel(r.Context()), e)
+	if err != nil {
+		log.Printf("Error recording %s audit event: %s", e.Action, err)
+	}
+}
+
+func actor(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: id != uuid.Nil}
+}
+
+// Remembers the status code so it can go in the audit log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Runs an admin handler and records who did what and how it went
+func (cfg *ApiConfig) auditAdminRequest(w http.ResponseWriter, r *http.Request, userID uuid.UUID, next http.HandlerFunc) {
+	rec := &statusRecorder{ResponseWriter: w}
+	next(rec, r)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditAdminRequest,
+		ActorID:    actor(userID),
+		TargetType: "route",
+		TargetID:   r.Pattern,
+		Metadata: map[string]any{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"query":  r.URL.RawQuery,
+			"status": rec.status,
+		},
+	})
+}
+
+// Records a staff route turning someone away with a 403, userID is uuid.Nil
+// when the token was never looked up and role is blank when it isn't known
+func (cfg *ApiConfig) auditAdminDenied(r *http.Request, userID uuid.UUID, reason, role, required string) {
+	metadata := map[string]any{
+		"method":        r.Method,
+		"path":          r.URL.Path,
+		"reason":        reason,
+		"required_role": required,
+	}
+	if role != "" {
+		metadata["role"] = role
+	}
+
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditAdminDenied,
+		ActorID:    actor(userID),
+		TargetType: "route",
+		TargetID:   r.Pattern,
+		Metadata:   metadata,
+	})
+}
+
+type auditEventResponse struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Action     string          `json:"action"`
+	ActorID    *uuid.UUID      `json:"actor_id"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	IPAddress  string          `json:"ip_address,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Metadata   json.RawMessage `json:"metadata"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+func newAuditEventResponse(e database.AuditEvent) auditEventResponse {
+	resp := auditEventResponse{
+		ID:         e.ID,
+		CreatedAt:  e.CreatedAt,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IPAddress:  e.IpAddress,
+		RequestID:  e.RequestID,
+		Metadata:   e.Metadata,
+		PrevHash:   e.PrevHash,
+		Hash:       e.Hash,
+	}
+	if e.ActorID.Valid {
+		resp.ActorID = &e.ActorID.UUID
+	}
+	return resp
+}
+
+type auditPage struct {
+	Events     []auditEventResponse `json:"events"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+// Turns the query string into filters for ListAuditEvents
+func parseAuditFilters(r *http.Request) (database.ListAuditEventsParams, int, error) {
+	query := r.URL.Query()
+	params := database.ListAuditEventsParams{}
+
+	limit := defaultPageLimit
+	if s := query.Get("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return params, 0, errors.New("limit must be a positive integer")
+		}
+		limit = min(limit, maxPageLimit)
+	}
+	params.Limit = int32(limit + 1)
+
+	for name, field := range map[string]*sql.NullString{
+		"action":      &params.Action,
+		"target_type": &params.TargetType,
+		"target_id":   &params.TargetID,
+		"ip_address":  &params.IpAddress,
+		"request_id":  &params.RequestID,
+	} {
+		if s := query.Get(name); s != "" {
+			*field = sql.NullString{String: s, Valid: true}
+		}
+	}
+
+	if s := query.Get("actor_id"); s != "" {
+		actorID, err := uuid.Parse(s)
+		if err != nil {
+			return params, 0, errors.New("invalid actor_id")
+		}
+		params.ActorID = uuid.NullUUID{UUID: actorID, Valid: true}
+	}
+
+	for name, field := range map[string]*sql.NullTime{
+		"since": &params.Since,
+		"until": &params.Until,
+	} {
+		if s := query.Get(name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return params, 0, errors.New(name + " must be a time like 2006-01-02T15:04:05Z")
+			}
+			*field = sql.NullTime{Time: t.UTC(), Valid: true}
+		}
+	}
+
+	// Events are numbered in order, so the cursor is just the last ID
+	if s := query.Get("cursor"); s != "" {
+		beforeID, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || beforeID < 1 {
+			return params, 0, errors.New("invalid cursor")
+		}
+		params.BeforeID = sql.NullInt64{Int64: beforeID, Valid: true}
+	}
+
+	return params, limit, nil
+}
+
+// Lists audit events newest first, filtered by action (or a prefix of it
+// like "auth"), actor_id, target_type, target_id, ip_address, request_id,
+// and since/until
+func (cfg *ApiConfig) getAuditEvents(w http.ResponseWriter, r *http.Request) {
+	params, limit, err := parseAuditFilters(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := cfg.DBQueries.ListAuditEvents(r.Context(), params)
+	if err != nil {
+		log.Printf("Error listing audit events: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to list audit events")
+		return
+	}
+
+	resp := auditPage{Events: []auditEventResponse{}}
+	for i, row := range rows {
+		if i == limit {
+			resp.NextCursor = strconv.FormatInt(rows[i-1].ID, 10)
+			break
+		}
+		resp.Events = append(resp.Events, newAuditEventResponse(row))
+	}
+
+	err = respondWithJSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Walks the whole chain and says whether anything has been changed or removed
+func (cfg *ApiConfig) verifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	type verifyResponse struct {
+		Valid    bool   `json:"valid"`
+		Checked  int    `json:"checked"`
+		BrokenAt int64  `json:"broken_at,omitempty"`
+		Reason   string `json:"reason,omitempty"`
+	}
+
+	checked, err := cfg.audit.Verify(r.Context())
+	var chainErr *audit.ChainError
+	if errors.As(err, &chainErr) {
+		log.Printf("SECURITY: audit log chain is broken: %s", chainErr)
+		err = respondWithJSON(w, http.StatusOK, verifyResponse{
+			Checked:  checked,
+			BrokenAt: chainErr.ID,
+			Reason:   chainErr.Reason,
+		})
+		if err != nil {
+			log.Printf("JSON encoding error: %s", err)
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying audit log: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to verify audit log")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, verifyResponse{Valid: true, Checked: checked})
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Tim-Restart/chirpy/internal/audit"
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listTestAuditEvents(t *testing.T, cfg *ApiConfig, action string) []database.AuditEvent {
+	t.Helper()
+	events, err := cfg.DBQueries.ListAuditEvents(context.Background(), database.ListAuditEventsParams{
+		Action: sql.NullString{String: action, Valid: true},
+		Limit:  100,
+	})
+	require.NoError(t, err)
+	return events
+}
+
+func TestRequireRoleAuditsDenials(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.audit = audit.NewRecorder(cfg.db)
+	alice := createTestUser(t, cfg, "alice@example.com")
+
+	handler := cfg.requireRole(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler shouldn't run")
+	})
+	rec := serveTest(handler, "GET", "/admin/users", testToken(t, cfg, alice.ID), "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	events := listTestAuditEvents(t, cfg, auditAdminDenied)
+	require.Len(t, events, 1)
+	assert.Equal(t, alice.ID, events[0].ActorID.UUID)
+	var metadata map[string]any
+	require.NoError(t, json.Unmarshal(events[0].Metadata, &metadata))
+	assert.Equal(t, "role", metadata["reason"])
+	assert.Equal(t, auth.RoleUser, metadata["role"])
+}
+
+func TestUpdateUserOnlyAuditsRealPasswordChanges(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.audit = audit.NewRecorder(cfg.db)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	token := testToken(t, cfg, alice.ID)
+
+	rec := serveTest(cfg.updateUser, "PUT", "/api/users", token, `{"email":"alice@example.com","password":"correct horse battery"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, listTestAuditEvents(t, cfg, auditPasswordChanged))
+
+	rec = serveTest(cfg.updateUser, "PUT", "/api/users", token, `{"email":"alice@example.com","password":"another horse battery"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, listTestAuditEvents(t, cfg, auditPasswordChanged), 1)
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	var seen string
+	handler := middlewareRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r)
+	}))
+
+	// One from a proxy is kept
+	req := httptest.NewRequest(http.MethodGet, "/api/healthz", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "abc-123", seen)
+	assert.Equal(t, "abc-123", rec.Header().Get("X-Request-ID"))
+
+	// Anything odd is swapped for a new one
+	req = httptest.NewRequest(http.MethodGet, "/api/healthz", nil)
+	req.Header.Set("X-Request-ID", "has spaces\nand newlines")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.NotEqual(t, "has spaces\nand newlines", seen)
+	assert.NotEmpty(t, seen)
+	assert.Equal(t, seen, rec.Header().Get("X-Request-ID"))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// A previous body of an edited chirp and when it was replaced
+type chirpRevision struct {
+	ID         uuid.UUID `json:"id"`
+	Body       string    `json:"body"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+type revisionsResponse struct {
+	Revisions []chirpRevision `json:"revisions"`
+	Count     int             `json:"count"`
+}
+
+// Replaces the body of a chirp, only the owner can do this and only within the edit window
+// The old body is saved to chirp_revisions in the same statement
+
+func (cfg *ApiConfig) editChirp(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	type editRequest struct {
+		Body string `json:"body"`
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Chirp ID format")
+		return
+	}
+
+	userID, err := cfg.authenticatedUser(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err, "Unable to get user details")
+		return
+	}
+
+	var params editRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if params.Body == "" {
+		respondWithError(w, http.StatusBadRequest, "Chirp body can't be empty")
+		return
+	}
+
+	if len(params.Body) > 140 {
+		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
+		return
+	}
+
+	dbChirp, err := cfg.DBQueries.GetChirp(ctx, chirpID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (dbChirp.DeletedAt.Valid || dbChirp.HiddenAt.Valid)) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error finding chirp in database: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Error finding chirp")
+		return
+	}
+
+	// Same ownership check as deleting a chirp
+	if dbChirp.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Action not authorised")
+		return
+	}
+
+	if dbChirp.Kind == chirpKindRechirp {
+		respondWithError(w, http.StatusBadRequest, "Rechirps have no body to edit")
+		return
+	}
+
+	moderated := cfg.moderation.Check(params.Body)
+	if moderated.Rejected() {
+		respondWithError(w, http.StatusBadRequest, "Chirp contains words that aren't allowed")
+		return
+	}
+
+	// The window is checked against the database's clock, the same one
+	// that set created_at
+	edited, err := cfg.DBQueries.EditChirp(ctx, database.EditChirpParams{
+		ID:                chirpID,
+		EditWindowSeconds: cfg.editWindow.Seconds(),
+		Body:              moderated.Text,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusForbidden, "This chirp can no longer be edited")
+		return
+	}
+	if err != nil {
+		log.Printf("Error editing chirp: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to edit chirp")
+		return
+	}
+
+	cfg.flagChirp(ctx, edited, moderated)
+
+	// Editing can add or remove hashtags, same as posting none of it
+	// happens for shadow banned authors
+	if !cfg.authorHidden(ctx, userID) {
+		err = cfg.syncHashtags(ctx, edited.ID, edited.Body)
+		if err != nil {
+			log.Printf("Error saving hashtags: %v", err)
+		}
+
+		err = cfg.syncMentions(ctx, edited.ID, edited.Body)
+		if err != nil {
+			log.Printf("Error saving mentions: %v", err)
+		}
+
+		cfg.events.publish(ctx, event{
+			Kind:    eventChirpEdited,
+			ActorID: userID,
+			ChirpID: uuid.NullUUID{UUID: edited.ID, Valid: true},
+		})
+	}
+
+	chirp := chirpFromDB(edited)
+	err = cfg.decorateChirps(ctx, uuid.NullUUID{UUID: userID, Valid: true}, &chirp)
+	if err != nil {
+		log.Printf("Error loading chirp details: %v", err)
+	}
+
+	err = respondWithJSON(w, http.StatusOK, chirp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Lists the previous bodies of a chirp, most recent first
+func (cfg *ApiConfig) getChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	chirpID, ok := cfg.targetChirp(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.DBQueries.ListChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error listing chirp revisions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch revisions")
+		return
+	}
+
+	resp := revisionsResponse{Revisions: []chirpRevision{}, Count: len(rows)}
+	for _, row := range rows {
+		resp.Revisions = append(resp.Revisions, chirpRevision{
+			ID:         row.ID,
+			Body:       row.Body,
+			ReplacedAt: row.CreatedAt,
+		})
+	}
+
+	err = respondWithJSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
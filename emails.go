@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/Tim-Restart/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+// What an emailed token can be used for, and how long it lasts
+const (
+	emailPurposeVerify = "verify_email"
+	emailPurposeReset  = "reset_password"
+
+	verifyEmailTTL   = 24 * time.Hour
+	passwordResetTTL = time.Hour
+)
+
+// Actions that can be blocked until a user has verified their email
+const (
+	restrictChirp  = "chirp"
+	restrictLike   = "like"
+	restrictFollow = "follow"
+)
+
+var errInvalidEmail = errors.New("email address is not valid")
+
+// Accepts a bare address like user@example.com, no display names
+func validateEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", errInvalidEmail
+	}
+	return email, nil
+}
+
+// Reads a comma separated list like "chirp,like" into a set of restricted actions
+func parseRestrictions(s string) (map[string]bool, error) {
+	restrictions := map[string]bool{}
+	for _, action := range strings.Split(s, ",") {
+		action = strings.TrimSpace(action)
+		switch action {
+		case "":
+			continue
+		case restrictChirp, restrictLike, restrictFollow:
+			restrictions[action] = true
+		default:
+			return nil, fmt.Errorf("unknown restriction %q", action)
+		}
+	}
+	return restrictions, nil
+}
+
+// Stops unverified users doing an action if it's restricted, responds
+// and returns false if they can't
+func (cfg *ApiConfig) requireVerifiedEmail(w http.ResponseWriter, r *http.Request, userID uuid.UUID, action string) bool {
+	if !cfg.unverifiedRestrictions[action] {
+		return true
+	}
+
+	dbUser, err := cfg.DBQueries.GetUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error checking email verification: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to check account")
+		return false
+	}
+
+	if !dbUser.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Verify your email address first")
+		return false
+	}
+
+	return true
+}
+
+// Emails a single use token to the user, any earlier token for the same
+// thing stops working
+func (cfg *ApiConfig) sendEmailToken(ctx context.Context, userID uuid.UUID, email, purpose string) error {
+	err := cfg.DBQueries.ExpireEmailTokens(ctx, database.ExpireEmailTokensParams{
+		UserID:  userID,
+		Purpose: purpose,
+	})
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	ttl := verifyEmailTTL
+	if purpose == emailPurposeReset {
+		ttl = passwordResetTTL
+	}
+
+	err = cfg.DBQueries.CreateEmailToken(ctx, database.CreateEmailTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, emailTokenMessage(cfg.baseURL, email, purpose, token, ttl))
+}
+
+func emailTokenMessage(baseURL, email, purpose, token string, ttl time.Duration) mailer.Message {
+	if purpose == emailPurposeReset {
+		link := baseURL + "/app/reset-password?token=" + url.QueryEscape(token)
+		return mailer.Message{
+			To:      email,
+			Subject: "Reset your Chirpy password",
+			Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+				"Reset it here within %s:\n%s\n\nIf it wasn't you, you can ignore this email.\n", ttl, link),
+		}
+	}
+
+	link := baseURL + "/app/verify-email?token=" + url.QueryEscape(token)
+	return mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body:    fmt.Sprintf("Welcome to Chirpy!\n\nConfirm this is your email address within %s:\n%s\n", ttl, link),
+	}
+}
+
+// Sends the authenticated user a new verification email
+func (cfg *ApiConfig) resendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	dbUser, err := cfg.DBQueries.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	if dbUser.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "Email address is already verified")
+		return
+	}
+
+	err = cfg.sendEmailToken(r.Context(), dbUser.ID, dbUser.Email, emailPurposeVerify)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to send verification email")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Marks an email address as verified using the token that was emailed to it
+func (cfg *ApiConfig) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	type verifyRequest struct {
+		Token string `json:"token"`
+	}
+
+	var params verifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	used, err := cfg.DBQueries.UseEmailToken(r.Context(), database.UseEmailTokenParams{
+		TokenHash: auth.HashToken(params.Token),
+		Purpose:   emailPurposeVerify,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+		log.Printf("Error using verification token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to verify email")
+		return
+	}
+
+	// Does nothing if the user has changed their email since it was sent
+	_, err = cfg.DBQueries.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+		ID:    used.UserID,
+		Email: used.Email,
+	})
+	if err != nil {
+		log.Printf("Error marking email verified: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to verify email")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Emails a password reset link, always says it worked so it can't be used
+// to find out who has an account
+func (cfg *ApiConfig) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type resetRequest struct {
+		Email string `json:"email"`
+	}
+
+	var params resetRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Done after responding, so how long the response takes doesn't give
+	// away whether the email has an account
+	go cfg.sendPasswordReset(context.WithoutCancel(r.Context()), strings.TrimSpace(params.Email))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Emails a reset link if there's an account for email, otherwise does nothing
+func (cfg *ApiConfig) sendPasswordReset(ctx context.Context, email string) {
+	dbUser, err := cfg.DBQueries.GetEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error looking up user for password reset: %s", err)
+		}
+		return
+	}
+
+	err = cfg.sendEmailToken(ctx, dbUser.ID, dbUser.Email, emailPurposeReset)
+	if err != nil {
+		log.Printf("Error sending password reset email: %s", err)
+	}
+}
+
+// Sets a new password using an emailed reset token, and signs the user
+// out everywhere in case someone else had their old password
+func (cfg *ApiConfig) resetPassword(w http.ResponseWriter, r *http.Request) {
+	type resetPasswordRequest struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var params resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	err := cfg.passwordPolicy.Check(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hash, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to reset password")
+		return
+	}
+
+	used, err := cfg.DBQueries.UseEmailToken(r.Context(), database.UseEmailTokenParams{
+		TokenHash: auth.HashToken(params.Token),
+		Purpose:   emailPurposeReset,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+		log.Printf("Error using password reset token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to reset password")
+		return
+	}
+
+	err = cfg.DBQueries.SetPassword(r.Context(), database.SetPasswordParams{
+		ID:             used.UserID,
+		HashedPassword: hash,
+	})
+	if err != nil {
+		log.Printf("Error setting password: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to reset password")
+		return
+	}
+
+	err = cfg.DBQueries.RevokeOtherSessions(r.Context(), database.RevokeOtherSessionsParams{
+		UserID: used.UserID,
+	})
+	if err != nil {
+		log.Printf("Error revoking sessions after password reset: %s", err)
+	}
+
+	// Getting the email proves they own the address
+	_, err = cfg.DBQueries.MarkEmailVerified(r.Context(), database.MarkEmailVerifiedParams{
+		ID:    used.UserID,
+		Email: used.Email,
+	})
+	if err != nil {
+		log.Printf("Error marking email verified: %s", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
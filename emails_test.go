@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEmail(t *testing.T) {
+	email, err := validateEmail(" user@example.com ")
+	assert.NoError(t, err)
+	assert.Equal(t, "user@example.com", email)
+
+	for _, bad := range []string{"", "not an email", "User <user@example.com>", "user@"} {
+		_, err := validateEmail(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestParseRestrictions(t *testing.T) {
+	restrictions, err := parseRestrictions("chirp, like")
+	assert.NoError(t, err)
+	assert.True(t, restrictions[restrictChirp])
+	assert.True(t, restrictions[restrictLike])
+	assert.False(t, restrictions[restrictFollow])
+
+	_, err = parseRestrictions("chirp,fly")
+	assert.Error(t, err)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Things that happen in the app that other parts might want to react to
+const (
+	eventFollow       = "follow"
+	eventLike         = "like"
+	eventChirpCreated = "chirp_created"
+	eventChirpEdited  = "chirp_edited"
+	eventChirpyRed    = "chirpy_red"
+
+	// A refresh token that was already rotated or revoked was used again
+	eventRefreshTokenReuse = "refresh_token_reuse"
+)
+
+// An event says who did what, to which user and/or chirp
+type event struct {
+	Kind    string
+	ActorID uuid.UUID
+	UserID  uuid.NullUUID
+	ChirpID uuid.NullUUID
+}
+
+type eventHandler func(ctx context.Context, ev event) error
+
+// Handlers subscribe to the kinds of events they care about, so handlers
+// only have to publish what happened and don't need to know who's listening
+type eventBus struct {
+	mu       sync.RWMutex
+	handlers map[string][]eventHandler
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{handlers: map[string][]eventHandler{}}
+}
+
+func (b *eventBus) subscribe(kind string, handler eventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[kind] = append(b.handlers[kind], handler)
+}
+
+// Runs every handler for the event, the action has already happened
+// so errors are logged rather than passed back to the caller
+func (b *eventBus) publish(ctx context.Context, ev event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers[ev.Kind]
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		err := handler(ctx, ev)
+		if err != nil {
+			log.Printf("Error handling %s event: %v", ev.Kind, err)
+		}
+	}
+}
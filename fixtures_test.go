@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/Tim-Restart/chirpy/internal/lockout"
+	"github.com/Tim-Restart/chirpy/internal/mailer"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// Handler tests that need Postgres only run when TEST_DB_URL points at a
+// database they can make schemas in. Each test gets its own schema built
+// from sql/schema/schema.sql, dropped again when it's done
+func newTestConfig(t *testing.T) *ApiConfig {
+	t.Helper()
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL isn't set")
+	}
+
+	admin, err := sql.Open("postgres", dbURL)
+	require.NoError(t, err)
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(dbURL, schema))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	ddl, err := os.ReadFile("sql/schema/schema.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(ddl))
+	require.NoError(t, err)
+
+	dbQueries := database.New(db)
+	filter, err := newContentFilter(dbQueries, defaultModerationRules)
+	require.NoError(t, err)
+
+	return &ApiConfig{
+		db:             db,
+		DBQueries:      dbQueries,
+		jwtKeys:        auth.SecretKeySet("test-secret"),
+		editWindow:     15 * time.Minute,
+		events:         newEventBus(),
+		mailer:         &mailer.LogMailer{Dir: t.TempDir()},
+		passwordPolicy: auth.NewPasswordPolicy(8),
+		moderation:     filter,
+		lockouts:       newLoginLockouts(lockout.NewMemoryStore()),
+	}
+}
+
+// lib/pq passes settings it doesn't know through to the server
+func withSearchPath(dbURL, schema string) string {
+	if strings.HasPrefix(dbURL, "postgres://") || strings.HasPrefix(dbURL, "postgresql://") {
+		if strings.Contains(dbURL, "?") {
+			return dbURL + "&search_path=" + schema
+		}
+		return dbURL + "?search_path=" + schema
+	}
+	return dbURL + " search_path=" + schema
+}
+
+func createTestUser(t *testing.T, cfg *ApiConfig, email string) database.User {
+	t.Helper()
+	hash, err := auth.HashPassword("correct horse battery")
+	require.NoError(t, err)
+	user, err := cfg.DBQueries.CreateUser(context.Background(), database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hash,
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func createTestChirp(t *testing.T, cfg *ApiConfig, userID uuid.UUID, body string) database.Chirp {
+	t.Helper()
+	chirp, err := cfg.DBQueries.NewChirp(context.Background(), database.NewChirpParams{
+		Body:   body,
+		UserID: userID,
+		Kind:   chirpKindChirp,
+	})
+	require.NoError(t, err)
+	return chirp
+}
+
+// A logged in session's access token for the user
+func testToken(t *testing.T, cfg *ApiConfig, userID uuid.UUID) string {
+	t.Helper()
+	token, err := cfg.jwtKeys.MakeSessionJWT(userID, uuid.New(), auth.RoleUser, time.Hour)
+	require.NoError(t, err)
+	return token
+}
+
+// Logs in with the password createTestUser gives everyone
+func loginTestUser(t *testing.T, cfg *ApiConfig, email string) User {
+	t.Helper()
+	rec := serveTest(cfg.login, "POST", "/api/login", "", `{"email":"`+email+`","password":"correct horse battery"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var user User
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &user))
+	require.NotEmpty(t, user.Refresh_Token)
+	return user
+}
+
+// Gets the chirp as whoever token belongs to, or logged out if it's blank
+func fetchTestChirp(t *testing.T, cfg *ApiConfig, token, chirpID string) Chirp {
+	t.Helper()
+	rec := serveTest(cfg.getChirp, "GET", "/api/chirps/"+chirpID, token, "", "chirpID", chirpID)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var chirp Chirp
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &chirp))
+	return chirp
+}
+
+// A personal access token for the user with the given scopes
+func createTestAccessToken(t *testing.T, cfg *ApiConfig, userID uuid.UUID, scopes ...string) string {
+	t.Helper()
+	token, err := auth.MakeAccessToken()
+	require.NoError(t, err)
+	_, err = cfg.DBQueries.CreateAccessToken(context.Background(), database.CreateAccessTokenParams{
+		UserID:    userID,
+		Name:      "test",
+		TokenHash: auth.HashToken(token),
+		Scopes:    scopes,
+	})
+	require.NoError(t, err)
+	return token
+}
+
+// Gives the user a role straight in the database, tokens made before keep
+// whatever role they were made with
+func setTestRole(t *testing.T, cfg *ApiConfig, userID uuid.UUID, role string) {
+	t.Helper()
+	_, err := cfg.DBQueries.SetUserRole(context.Background(), database.SetUserRoleParams{ID: userID, Role: role})
+	require.NoError(t, err)
+}
+
+// Calls handler with a request, the token goes in the Authorization header
+// if it isn't blank and pathValues are name, value pairs
+func serveTest(handler http.HandlerFunc, method, target, token, body string, pathValues ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(pathValues); i += 2 {
+		req.SetPathValue(pathValues[i], pathValues[i+1])
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// One row of a followers/following list
+type followEntry struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// Response envelope for the followers/following lists
+type followPage struct {
+	Users      []followEntry `json:"users"`
+	Count      int64         `json:"count"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// Reads the {userID} path value and makes sure that user exists
+// Writes the error response itself, callers just return when ok is false
+func (cfg *ApiConfig) targetUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return uuid.Nil, false
+	}
+
+	_, err = cfg.DBQueries.CheckUser(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return uuid.Nil, false
+	}
+	if err != nil {
+		log.Printf("Error checking user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to find user")
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
+
+// Follows the user in the path as the authenticated user
+func (cfg *ApiConfig) followUser(w http.ResponseWriter, r *http.Request) {
+	followerID, err := cfg.authenticatedUser(r, auth.ScopeProfileWrite)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	followeeID, ok := cfg.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if followerID == followeeID {
+		respondWithError(w, http.StatusBadRequest, "You can't follow yourself")
+		return
+	}
+
+	if !cfg.requireVerifiedEmail(w, r, followerID, restrictFollow) {
+		return
+	}
+
+	// Following someone twice is a no-op
+	err = cfg.DBQueries.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Error following user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to follow user")
+		return
+	}
+
+	cfg.events.publish(r.Context(), event{
+		Kind:    eventFollow,
+		ActorID: followerID,
+		UserID:  uuid.NullUUID{UUID: followeeID, Valid: true},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unfollows the user in the path as the authenticated user
+func (cfg *ApiConfig) unfollowUser(w http.ResponseWriter, r *http.Request) {
+	followerID, err := cfg.authenticatedUser(r, auth.ScopeProfileWrite)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	err = cfg.DBQueries.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Error unfollowing user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to unfollow user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists who follows the user in the path, newest first, with the total count
+func (cfg *ApiConfig) getFollowers(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithFollows(w, r, "followers", cfg.listFollowers)
+}
+
+// Lists who the user in the path follows, newest first, with the total count
+func (cfg *ApiConfig) getFollowing(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithFollows(w, r, "following", cfg.listFollowing)
+}
+
+// Gets a page of one side of a user's follows and how many there are altogether
+type followLister func(ctx context.Context, userID uuid.UUID, page pageParams) ([]followEntry, int64, error)
+
+// The shared part of the followers and following lists, name is only for errors
+func (cfg *ApiConfig) respondWithFollows(w http.ResponseWriter, r *http.Request, name string, list followLister) {
+	userID, ok := cfg.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, count, err := list(r.Context(), userID, page)
+	if err != nil {
+		log.Printf("Error listing %s: %s", name, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch "+name)
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, newFollowPage(entries, count, page.Limit))
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+func (cfg *ApiConfig) listFollowers(ctx context.Context, userID uuid.UUID, page pageParams) ([]followEntry, int64, error) {
+	params := database.ListFollowersParams{
+		UserID: userID,
+		Limit:  int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	rows, err := cfg.DBQueries.ListFollowers(ctx, params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]followEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, followEntry{UserID: row.UserID, FollowedAt: row.CreatedAt})
+	}
+
+	count, err := cfg.DBQueries.CountFollowers(ctx, userID)
+	return entries, count, err
+}
+
+func (cfg *ApiConfig) listFollowing(ctx context.Context, userID uuid.UUID, page pageParams) ([]followEntry, int64, error) {
+	params := database.ListFollowingParams{
+		UserID: userID,
+		Limit:  int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	rows, err := cfg.DBQueries.ListFollowing(ctx, params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]followEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, followEntry{UserID: row.UserID, FollowedAt: row.CreatedAt})
+	}
+
+	count, err := cfg.DBQueries.CountFollowing(ctx, userID)
+	return entries, count, err
+}
+
+// Trims the extra lookahead row off and sets the next cursor if there was one
+func newFollowPage(entries []followEntry, count int64, limit int) followPage {
+	page := followPage{Users: entries, Count: count}
+	if len(entries) > limit {
+		last := entries[limit-1]
+		page.Users = entries[:limit]
+		page.NextCursor = encodeCursor(pageCursor{CreatedAt: last.FollowedAt, ID: last.UserID})
+	}
+	return page
+}
+
+// Home timeline - chirps from everyone the authenticated user follows, newest first
+func (cfg *ApiConfig) getTimeline(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.TimelineChirpsParams{
+		FollowerID: userID,
+		Limit:      int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	chirpsFromDB, err := cfg.DBQueries.TimelineChirps(r.Context(), params)
+	if err != nil {
+		log.Printf("Error fetching timeline: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch timeline")
+		return
+	}
+
+	timeline := newChirpPage(chirpsFromDB, page.Limit)
+	err = cfg.decorateChirpSlice(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, timeline.Chirps)
+	if err != nil {
+		log.Printf("Error counting likes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch timeline")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, timeline)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeFollowPage(t *testing.T, body []byte) followPage {
+	t.Helper()
+	var page followPage
+	require.NoError(t, json.Unmarshal(body, &page))
+	return page
+}
+
+func TestFollowUnfollow(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	bob := createTestUser(t, cfg, "bob@example.com")
+	token := testToken(t, cfg, alice.ID)
+
+	// Following twice is fine and still only counts once
+	for i := 0; i < 2; i++ {
+		rec := serveTest(cfg.followUser, "POST", "/api/users/"+bob.ID.String()+"/follow", token, "", "userID", bob.ID.String())
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	}
+
+	rec := serveTest(cfg.getFollowers, "GET", "/api/users/"+bob.ID.String()+"/followers", "", "", "userID", bob.ID.String())
+	require.Equal(t, http.StatusOK, rec.Code)
+	followers := decodeFollowPage(t, rec.Body.Bytes())
+	assert.Equal(t, int64(1), followers.Count)
+	require.Len(t, followers.Users, 1)
+	assert.Equal(t, alice.ID, followers.Users[0].UserID)
+
+	rec = serveTest(cfg.getFollowing, "GET", "/api/users/"+alice.ID.String()+"/following", "", "", "userID", alice.ID.String())
+	require.Equal(t, http.StatusOK, rec.Code)
+	following := decodeFollowPage(t, rec.Body.Bytes())
+	assert.Equal(t, int64(1), following.Count)
+	require.Len(t, following.Users, 1)
+	assert.Equal(t, bob.ID, following.Users[0].UserID)
+
+	// So is unfollowing twice
+	for i := 0; i < 2; i++ {
+		rec = serveTest(cfg.unfollowUser, "DELETE", "/api/users/"+bob.ID.String()+"/follow", token, "", "userID", bob.ID.String())
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	}
+
+	rec = serveTest(cfg.getFollowers, "GET", "/api/users/"+bob.ID.String()+"/followers", "", "", "userID", bob.ID.String())
+	require.Equal(t, http.StatusOK, rec.Code)
+	followers = decodeFollowPage(t, rec.Body.Bytes())
+	assert.Equal(t, int64(0), followers.Count)
+	assert.Empty(t, followers.Users)
+}
+
+func TestFollowRejects(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	token := testToken(t, cfg, alice.ID)
+
+	rec := serveTest(cfg.followUser, "POST", "/api/users/"+alice.ID.String()+"/follow", token, "", "userID", alice.ID.String())
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	unknown := uuid.New()
+	rec = serveTest(cfg.followUser, "POST", "/api/users/"+unknown.String()+"/follow", token, "", "userID", unknown.String())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serveTest(cfg.followUser, "POST", "/api/users/"+unknown.String()+"/follow", "", "", "userID", unknown.String())
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestTimeline(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	bob := createTestUser(t, cfg, "bob@example.com")
+	carol := createTestUser(t, cfg, "carol@example.com")
+	token := testToken(t, cfg, alice.ID)
+
+	for _, followee := range []uuid.UUID{bob.ID, carol.ID} {
+		rec := serveTest(cfg.followUser, "POST", "/api/users/"+followee.String()+"/follow", token, "", "userID", followee.String())
+		require.Equal(t, http.StatusNoContent, rec.Code)
+	}
+
+	createTestChirp(t, cfg, bob.ID, "first from bob")
+	createTestChirp(t, cfg, carol.ID, "first from carol")
+	createTestChirp(t, cfg, bob.ID, "second from bob")
+	// Only chirps from people alice follows, none of alice's own
+	createTestChirp(t, cfg, alice.ID, "from alice")
+
+	rec := serveTest(cfg.getTimeline, "GET", "/api/timeline", token, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var timeline chirpPage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &timeline))
+	require.Len(t, timeline.Chirps, 3)
+	for i, chirp := range timeline.Chirps {
+		assert.NotEqual(t, alice.ID, chirp.User_ID)
+		if i > 0 {
+			prev := timeline.Chirps[i-1]
+			assert.False(t, chirp.CreatedAt.After(prev.CreatedAt), "timeline should be newest first")
+		}
+	}
+
+	// Carol's chirps drop off after unfollowing
+	rec = serveTest(cfg.unfollowUser, "DELETE", "/api/users/"+carol.ID.String()+"/follow", token, "", "userID", carol.ID.String())
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = serveTest(cfg.getTimeline, "GET", "/api/timeline", token, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	timeline = chirpPage{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &timeline))
+	require.Len(t, timeline.Chirps, 2)
+	for _, chirp := range timeline.Chirps {
+		assert.Equal(t, bob.ID, chirp.User_ID)
+	}
+}
@@ -1,865 +1,1232 @@
-package main
-
-import (
-	"net/http"
-	"fmt"
-	"encoding/json"
-	"log"
-	"github.com/Tim-Restart/chirpy/internal/database"
-	"github.com/google/uuid"
-	"github.com/Tim-Restart/chirpy/internal/auth"
-	"time"
-	"context"
-	"sort"
-)
-
-
-func (cfg *ApiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
-	// Increments the fileserverHits
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Increment the counter using atomic32 add
-		cfg.fileserverHits.Add(1)
-		// pass next to ServerHTTP
-		next.ServeHTTP(w, r)
-	})
-}
-
-func (cfg *ApiConfig) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	counter := cfg.fileserverHits.Load()
-
-	//HTML template for admin page
-	htmlTemplate := `<html>
-	<body>
-		<h1>Welcome, Chirpy Admin</h1>
-		<p>Chirpy has been visited %d times!</p>
-	</body>
-	</html>`
-
-	// Format the above template with the counter in the %d spot
-	htmlContent := fmt.Sprintf(htmlTemplate, counter)
-
-	// Sets the header type to HTML
-	w.Header().Set("Content-Type", "text/html")
-
-	// Write the html to the response
-	fmt.Fprint(w, htmlContent)
-}
-
-func (cfg *ApiConfig) metricsResetHandler(w http.ResponseWriter, r *http.Request) {
-
-	// Check if user is dev prior to allowing reset
-	if cfg.platform != "dev" {
-		// Error for not having the right permission
-		errResp := errorResponse{
-			Error: "This endpoint only avaliable in development mode",
-		}
-
-		jsonResp, err := json.Marshal(errResp)
-		if err != nil {
-			log.Printf("Error marshalling JSON %s", err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError) // 500 error code
-			w.Write([]byte(`{"error":"Internal server error"}`))
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden) // 403 error code
-		w.Write(jsonResp)
-		return
-	}
-
-	// Calls the SQLC genereated function to delete all users
-	err := cfg.DBQueries.DeleteAllUsers(r.Context())
-	if err != nil {
-		log.Printf("Error deleting users: %s", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(`{"error":"Failed to reset database"}`))
-		return
-	}
-
-	cfg.fileserverHits.Store(0)
-	w.WriteHeader(http.StatusOK) // Status  200
-	w.Write([]byte("Counter Reset\n"))
-}
-
-// Function to add a new user to the database by email - uses SQL query from SQLC
-
-func (cfg *ApiConfig) addUser(w http.ResponseWriter, r *http.Request) {
-
-	ctx := r.Context()
-
-	type createUserRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-
-	var params createUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		errResp := errorResponse{
-			Error: "Invalid request body: " + err.Error(),
-		}
-
-		jsonResp, err := json.Marshal(errResp)
-		if err != nil {
-			log.Printf("Error marshalling JSON: %s", err)
-			w.WriteHeader(http.StatusInternalServerError) // Status 500
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest) // 400 for client errors
-		w.Write(jsonResp)
-		return
-	}
-
-	// Logic to hash the password and return it to upload to the database 
-
-	hash, err := auth.HashPassword(params.Password)
-	if err != nil {
-		// Prints the error to the terminal
-		log.Println("Error hashing password")
-		// Creates the error to respond with
-		errResp := errorResponse{
-			Error: "Error creating user password: " + err.Error(),
-		}
-
-		err = respondWithJSON(w, 500, errResp)
-		if err != nil {
-			// Handle JSON encoding error
-			http.Error(w, "Failed to encode password", http.StatusInternalServerError)
-			log.Printf("JSON encoding error: %s", err)
-			return
-		}
-		return
-	}
-
-	// Create a CreateUserParams struct
-	createParams := database.CreateUserParams{
-		Email:          params.Email,
-		HashedPassword: hash,
-}
-
-	dbUser, err := cfg.DBQueries.CreateUser(r.Context(), createParams)
-	if err != nil {
-		log.Println("Error mapping to database")
-
-		errResp := errorResponse{
-			Error: "Error creating user: " + err.Error(),
-		}
-
-		jsonResp, err := json.Marshal(errResp)
-		if err != nil {
-			log.Printf("Error marshalling JSON: %s", err)
-			w.WriteHeader(http.StatusInternalServerError) // Status 500
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError) // Status 500
-		w.Write(jsonResp)
-		return
-	}
-
-	chirpyRed, err := cfg.DBQueries.IsChirpyRed(ctx, dbUser.ID)
-	if err != nil {
-		log.Printf("Error getting user Red stauts: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-
-	
-	// Do not include a password hash or field here!
-	user := User{
-		ID:        dbUser.ID,
-		CreatedAt: dbUser.CreatedAt,
-		UpdatedAt: dbUser.UpdatedAt,
-		Email:     dbUser.Email,
-		IsChirpyRed: chirpyRed.Valid && chirpyRed.Bool,
-		}
-
-	userJSON, err := json.Marshal(user)
-	if err != nil {
-		log.Printf("Error marshalling user: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// Successful response - returns the userJSON marshalled
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated) // 201 for resource creation
-	w.Write(userJSON)
-
-}
-
-func (cfg *ApiConfig) newChirp(w http.ResponseWriter, r *http.Request) {
-
-	type Chirp_Input struct {
-		Body    string `json:"body"`
-		User_id string `json:"user_id"`
-	}
-
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		http.Error(w, "Unauthorized: Invalid or missing token", http.StatusUnauthorized)
-		return
-	}
-
-	userUUID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		http.Error(w, "Unauthorized: Invalid or missing token", http.StatusUnauthorized)
-		return
-	}
-
-	
-
-	// Created an empty Chirp struct
-	var params Chirp_Input
-
-	// Decode the JSON input and assign it to the Chirp_input struct
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		errResp := errorResponse{
-			Error: "Invalid request body: " + err.Error(),
-		}
-
-		jsonResp, err := json.Marshal(errResp)
-		if err != nil {
-			log.Printf("Error marshalling JSON: %s", err)
-			w.WriteHeader(http.StatusInternalServerError) // Status 500
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest) // 400 for client errors
-		w.Write(jsonResp)
-		return
-	}
-
-	// Checks the length of the chirp
-	if len(params.Body) > 140 {
-		errResp := errorResponse{
-			Error: "Chirp is too long",
-		}
-
-		jsonResp, err := json.Marshal(errResp)
-		if err != nil {
-			log.Printf("Error marshalling JSON %s", err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest) // Status 400
-			w.Write(jsonResp)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest) // Status 400
-		w.Write(jsonResp)
-		return
-	}
-
-	// Clean the chirp body
-	cleanedBodyBytes := badWordReplacement(params.Body)
-	cleanedBody := string(cleanedBodyBytes)
-	fmt.Printf(cleanedBody)
-
-	// Create the NewChirpParams struct
-	chirpParams := database.NewChirpParams{
-		Body:   cleanedBody,
-		UserID: userUUID,
-	}
-
-	// Run the newChirp query? and deal with any errors
-	// Sends through the JSON input to the query as args
-
-	dbChirp, err := cfg.DBQueries.NewChirp(r.Context(), chirpParams)
-	if err != nil {
-		log.Printf("Error mapping to chirp database: %v", err)
-
-		errResp := errorResponse{
-			Error: "Error creating new chirp: " + err.Error(),
-		}
-
-		err = respondWithJSON(w, 500, errResp)
-		if err != nil {
-			// Handle JSON encoding error
-			http.Error(w, "Failed to encode chirps", http.StatusInternalServerError)
-			log.Printf("JSON encoding error: %s", err)
-			return
-		}
-	}
-	
-
-	new_Chirp := Chirp{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		Body:      dbChirp.Body,
-		User_ID:   userUUID,
-	}
-
-	// Testing respondWithJSON
-
-	err = respondWithJSON(w, 201, new_Chirp)
-	if err != nil {
-		// Handle JSON encoding error
-		http.Error(w, "Failed to encode chirps", http.StatusInternalServerError)
-		log.Printf("JSON encoding error: %s", err)
-		return
-	}
-}
-
-// This is the handler function that calls on the DB query to get all the chirps
-// This function only creates the JSON response and encodes it, it then returns
-// The HTTP responses and JSON
-
-func (cfg *ApiConfig) handleGetChirps(w http.ResponseWriter, r *http.Request) {
-	// Use the request's context for the query
-	ctx := r.Context()
-
-	// See if there is an author ID in the query
-	// if so, call the function to get only all the chirps form that author
-	s := r.URL.Query().Get("author_id")
-
-	if s != "" {
-		// Encode the authorID into a UUID
-		author, err := uuid.Parse(s)
-		if err != nil {
-			errResp := errorResponse{
-			Error: "Invalid Chirp ID format",
-		}
-		http.Error(w, "Failed to encode UUID for chirp", http.StatusInternalServerError)
-		log.Printf("JSON encoding error: %s", errResp)
-		return
-		}
-
-
-		// get the chirps from the author and decode into dbCHirp
-		dbChirp, err := cfg.DBQueries.ChirpsFrom(ctx, author)
-		if err != nil {
-
-			if err.Error() == "sql: no rows in result set" {
-				// Chirp not found, return 404
-				w.WriteHeader(http.StatusNotFound)
-				return
-			}
-			log.Printf("Error finding chirp in database: %v", err)
-
-			errResp := errorResponse{
-				Error: "Error finding chirp: " + err.Error(),
-			}
-
-			err = respondWithJSON(w, 500, errResp)
-			if err != nil {
-				// Handle JSON encoding error
-				http.Error(w, "Failed to encode chirps", http.StatusInternalServerError)
-				log.Printf("JSON encoding error: %s", err)
-				return
-			}
-		}
-		// Struct to hold the body of the authors chirps
-		var selectedChirps []Chirp
-		for _, body := range dbChirp {
-   			selectedChirps = append(selectedChirps, Chirp{
-        	Body: body,
-      
-    	})
-}
-
-		// Respond with above
-		err = respondWithJSON(w, http.StatusOK, selectedChirps)
-		if err != nil {
-		// Handle JSON encoding error
-			http.Error(w, "Failed to encode chirps", http.StatusInternalServerError)
-			log.Printf("JSON encoding error: %s", err)
-			return
-	}
-		return
-	}
-
-	// Call the GetChirps function to fetch chirps from the database
-	chirps, err := cfg.getChirps(ctx)
-	if err != nil {
-		// If an error occurred, respond with 500 Internal Server Error
-		http.Error(w, "Failed to fetch chirps", http.StatusInternalServerError)
-		log.Printf("Database error: %s", err)
-		return
-	}
-
-	// Check if there is a 
-	sorted := r.URL.Query().Get("sort")
-
-	if sorted == "desc" {
-		sort.Slice(chirps, func(i, j int) bool { 
-			return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
-		})
-	} else {
-		// Default to ascending order
-		sort.Slice(chirps, func(i, j int) bool { 
-			return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
-		})
-	}
-		
-
-
-	// Trying out the respondWithJSON helper
-
-	err = respondWithJSON(w, http.StatusOK, chirps)
-	if err != nil {
-		// Handle JSON encoding error
-		http.Error(w, "Failed to encode chirps", http.StatusInternalServerError)
-		log.Printf("JSON encoding error: %s", err)
-		return
-	}
-
-}
-
-// Returns a single chirp by using the UUID of the chirp
-// http.Request.PathValue used in here to do something with a string
-
-func (cfg *ApiConfig) getChirp(w http.ResponseWriter, r *http.Request) {
-
-	// Ok something here about using the UUID to do a query on the DB?
-	// Don't forget context...
-	idString := r.PathValue("chirpID")
-	chirpToGet, err:= uuid.Parse(idString)
-	if err != nil {
-		
-		errResp := errorResponse{
-			Error: "Invalid Chirp ID format",
-		}
-		http.Error(w, "Failed to encode UUID for chirp", http.StatusInternalServerError)
-		log.Printf("JSON encoding error: %s", errResp)
-		return
-	}
-	// maybe assign variable here for the chirp ID?
-
-
-	dbChirp, err := cfg.DBQueries.GetChirp(r.Context(), chirpToGet)
-	if err != nil {
-
-		if err.Error() == "sql: no rows in result set" {
-			// Chirp not found, return 404
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-		log.Printf("Error finding chirp in database: %v", err)
-
-		errResp := errorResponse{
-			Error: "Error finding chirp: " + err.Error(),
-		}
-
-		err = respondWithJSON(w, 500, errResp)
-		if err != nil {
-			// Handle JSON encoding error
-			http.Error(w, "Failed to encode chirps", http.StatusInternalServerError)
-			log.Printf("JSON encoding error: %s", err)
-			return
-		}
-	}
-
-	new_Chirp := Chirp{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		Body:      dbChirp.Body,
-		User_ID:   dbChirp.UserID,
-	}
-
-	err = respondWithJSON(w, http.StatusOK, new_Chirp)
-	if err != nil {
-		// Handle JSON encoding error
-		http.Error(w, "Failed to encode chirps", http.StatusInternalServerError)
-		log.Printf("JSON encoding error: %s", err)
-		return
-	}
-
-}
-
-func (cfg *ApiConfig) login(w http.ResponseWriter, r *http.Request) {
-
-	ctx := r.Context()
-
-	// Define a struct to take the JSON input
-	type LoginRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		//ExpiresInSeconds *int    `json:"expires_in_seconds"`
-	}
-
-	// Create an empty of above
-	var params LoginRequest
-	// Decode the inputed JSON response to the memory
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		// Deal with any JSON decoding errors
-		errResp := errorResponse{
-			Error: "Invalid request body: " + err.Error(),
-		}
-		// Respond using the helper function
-		errJ := respondWithJSON(w, 500, errResp)
-		if errJ != nil {
-			// Handle JSON encoding error
-			respondWithError(w, http.StatusInternalServerError, "Failed to encode JSON")
-			log.Printf("JSON encoding error: %s", err)
-			return
-		}
-	
-			
-	}
-
-	expiration := time.Hour
-	
-
-	// Start by looking up a user in the DB by their email and return the hash?
-	dbUser, err := cfg.DBQueries.GetEmail(ctx, params.Email)
-	if err != nil {
-		errResp := errorResponse{
-			Error: "Incorrect email or password",
-		}
-		errJ := respondWithJSON(w, 401, errResp)
-		if errJ != nil {
-			respondWithError(w, http.StatusInternalServerError, "Failed to encode JSON")
-			log.Printf("JSON encoding error: %s", errJ)
-		}
-		return
-	}
-
-	// use the hash and the new password to send to the comparer
-
-	err = auth.CheckPasswordHash(dbUser.HashedPassword, params.Password)
-	if err != nil {
-		errResp := errorResponse{
-			Error: "Incorrect email or password",
-		}
-		errJ := respondWithJSON(w, 401, errResp)
-		if errJ != nil {
-			// Handle JSON encoding error
-			respondWithError(w, http.StatusInternalServerError, "Failed to encode JSON")
-			log.Printf("JSON encoding error: %s", err)
-			return
-		}
-	}
-
-	chirpyRed, err := cfg.DBQueries.IsChirpyRed(ctx, dbUser.ID)
-	if err != nil {
-		log.Printf("Error getting user Red stauts: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-
-	// Assign the user information to be returned on successful password
-	user := User{
-		ID:        dbUser.ID,
-		CreatedAt: dbUser.CreatedAt,
-		UpdatedAt: dbUser.UpdatedAt,
-		Email:     dbUser.Email,
-		IsChirpyRed: chirpyRed.Valid && chirpyRed.Bool,
-		}
-
-	// After validating user credentials
-	tokenString, err := auth.MakeJWT(user.ID, cfg.jwtSecret, expiration) // Use your expiration value here
-	if err != nil {
-		// Handle the error, perhaps return a 500
-		respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
-		return
-	}
-
-	user.Token = tokenString
-
-	user.Refresh_Token, err = auth.MakeRefreshToken() // return the refresh_token here
-	err = auth.SaveRefreshToken(user.Refresh_Token, dbUser.ID, *cfg.DBQueries)
-	if err != nil {
-		log.Print("Error saving refresh token")
-		return
-	}
-	
-	// Encode the response and return the results
-	err = respondWithJSON(w, 200, user)
-	if err != nil {
-		// Handle JSON encoding error
-		respondWithError(w, http.StatusInternalServerError, "Failed to encode JSON")
-		log.Printf("JSON encoding error: %s", err)
-		return
-	}
-	
-}
-
-// requires a refresh token to be present in the headers
-func (cfg *ApiConfig) refresh(w http.ResponseWriter, r *http.Request) {
-	token, _ := auth.GetBearerToken(r.Header)
-	if token == "" {
-		respondWithError(w, http.StatusUnauthorized, "No token provided")
-		return
-	}
-
-	// Get user info from the refresh token
-	rows, err := cfg.DBQueries.GetUserFromRefreshToken(r.Context(), token)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid token")
-		return
-	}
-	
-	// Check if we got any results
-	if len(rows) == 0 {
-		respondWithError(w, http.StatusUnauthorized, "Invalid token")
-		return
-	}
-	
-	// Use the first row (assuming tokens are unique)
-	tokenInfo := rows[0]
-	
-	// Checks if the token has been revoked
-	if tokenInfo.RevokedAt.Valid {
-		respondWithError(w, http.StatusUnauthorized, "Token revoked")
-		return
-	} 
-
-	// Check if the token has expired
-	if time.Now().After(tokenInfo.ExpiresAt) {
-		respondWithError(w, http.StatusUnauthorized, "Token expired")
-		return
-	}
-
-	// Generate a new access token for the user
-	accessToken, err := auth.MakeJWT(tokenInfo.UserID, cfg.jwtSecret, time.Hour)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create token")
-		return
-	}
-	
-	// Respond with the new access token
-	respondWithJSON(w, http.StatusOK, map[string]string{
-		"token": accessToken,
-	})
-	}
-
-func (cfg *ApiConfig) revoke(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	// Get the token
-	token, _ := auth.GetBearerToken(r.Header)
-	if token == "" {
-		respondWithError(w, http.StatusUnauthorized, "No token provided")
-		return
-	}
-
-	err := cfg.DBQueries.RevokeToken(ctx, token)
-	if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token")
-        return
-    }
-
-	// Set the status code to 204 No Content
-	w.WriteHeader(http.StatusNoContent)
-	// No need to write any body for 204
-}
-
-// Updates user email and password
-func (cfg *ApiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
-	// Assign context
-	ctx := context.Background()
-
-	// Define struct to take decoded body
-	type UpdateRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		}
-
-
-	// Get token
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "No token found")
-		return
-	}
-
-	// Need to get original email here, then compare it to the Request Email, if differnet
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Unable to get user details")
-			return
-		}
-	
-
-	
-
-	// Create an empty of above
-	var params UpdateRequest
-
-	// Decode the inputed JSON response to the memory
-	if err = json.NewDecoder(r.Body).Decode(&params); err != nil {
-		// Deal with any JSON decoding errors
-		respondWithError(w, http.StatusInternalServerError, "Unable to decode details")
-		return
-	}
-		
-	// take email and put it in variable to pass in
-	newEmail := params.Email
-	newPassword, err := auth.HashPassword(params.Password) 
-	if err != nil {
-		// Prints the error to the terminal
-		log.Println("Error hashing password")
-		respondWithError(w, http.StatusInternalServerError, "Unable to update password")
-		return
-	}
-
-
-
-	updateParams :=  database.UpdateUserParams {
-		ID:        userID,
-		Email:     newEmail,
-		HashedPassword: newPassword,
-	}
-
-	// pass in details to cfg.DBqueries.UpdateUser ($1 user,$2 email,$3 hashedPW)
-	err = cfg.DBQueries.UpdateUser(ctx, updateParams)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update user details")
-		return
-	}
-
-	//Struct for the JSON response ommitting the password hash
-	userReturn := User{
-		ID:        userID,
-		Email:     newEmail,
-	}
-
-	err = respondWithJSON(w, 200, userReturn)
-	if err != nil {
-		// Handle JSON encoding error
-		respondWithError(w, http.StatusInternalServerError, "Failed to encode JSON")
-		log.Printf("JSON encoding error: %s", err)
-		return
-	}
-
-}
-	// Deletes a chirp if the user is correct and Chirp ID provided
-func (cfg *ApiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
-
-	ctx := context.Background()
-
-	// Chirp ID comes from response body .id  - this retrieves it from the request and parses to UUID
-	idString := r.PathValue("chirpID")
-	chirpID, err:= uuid.Parse(idString)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to decode ChirpID")
-		return
-	}
-
-	
-	// Get the token first using JWT
-	// Get token
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "No token found")
-		return
-	}
-
-	// Need to get original email here, then compare it to the Request Email, if differnet
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Unable to get user details")
-			return
-		}
-	
-	// Get UserID of chirp creator
-	chirpUser, err := cfg.DBQueries.GetUserOfChirp(ctx, chirpID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to decode ChirpID user")
-		return
-	}
-
-	// Verify token UserID v Chirp UserID
-	if chirpUser != userID {
-		respondWithError(w, http.StatusForbidden, "Action not authorised")
-		return
-	}
-	// send delete request to db
-
-	err = cfg.DBQueries.DeleteChirp(ctx, chirpID) 
-	if err != nil {
-		respondWithError(w, http.StatusForbidden, "Action not authorised")
-		return
-	}
-
-	//err = respondWithJSON(w, 204, "")
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusNoContent)
-	w.Write([]byte("Chirp Deleted\n"))
-
-}
-
-
-// Accepts a notification from POLKA that payment has been made for Chirpy Red
-func (cfg *ApiConfig) chirpyRedUpgrade(w http.ResponseWriter, r *http.Request) {
-	
-	// Check the API key here
-	checkKey, err := GetAPIKey(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
-		return
-	}
-
-	if checkKey != cfg.polka {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect Key")
-		return
-	}
-
-	ctx := r.Context()
-
-	// Struct to take the Request body
-	type UserData struct {
-		UserID		string `json:"user_id"`
-	}
-
-	type webhookReturn struct {
-		Event		string `json:"event"`
-		Data		UserData `json:"data"`
-	}
-
-	// Decode the user data
-
-	var params webhookReturn
-
-	// Decode the inputed JSON response to the memory
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		// Deal with any JSON decoding errors
-		respondWithError(w, http.StatusUnauthorized, "Unable to decode details")
-		return
-	}
-
-	if params.Event != "user.upgraded" {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusNoContent)
-		return
-	}
-
-	userID, err := uuid.Parse(params.Data.UserID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "UserID not parsed correctly")
-		return
-	}
-
-	// Check if user exists
-	_, err = cfg.DBQueries.CheckUser(ctx, userID) 
-	if err != nil {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusNoContent)
-		return
-
-	}
-	
-
-	err = cfg.DBQueries.UpgradeToRed(ctx, userID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to upgrade to red")
-		return
-	}
-
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusNoContent)
-	return
-
-}
-
-
-
+package main
+
+import (
+	"net/http"
+	"fmt"
+	"encoding/json"
+	"log"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/audit"
+	"time"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+)
+
+
+func (cfg *ApiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
+	// Increments the fileserverHits
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Increment the counter using atomic32 add
+		cfg.fileserverHits.Add(1)
+		// pass next to ServerHTTP
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (cfg *ApiConfig) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	counter := cfg.fileserverHits.Load()
+
+	//HTML template for admin page
+	htmlTemplate := `<html>
+	<body>
+		<h1>Welcome, Chirpy Admin</h1>
+		<p>Chirpy has been visited %d times!</p>
+	</body>
+	</html>`
+
+	// Format the above template with the counter in the %d spot
+	htmlContent := fmt.Sprintf(htmlTemplate, counter)
+
+	// Sets the header type to HTML
+	w.Header().Set("Content-Type", "text/html")
+
+	// Write the html to the response
+	fmt.Fprint(w, htmlContent)
+}
+
+func (cfg *ApiConfig) metricsResetHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Wipes every user, so even admins can only do it in development
+	if cfg.platform != "dev" {
+		respondWithError(w, http.StatusForbidden, "This endpoint only avaliable in development mode")
+		return
+	}
+
+	// Calls the SQLC genereated function to delete all users
+	err := cfg.DBQueries.DeleteAllUsers(r.Context())
+	if err != nil {
+		log.Printf("Error deleting users: %s", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"Failed to reset database"}`))
+		return
+	}
+
+	hits := cfg.fileserverHits.Swap(0)
+
+	adminID, _, _ := cfg.staffUser(r)
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditReset,
+		ActorID:    actor(adminID),
+		TargetType: "database",
+		Metadata:   map[string]any{"before": map[string]any{"hits": hits}},
+	})
+
+	w.WriteHeader(http.StatusOK) // Status  200
+	w.Write([]byte("Counter Reset\n"))
+}
+
+// Function to add a new user to the database by email - uses SQL query from SQLC
+
+func (cfg *ApiConfig) addUser(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	type createUserRequest struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Username string `json:"username"`
+	}
+
+	var params createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		errResp := errorResponse{
+			Error: "Invalid request body: " + err.Error(),
+		}
+
+		jsonResp, err := json.Marshal(errResp)
+		if err != nil {
+			log.Printf("Error marshalling JSON: %s", err)
+			w.WriteHeader(http.StatusInternalServerError) // Status 500
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest) // 400 for client errors
+		w.Write(jsonResp)
+		return
+	}
+
+	email, err := validateEmail(params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Username is optional, but has to be valid if it's there
+	var username sql.NullString
+	if params.Username != "" {
+		name, err := normaliseUsername(params.Username)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		username = sql.NullString{String: name, Valid: true}
+	}
+
+	err = cfg.passwordPolicy.Check(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Logic to hash the password and return it to upload to the database 
+
+	hash, err := auth.HashPassword(params.Password)
+	if err != nil {
+		// Prints the error to the terminal
+		log.Println("Error hashing password")
+		// Creates the error to respond with
+		errResp := errorResponse{
+			Error: "Error creating user password: " + err.Error(),
+		}
+
+		err = respondWithJSON(w, 500, errResp)
+		if err != nil {
+			// Handle JSON encoding error
+			http.Error(w, "Failed to encode password", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %s", err)
+			return
+		}
+		return
+	}
+
+	// Create a CreateUserParams struct
+	createParams := database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hash,
+		Username:       username,
+}
+
+	dbUser, err := cfg.DBQueries.CreateUser(r.Context(), createParams)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_username_key" {
+			respondWithError(w, http.StatusConflict, "Username is already taken")
+			return
+		}
+
+		log.Println("Error mapping to database")
+
+		errResp := errorResponse{
+			Error: "Error creating user: " + err.Error(),
+		}
+
+		jsonResp, err := json.Marshal(errResp)
+		if err != nil {
+			log.Printf("Error marshalling JSON: %s", err)
+			w.WriteHeader(http.StatusInternalServerError) // Status 500
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError) // Status 500
+		w.Write(jsonResp)
+		return
+	}
+
+	chirpyRed, err := cfg.DBQueries.IsChirpyRed(ctx, dbUser.ID)
+	if err != nil {
+		log.Printf("Error getting user Red stauts: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// The account is made either way, they can ask for another email later
+	err = cfg.sendEmailToken(ctx, dbUser.ID, dbUser.Email, emailPurposeVerify)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err)
+	}
+
+	// Do not include a password hash or field here!
+	user := User{
+		ID:        dbUser.ID,
+		CreatedAt: dbUser.CreatedAt,
+		UpdatedAt: dbUser.UpdatedAt,
+		Email:     dbUser.Email,
+		IsChirpyRed: chirpyRed.Valid && chirpyRed.Bool,
+		Username:  dbUser.Username.String,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		}
+
+	userJSON, err := json.Marshal(user)
+	if err != nil {
+		log.Printf("Error marshalling user: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Successful response - returns the userJSON marshalled
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated) // 201 for resource creation
+	w.Write(userJSON)
+
+}
+
+func (cfg *ApiConfig) newChirp(w http.ResponseWriter, r *http.Request) {
+
+	type Chirp_Input struct {
+		Body      string     `json:"body"`
+		User_id   string     `json:"user_id"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
+		RechirpOf *uuid.UUID `json:"rechirp_of"`
+		QuoteOf   *uuid.UUID `json:"quote_of"`
+	}
+
+	userUUID, err := cfg.authenticatedUser(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	if !cfg.requireVerifiedEmail(w, r, userUUID, restrictChirp) {
+		return
+	}
+
+
+	// Created an empty Chirp struct
+	var params Chirp_Input
+
+	// Decode the JSON input and assign it to the Chirp_input struct
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		errResp := errorResponse{
+			Error: "Invalid request body: " + err.Error(),
+		}
+
+		jsonResp, err := json.Marshal(errResp)
+		if err != nil {
+			log.Printf("Error marshalling JSON: %s", err)
+			w.WriteHeader(http.StatusInternalServerError) // Status 500
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest) // 400 for client errors
+		w.Write(jsonResp)
+		return
+	}
+
+	// A rechirp is just a pointer at another chirp, a quote adds its own body
+	kind := chirpKindChirp
+	var referenceOf *uuid.UUID
+	switch {
+	case params.RechirpOf != nil && params.QuoteOf != nil:
+		respondWithError(w, http.StatusBadRequest, "A chirp can't be both a rechirp and a quote")
+		return
+	case params.RechirpOf != nil:
+		if params.Body != "" || params.InReplyTo != nil {
+			respondWithError(w, http.StatusBadRequest, "Rechirps can't have a body or be a reply")
+			return
+		}
+		kind = chirpKindRechirp
+		referenceOf = params.RechirpOf
+	case params.QuoteOf != nil:
+		if params.Body == "" {
+			respondWithError(w, http.StatusBadRequest, "Quote chirps need a body")
+			return
+		}
+		kind = chirpKindQuote
+		referenceOf = params.QuoteOf
+	}
+
+	// Checks the length of the chirp
+	if len(params.Body) > 140 {
+		errResp := errorResponse{
+			Error: "Chirp is too long",
+		}
+
+		jsonResp, err := json.Marshal(errResp)
+		if err != nil {
+			log.Printf("Error marshalling JSON %s", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest) // Status 400
+			w.Write(jsonResp)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest) // Status 400
+		w.Write(jsonResp)
+		return
+	}
+
+	// Mask, reject or flag anything that matches the moderation rules
+	moderated := cfg.moderation.Check(params.Body)
+	if moderated.Rejected() {
+		respondWithError(w, http.StatusBadRequest, "Chirp contains words that aren't allowed")
+		return
+	}
+
+	// Create the NewChirpParams struct
+	chirpParams := database.NewChirpParams{
+		Body:   moderated.Text,
+		UserID: userUUID,
+		Kind:   kind,
+	}
+
+	if referenceOf != nil {
+		referenceID, err := cfg.resolveReference(r.Context(), *referenceOf)
+		if err != nil {
+			if errors.Is(err, errReferenceNotFound) {
+				respondWithError(w, http.StatusNotFound, "Chirp being referenced not found")
+				return
+			}
+			log.Printf("Error finding referenced chirp: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Error creating new chirp")
+			return
+		}
+		chirpParams.ReferenceID = uuid.NullUUID{UUID: referenceID, Valid: true}
+	}
+
+	// Replies point at their parent and carry the id of the chirp that started the thread
+	if params.InReplyTo != nil {
+		parent, err := cfg.DBQueries.GetChirp(r.Context(), *params.InReplyTo)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondWithError(w, http.StatusNotFound, "Chirp being replied to not found")
+				return
+			}
+			log.Printf("Error finding parent chirp: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Error creating new chirp")
+			return
+		}
+
+		if parent.DeletedAt.Valid || parent.HiddenAt.Valid {
+			respondWithError(w, http.StatusBadRequest, "Can't reply to a deleted chirp")
+			return
+		}
+
+		chirpParams.InReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		chirpParams.ThreadRootID = parent.ThreadRootID
+		if !parent.ThreadRootID.Valid {
+			chirpParams.ThreadRootID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		}
+	}
+
+	// Run the newChirp query? and deal with any errors
+	// Sends through the JSON input to the query as args
+
+	dbChirp, err := cfg.DBQueries.NewChirp(r.Context(), chirpParams)
+	if err != nil {
+		// Each user can only rechirp a chirp once
+		var pqErr *pq.Error
+		if kind == chirpKindRechirp && errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			respondWithError(w, http.StatusConflict, "You've already rechirped this chirp")
+			return
+		}
+
+		log.Printf("Error mapping to chirp database: %v", err)
+
+		errResp := errorResponse{
+			Error: "Error creating new chirp: " + err.Error(),
+		}
+
+		err = respondWithJSON(w, 500, errResp)
+		if err != nil {
+			// Handle JSON encoding error
+			http.Error(w, "Failed to encode chirps", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %s", err)
+			return
+		}
+		return
+	}
+	
+
+	// The chirp is already saved, so a failure here shouldn't fail the request
+	cfg.flagChirp(r.Context(), dbChirp, moderated)
+
+	// A shadow banned author's chirps only exist for them, so nothing is
+	// tagged, nobody is mentioned and nobody is told about it
+	if !cfg.authorHidden(r.Context(), userUUID) {
+		err = cfg.syncHashtags(r.Context(), dbChirp.ID, dbChirp.Body)
+		if err != nil {
+			log.Printf("Error saving hashtags: %v", err)
+		}
+
+		err = cfg.syncMentions(r.Context(), dbChirp.ID, dbChirp.Body)
+		if err != nil {
+			log.Printf("Error saving mentions: %v", err)
+		}
+
+		// Lets anyone replied to, rechirped, quoted or mentioned know about it
+		cfg.events.publish(r.Context(), event{
+			Kind:    eventChirpCreated,
+			ActorID: userUUID,
+			ChirpID: uuid.NullUUID{UUID: dbChirp.ID, Valid: true},
+		})
+	}
+
+	new_Chirp := chirpFromDB(dbChirp)
+
+	err = cfg.decorateChirps(r.Context(), uuid.NullUUID{UUID: userUUID, Valid: true}, &new_Chirp)
+	if err != nil {
+		log.Printf("Error loading chirp details: %v", err)
+	}
+
+	// Testing respondWithJSON
+
+	err = respondWithJSON(w, 201, new_Chirp)
+	if err != nil {
+		// Handle JSON encoding error
+		http.Error(w, "Failed to encode chirps", http.StatusInternalServerError)
+		log.Printf("JSON encoding error: %s", err)
+		return
+	}
+}
+
+// This is the handler function that calls on the DB query to get all the chirps
+// This function only creates the JSON response and encodes it, it then returns
+// The HTTP responses and JSON
+
+func (cfg *ApiConfig) handleGetChirps(w http.ResponseWriter, r *http.Request) {
+	// Use the request's context for the query
+	ctx := r.Context()
+
+	// limit, cursor and sort all come from the query string
+	page, err := parseSortedPageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// See if there is an author ID in the query
+	// if so, only page through the chirps from that author
+	var authorID uuid.NullUUID
+	if s := r.URL.Query().Get("author_id"); s != "" {
+		author, err := uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID format")
+			return
+		}
+		authorID = uuid.NullUUID{UUID: author, Valid: true}
+	}
+
+	// Shadow banned users still see their own chirps
+	viewer := cfg.optionalUser(r)
+
+	chirps, err := cfg.listChirps(ctx, authorID, viewer, page)
+	if err != nil {
+		// If an error occurred, respond with 500 Internal Server Error
+		http.Error(w, "Failed to fetch chirps", http.StatusInternalServerError)
+		log.Printf("Database error: %s", err)
+		return
+	}
+
+	// like_count always, liked_by_me if there's a logged in user
+	err = cfg.decorateChirpSlice(ctx, viewer, chirps.Chirps)
+	if err != nil {
+		http.Error(w, "Failed to fetch chirps", http.StatusInternalServerError)
+		log.Printf("Database error: %s", err)
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, chirps)
+	if err != nil {
+		// Handle JSON encoding error
+		http.Error(w, "Failed to encode chirps", http.StatusInternalServerError)
+		log.Printf("JSON encoding error: %s", err)
+		return
+	}
+
+}
+
+// Returns a single chirp by using the UUID of the chirp
+// http.Request.PathValue used in here to do something with a string
+
+func (cfg *ApiConfig) getChirp(w http.ResponseWriter, r *http.Request) {
+
+	// Ok something here about using the UUID to do a query on the DB?
+	// Don't forget context...
+	idString := r.PathValue("chirpID")
+	chirpToGet, err:= uuid.Parse(idString)
+	if err != nil {
+		
+		errResp := errorResponse{
+			Error: "Invalid Chirp ID format",
+		}
+		http.Error(w, "Failed to encode UUID for chirp", http.StatusInternalServerError)
+		log.Printf("JSON encoding error: %s", errResp)
+		return
+	}
+	// maybe assign variable here for the chirp ID?
+
+
+	dbChirp, err := cfg.DBQueries.GetChirp(r.Context(), chirpToGet)
+	if err != nil {
+
+		if errors.Is(err, sql.ErrNoRows) {
+			// Chirp not found, return 404
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Printf("Error finding chirp in database: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Error finding chirp")
+		return
+	}
+
+	// Chirps by shadow banned users are only there for their author
+	viewer := cfg.optionalUser(r)
+	visible, err := cfg.canSeeChirpsBy(r.Context(), dbChirp.UserID, viewer)
+	if err != nil {
+		log.Printf("Error checking chirp author: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Error finding chirp")
+		return
+	}
+	if !visible {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return
+	}
+
+	new_Chirp := chirpFromDB(dbChirp)
+
+	err = cfg.decorateChirps(r.Context(), viewer, &new_Chirp)
+	if err != nil {
+		log.Printf("Error counting likes: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Error finding chirp")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, new_Chirp)
+	if err != nil {
+		// Handle JSON encoding error
+		http.Error(w, "Failed to encode chirps", http.StatusInternalServerError)
+		log.Printf("JSON encoding error: %s", err)
+		return
+	}
+
+}
+
+var errIncorrectLogin = errors.New("incorrect email or password")
+
+// Checks an email and password the same way for every kind of login, with
+// the lockouts and the same work whether or not the email has an account.
+// wait is how long to wait if they're locked out, otherwise err is
+// errIncorrectLogin if the details are wrong
+func (cfg *ApiConfig) checkCredentials(ctx context.Context, r *http.Request, email, password string) (database.User, time.Duration, error) {
+	// Too many wrong passwords for this email or from this address means waiting
+	if wait := cfg.loginLockoutWait(ctx, r, email); wait > 0 {
+		return database.User{}, wait, nil
+	}
+
+	dbUser, err := cfg.DBQueries.GetEmail(ctx, email)
+	if err != nil {
+		// Same work and same answer as a wrong password, so you can't tell
+		// from outside which emails have accounts
+		auth.CheckDummyPassword(password)
+		cfg.recordLoginFailure(r, email)
+		return database.User{}, 0, errIncorrectLogin
+	}
+
+	err = auth.CheckPasswordHash(dbUser.HashedPassword, password)
+	if err != nil {
+		cfg.recordLoginFailure(r, email)
+		return database.User{}, 0, errIncorrectLogin
+	}
+
+	cfg.recordLoginSuccess(ctx, r, email)
+
+	// Old bcrypt hashes (or weaker argon2id settings) get upgraded now we know the password
+	cfg.upgradePasswordHash(ctx, dbUser, password)
+
+	return dbUser, 0, nil
+}
+
+func (cfg *ApiConfig) login(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	// Define a struct to take the JSON input
+	type LoginRequest struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		DeviceLabel string `json:"device_label"`
+		//ExpiresInSeconds *int    `json:"expires_in_seconds"`
+	}
+
+	// Create an empty of above
+	var params LoginRequest
+	// Decode the inputed JSON response to the memory
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		// Deal with any JSON decoding errors
+		errResp := errorResponse{
+			Error: "Invalid request body: " + err.Error(),
+		}
+		// Respond using the helper function
+		errJ := respondWithJSON(w, 500, errResp)
+		if errJ != nil {
+			// Handle JSON encoding error
+			respondWithError(w, http.StatusInternalServerError, "Failed to encode JSON")
+			log.Printf("JSON encoding error: %s", err)
+		}
+		return
+	}
+
+	dbUser, wait, err := cfg.checkCredentials(ctx, r, params.Email, params.Password)
+	if wait > 0 {
+		respondLockedOut(w, wait)
+		return
+	}
+	if err != nil {
+		errResp := errorResponse{
+			Error: "Incorrect email or password",
+		}
+		errJ := respondWithJSON(w, 401, errResp)
+		if errJ != nil {
+			// Handle JSON encoding error
+			respondWithError(w, http.StatusInternalServerError, "Failed to encode JSON")
+			log.Printf("JSON encoding error: %s", errJ)
+		}
+		return
+	}
+
+	// With 2FA on the password isn't enough, the client gets a challenge
+	// token to send to /api/login/mfa along with a code
+	enabled, err := cfg.twoFactorEnabled(ctx, dbUser.ID)
+	if err != nil {
+		log.Printf("Error checking 2FA: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to log in")
+		return
+	}
+
+	if enabled {
+		cfg.sendMFAChallenge(w, dbUser.ID)
+		return
+	}
+
+	cfg.completeLogin(w, r, dbUser, params.DeviceLabel)
+}
+
+// Starts a new session and responds with the user and their tokens
+func (cfg *ApiConfig) completeLogin(w http.ResponseWriter, r *http.Request, dbUser database.User, deviceLabel string) {
+
+	ctx := r.Context()
+
+	// Suspended and deactivated users keep their password but can't sign in
+	err := userStateError(dbUser.Status, dbUser.SuspendedUntil)
+	if err != nil {
+		cfg.recordAudit(r, audit.Event{
+			Action:   auditLoginFailure,
+			ActorID:  actor(dbUser.ID),
+			Metadata: map[string]any{"reason": dbUser.Status},
+		})
+		respondWithAuthError(w, err, "Unable to log in")
+		return
+	}
+
+	expiration := time.Hour
+
+	chirpyRed, err := cfg.DBQueries.IsChirpyRed(ctx, dbUser.ID)
+	if err != nil {
+		log.Printf("Error getting user Red stauts: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+
+	// Assign the user information to be returned on successful password
+	user := User{
+		ID:        dbUser.ID,
+		CreatedAt: dbUser.CreatedAt,
+		UpdatedAt: dbUser.UpdatedAt,
+		Email:     dbUser.Email,
+		IsChirpyRed: chirpyRed.Valid && chirpyRed.Bool,
+		Username:  dbUser.Username.String,
+		EmailVerified: dbUser.EmailVerifiedAt.Valid,
+		Role: dbUser.Role,
+		}
+
+	// Each login is its own session so it can be signed out on its own
+	session, err := cfg.startSession(r, dbUser.ID, deviceLabel)
+	if err != nil {
+		log.Printf("Error starting session: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to start session")
+		return
+	}
+
+	// After validating user credentials
+	tokenString, err := cfg.jwtKeys.MakeSessionJWT(user.ID, session.ID, dbUser.Role, expiration) // Use your expiration value here
+	if err != nil {
+		// Handle the error, perhaps return a 500
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	user.Token = tokenString
+
+	user.Refresh_Token, err = auth.MakeRefreshToken() // return the refresh_token here
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	// The session is the token family, refreshing keeps it going
+	err = auth.SaveRefreshToken(user.Refresh_Token, dbUser.ID, session.ID, *cfg.DBQueries)
+	if err != nil {
+		log.Print("Error saving refresh token")
+		respondWithError(w, http.StatusInternalServerError, "Failed to save token")
+		return
+	}
+
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditLoginSuccess,
+		ActorID:    actor(dbUser.ID),
+		TargetType: "session",
+		TargetID:   session.ID.String(),
+		Metadata:   map[string]any{"device": session.DeviceLabel},
+	})
+	
+	// Encode the response and return the results
+	err = respondWithJSON(w, 200, user)
+	if err != nil {
+		// Handle JSON encoding error
+		respondWithError(w, http.StatusInternalServerError, "Failed to encode JSON")
+		log.Printf("JSON encoding error: %s", err)
+		return
+	}
+	
+}
+
+// requires a refresh token to be present in the headers
+// Each refresh token only works once, it's swapped for a new one in the same family
+func (cfg *ApiConfig) refresh(w http.ResponseWriter, r *http.Request) {
+	token, _ := auth.GetBearerToken(r.Header)
+	if token == "" {
+		respondWithError(w, http.StatusUnauthorized, "No token provided")
+		return
+	}
+
+	newToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token")
+		return
+	}
+
+	// Revokes the old token and saves the new one in one go, so the same
+	// token can't be swapped twice by two requests at once
+	rotated, err := cfg.DBQueries.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		Token:    token,
+		NewToken: newToken,
+	})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error rotating refresh token: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Couldn't refresh token")
+			return
+		}
+		cfg.rejectRefreshToken(w, r, token)
+		return
+	}
+
+	err = cfg.DBQueries.TouchSession(r.Context(), database.TouchSessionParams{
+		ID:        rotated.FamilyID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+	})
+	if err != nil {
+		log.Printf("Error updating session: %s", err)
+	}
+
+	// Suspensions revoke sessions, this catches any refresh racing one
+	err = cfg.checkUserState(r.Context(), rotated.UserID)
+	if err != nil {
+		respondWithAuthError(w, err, "Couldn't refresh token")
+		return
+	}
+
+	// Role is looked up again so changes show up in the new token
+	role, err := cfg.DBQueries.GetUserRole(r.Context(), rotated.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token")
+		return
+	}
+
+	// Generate a new access token for the user
+	accessToken, err := cfg.jwtKeys.MakeSessionJWT(rotated.UserID, rotated.FamilyID, role, time.Hour)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token")
+		return
+	}
+
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditRefresh,
+		ActorID:    actor(rotated.UserID),
+		TargetType: "session",
+		TargetID:   rotated.FamilyID.String(),
+	})
+
+	// Respond with the new access token and the refresh token to use next time
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"token":         accessToken,
+		"refresh_token": newToken,
+	})
+}
+
+// Works out why a refresh token couldn't be rotated and responds
+func (cfg *ApiConfig) rejectRefreshToken(w http.ResponseWriter, r *http.Request, token string) {
+	reason := cfg.refreshTokenFailure(r.Context(), token, uuid.NullUUID{})
+	cfg.recordAudit(r, audit.Event{
+		Action:   auditRefreshFailure,
+		Metadata: map[string]any{"reason": reason},
+	})
+	respondWithError(w, http.StatusUnauthorized, reason)
+}
+
+// Returns why a refresh token couldn't be rotated, clientID is the OAuth app
+// it should belong to (none for normal logins)
+// A revoked token being used again means it's probably been stolen,
+// so every token in its family is revoked
+func (cfg *ApiConfig) refreshTokenFailure(ctx context.Context, token string, clientID uuid.NullUUID) string {
+	rows, err := cfg.DBQueries.GetUserFromRefreshToken(ctx, token)
+	if err != nil || len(rows) == 0 {
+		return "Invalid token"
+	}
+
+	tokenInfo := rows[0]
+
+	session, err := cfg.DBQueries.GetSession(ctx, tokenInfo.FamilyID)
+	if err == nil && session.ClientID != clientID {
+		return "Invalid token"
+	}
+
+	// Signed out on purpose, nothing suspicious about that
+	if err == nil && session.RevokedAt.Valid {
+		return "Session revoked"
+	}
+
+	if tokenInfo.RevokedAt.Valid {
+		err = cfg.DBQueries.RevokeTokenFamily(ctx, tokenInfo.FamilyID)
+		if err != nil {
+			log.Printf("Error revoking refresh token family %s: %s", tokenInfo.FamilyID, err)
+		}
+
+		log.Printf("SECURITY: revoked refresh token reused for user %s, revoked token family %s", tokenInfo.UserID, tokenInfo.FamilyID)
+		cfg.events.publish(ctx, event{
+			Kind:    eventRefreshTokenReuse,
+			ActorID: tokenInfo.UserID,
+		})
+
+		return "Token revoked"
+	}
+
+	return "Token expired"
+}
+
+func (cfg *ApiConfig) revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	// Get the token
+	token, _ := auth.GetBearerToken(r.Header)
+	if token == "" {
+		respondWithError(w, http.StatusUnauthorized, "No token provided")
+		return
+	}
+
+	// Revoking a refresh token signs out the whole session it belongs to
+	rows, err := cfg.DBQueries.GetUserFromRefreshToken(ctx, token)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token")
+		return
+	}
+
+	for _, tokenInfo := range rows {
+		err = cfg.DBQueries.RevokeTokenFamily(ctx, tokenInfo.FamilyID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't revoke token")
+			return
+		}
+
+		cfg.recordAudit(r, audit.Event{
+			Action:     auditRevoke,
+			ActorID:    actor(tokenInfo.UserID),
+			TargetType: "session",
+			TargetID:   tokenInfo.FamilyID.String(),
+		})
+	}
+
+	// Set the status code to 204 No Content
+	w.WriteHeader(http.StatusNoContent)
+	// No need to write any body for 204
+}
+
+// Updates user email and password
+func (cfg *ApiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
+	// Assign context
+	ctx := context.Background()
+
+	// Define struct to take decoded body
+	type UpdateRequest struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Username string `json:"username"`
+		}
+
+
+	// Need to get original email here, then compare it to the Request Email, if differnet
+	// This replaces the email and password, so only a login can do it, never
+	// a personal access token or an app
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+		if err != nil {
+			respondWithAuthError(w, err, "Unable to get user details")
+			return
+		}
+	
+
+	
+
+	// Create an empty of above
+	var params UpdateRequest
+
+	// Decode the inputed JSON response to the memory
+	if err = json.NewDecoder(r.Body).Decode(&params); err != nil {
+		// Deal with any JSON decoding errors
+		respondWithError(w, http.StatusInternalServerError, "Unable to decode details")
+		return
+	}
+		
+	// take email and put it in variable to pass in
+	newEmail, err := validateEmail(params.Email)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// A new address has to be verified again
+	dbUser, err := cfg.DBQueries.GetUser(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get user details")
+		return
+	}
+	oldEmail := dbUser.Email
+
+	err = cfg.passwordPolicy.Check(params.Password)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Sending the same password again keeps the hash it already has
+	newPassword := dbUser.HashedPassword
+	passwordChanged := auth.CheckPasswordHash(dbUser.HashedPassword, params.Password) != nil
+	if passwordChanged {
+		newPassword, err = auth.HashPassword(params.Password)
+		if err != nil {
+			// Prints the error to the terminal
+			log.Println("Error hashing password")
+			respondWithError(w, http.StatusInternalServerError, "Unable to update password")
+			return
+		}
+	}
+
+
+
+	updateParams :=  database.UpdateUserParams {
+		ID:        userID,
+		Email:     newEmail,
+		HashedPassword: newPassword,
+	}
+
+	// Username only changes if one was sent
+	var newUsername string
+	if params.Username != "" {
+		newUsername, err = normaliseUsername(params.Username)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// Everything is saved together, so a taken username doesn't leave the
+	// new email and password behind
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to update user details")
+		return
+	}
+	defer tx.Rollback()
+	q := database.New(tx)
+
+	// pass in details to cfg.DBqueries.UpdateUser ($1 user,$2 email,$3 hashedPW)
+	err = q.UpdateUser(ctx, updateParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to update user details")
+		return
+	}
+
+	if newUsername != "" {
+		err = q.SetUsername(ctx, database.SetUsernameParams{
+			ID:       userID,
+			Username: sql.NullString{String: newUsername, Valid: true},
+		})
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+				respondWithError(w, http.StatusConflict, "Username is already taken")
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "Unable to update username")
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to update user details")
+		return
+	}
+
+	if passwordChanged {
+		cfg.recordAudit(r, audit.Event{
+			Action:     auditPasswordChanged,
+			ActorID:    actor(userID),
+			TargetType: "user",
+			TargetID:   userID.String(),
+		})
+	}
+
+	if newEmail != oldEmail {
+		cfg.recordAudit(r, audit.Event{
+			Action:     auditEmailChanged,
+			ActorID:    actor(userID),
+			TargetType: "user",
+			TargetID:   userID.String(),
+			Metadata:   map[string]any{"old_email": oldEmail, "new_email": newEmail},
+		})
+
+		err = cfg.sendEmailToken(ctx, userID, newEmail, emailPurposeVerify)
+		if err != nil {
+			log.Printf("Error sending verification email: %s", err)
+		}
+	}
+
+	//Struct for the JSON response ommitting the password hash
+	userReturn := User{
+		ID:        userID,
+		Email:     newEmail,
+		Username:  newUsername,
+	}
+
+	err = respondWithJSON(w, 200, userReturn)
+	if err != nil {
+		// Handle JSON encoding error
+		respondWithError(w, http.StatusInternalServerError, "Failed to encode JSON")
+		log.Printf("JSON encoding error: %s", err)
+		return
+	}
+
+}
+	// Deletes a chirp if the user is correct and Chirp ID provided
+func (cfg *ApiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	// Chirp ID comes from response body .id  - this retrieves it from the request and parses to UUID
+	idString := r.PathValue("chirpID")
+	chirpID, err:= uuid.Parse(idString)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to decode ChirpID")
+		return
+	}
+
+	
+	// Get the user from the token
+	userID, err := cfg.authenticatedUser(r, auth.ScopeChirpsWrite)
+		if err != nil {
+			respondWithAuthError(w, err, "Unable to get user details")
+			return
+		}
+	
+	// Get UserID of chirp creator
+	chirpUser, err := cfg.DBQueries.GetUserOfChirp(ctx, chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to decode ChirpID user")
+		return
+	}
+
+	// Verify token UserID v Chirp UserID
+	if chirpUser != userID {
+		respondWithError(w, http.StatusForbidden, "Action not authorised")
+		return
+	}
+	// send delete request to db
+	// this only removes the row when nobody has replied to it
+
+	err = removeChirp(ctx, cfg.DBQueries, chirpID)
+	if err != nil {
+		log.Printf("Error deleting chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to delete chirp")
+		return
+	}
+
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditChirpDeleted,
+		ActorID:    actor(userID),
+		TargetType: "chirp",
+		TargetID:   chirpID.String(),
+	})
+
+	//err = respondWithJSON(w, 204, "")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNoContent)
+	w.Write([]byte("Chirp Deleted\n"))
+
+}
+
+// Deletes a chirp, or keeps it as a tombstone if it has replies so the
+// thread doesn't fall apart
+func removeChirp(ctx context.Context, q *database.Queries, chirpID uuid.UUID) error {
+	deleted, err := q.DeleteChirp(ctx, chirpID)
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return q.TombstoneChirp(ctx, chirpID)
+	}
+	return nil
+}
+
+// Accepts a notification from POLKA that payment has been made for Chirpy Red
+func (cfg *ApiConfig) chirpyRedUpgrade(w http.ResponseWriter, r *http.Request) {
+	
+	// Check the API key here
+	checkKey, err := GetAPIKey(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if checkKey != cfg.polka {
+		respondWithError(w, http.StatusUnauthorized, "Incorrect Key")
+		return
+	}
+
+	ctx := r.Context()
+
+	// Struct to take the Request body
+	type UserData struct {
+		UserID		string `json:"user_id"`
+	}
+
+	type webhookReturn struct {
+		Event		string `json:"event"`
+		Data		UserData `json:"data"`
+	}
+
+	// Decode the user data
+
+	var params webhookReturn
+
+	// Decode the inputed JSON response to the memory
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		// Deal with any JSON decoding errors
+		respondWithError(w, http.StatusUnauthorized, "Unable to decode details")
+		return
+	}
+
+	if params.Event != "user.upgraded" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	userID, err := uuid.Parse(params.Data.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "UserID not parsed correctly")
+		return
+	}
+
+	// Check if user exists
+	_, err = cfg.DBQueries.CheckUser(ctx, userID) 
+	if err != nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	}
+	
+
+	err = cfg.DBQueries.UpgradeToRed(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to upgrade to red")
+		return
+	}
+
+	// Polka made the change, so there's no actor
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditChirpyRed,
+		TargetType: "user",
+		TargetID:   userID.String(),
+		Metadata:   map[string]any{"event": params.Event},
+	})
+
+	cfg.events.publish(ctx, event{Kind: eventChirpyRed, ActorID: userID})
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNoContent)
+	return
+
+}
+
+
+
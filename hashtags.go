@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Longest hashtag we store, anything after this is cut off
+const maxHashtagLength = 50
+
+// Defaults for the trending calculation
+const (
+	defaultTrendingWindow   = 24 * time.Hour
+	defaultTrendingHalfLife = 6 * time.Hour
+	defaultTrendingLimit    = 10
+)
+
+type trendingHashtag struct {
+	Tag   string  `json:"tag"`
+	Uses  int64   `json:"uses"`
+	Score float64 `json:"score"`
+}
+
+type trendingResponse struct {
+	Hashtags []trendingHashtag `json:"hashtags"`
+}
+
+// Pulls the #hashtags out of a chirp body, lower cased with duplicates removed
+// A tag is letters, digits and underscores and has to start at a word boundary,
+// so "a#b" isn't a tag and "#go!" is just "go"
+func extractHashtags(body string) []string {
+	var tags []string
+	seen := map[string]bool{}
+
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' || (i > 0 && isHashtagRune(runes[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isHashtagRune(runes[end]) {
+			end++
+		}
+
+		tag := normaliseHashtag(string(runes[i+1 : end]))
+		i = end - 1
+
+		// All digits is a number (#1), not a tag
+		if tag == "" || strings.IndexFunc(tag, unicode.IsLetter) < 0 || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+func isHashtagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Hashtags are matched case insensitively, so #Go and #go are the same page
+func normaliseHashtag(tag string) string {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	if runes := []rune(tag); len(runes) > maxHashtagLength {
+		tag = string(runes[:maxHashtagLength])
+	}
+	return tag
+}
+
+// Stores the hashtags in a chirp body, replacing any it had before
+func (cfg *ApiConfig) syncHashtags(ctx context.Context, chirpID uuid.UUID, body string) error {
+	tags := extractHashtags(body)
+
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	q := database.New(tx)
+
+	// Tags the chirp still has keep the time they were first used, so
+	// editing a chirp doesn't bump its tags back up the trending list
+	err = q.UntagChirp(ctx, database.UntagChirpParams{
+		ChirpID: chirpID,
+		Keep:    tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(tags) > 0 {
+		err = q.TagChirp(ctx, database.TagChirpParams{
+			Tags:    tags,
+			ChirpID: chirpID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Chirps using a hashtag, newest first
+func (cfg *ApiConfig) getHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tag := normaliseHashtag(r.PathValue("tag"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid hashtag")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	viewer := cfg.optionalUser(r)
+	params := database.ListHashtagChirpsParams{
+		Tag:      tag,
+		ViewerID: viewer,
+		Limit:    int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	chirpsFromDB, err := cfg.DBQueries.ListHashtagChirps(ctx, params)
+	if err != nil {
+		log.Printf("Error listing hashtag chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+		return
+	}
+
+	chirps := newChirpPage(chirpsFromDB, page.Limit)
+	err = cfg.decorateChirpSlice(ctx, viewer, chirps.Chirps)
+	if err != nil {
+		log.Printf("Error loading chirp details: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch chirps")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, chirps)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// The hashtags used most in the recent window
+// Each use counts for less the older it is, halving every half_life,
+// so something picking up now beats something that peaked this morning
+
+func (cfg *ApiConfig) getTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	window := defaultTrendingWindow
+	halfLife := defaultTrendingHalfLife
+	limit := defaultTrendingLimit
+
+	if s := query.Get("window"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			respondWithError(w, http.StatusBadRequest, "window must be a positive duration, e.g. 24h")
+			return
+		}
+		window = d
+	}
+
+	if s := query.Get("half_life"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			respondWithError(w, http.StatusBadRequest, "half_life must be a positive duration, e.g. 6h")
+			return
+		}
+		halfLife = d
+	}
+
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			respondWithError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxPageLimit)
+	}
+
+	rows, err := cfg.DBQueries.TrendingHashtags(r.Context(), database.TrendingHashtagsParams{
+		HalfLifeSeconds: halfLife.Seconds(),
+		WindowSeconds:   window.Seconds(),
+		Limit:           int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error fetching trending hashtags: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch trending hashtags")
+		return
+	}
+
+	resp := trendingResponse{Hashtags: []trendingHashtag{}}
+	for _, row := range rows {
+		resp.Hashtags = append(resp.Hashtags, trendingHashtag{
+			Tag:   row.Tag,
+			Uses:  row.Uses,
+			Score: row.Score,
+		})
+	}
+
+	err = respondWithJSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
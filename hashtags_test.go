@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractHashtags(t *testing.T) {
+
+	// Tags are lower cased, de-duplicated and stop at punctuation
+	tags := extractHashtags("Loving #Go and #golang! #go again, #under_score.")
+	assert.Equal(t, []string{"go", "golang", "under_score"}, tags)
+
+	// A # in the middle of a word, on its own, or before a number isn't a tag
+	assert.Empty(t, extractHashtags("issue#12 is # not #1"))
+}
@@ -1,135 +1,267 @@
-package main
-
-import (
-	"context"
-	"encoding/json"
-	"log"
-	"net/http"
-	"strings"
-	"errors"
-)
-
-func badWordReplacement(chirpy string) string {
-	//Struct for formating the JSON response
-	type cleanedBody struct {
-		CleanedBody string `json:"cleaned_body"`
-	}
-
-	// Assign params body to a variable so I can keep overwriting it (not sure if thats a good idea)
-	// not needed for this way - chirp := params.Body
-	chirp := strings.Split(chirpy, " ")
-	for i := 0; i < len(chirp); i++ {
-		if strings.ToLower(chirp[i]) == "kerfuffle" {
-			chirp[i] = "****"
-		} else if strings.ToLower(chirp[i]) == "sharbert" {
-			chirp[i] = "****"
-		} else if strings.ToLower(chirp[i]) == "fornax" {
-			chirp[i] = "****"
-		} else {
-			continue
-		}
-	}
-
-	// Joins the array back together
-	modifiedChirp := strings.Join(chirp, " ")
-
-	return modifiedChirp
-
-	// Assign the cleaned chirp to the struct for JSON marshalling
-	//cleanedChirp := cleanedBody{
-	//	CleanedBody: modifiedChirp,
-	//}
-
-	// Marshal the response into JSON and check it works
-	//jsonResp, err := json.Marshal(cleanedChirp)
-	//if err != nil {
-	//	log.Printf("Error marshalling JSON %s", err)
-	//	return nil
-	//}
-	//return jsonResp
-}
-
-// Returns all chirps in order by created_at
-// This is then called by the handler function to create the response
-
-func (cfg *ApiConfig) getChirps(ctx context.Context) ([]Chirp, error) {
-
-	// Fetch chirps from the database
-	chirpsFromDB, err := cfg.DBQueries.GetChirps(ctx)
-	if err != nil {
-		log.Print("Failed to fetch chirps")
-		return nil, err
-	}
-
-	// Transform the results if necessary
-	chirpsResponse := []Chirp{}
-	for _, chirp := range chirpsFromDB {
-		chirpsResponse = append(chirpsResponse, Chirp{
-			ID:        chirp.ID,        // Assuming ID is a UUID and needs conversion
-			CreatedAt: chirp.CreatedAt, // Timestamp
-			UpdatedAt: chirp.UpdatedAt, // Timestamp
-			Body:      chirp.Body,      // The body of the chirp
-			User_ID:   chirp.UserID,    // Assuming UserID is a UUID
-		})
-
-		// Return the slice of chirps and nil error on success
-
-	}
-	return chirpsResponse, nil
-}
-
-// Helper function to handle all JSON encoding
-
-func respondWithJSON(w http.ResponseWriter, status int, data interface{}) error {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	err := json.NewEncoder(w).Encode(data)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func respondWithError(w http.ResponseWriter, status int, message string) {
-    type errorResponse struct {
-        Error string `json:"error"`
-    }
-    
-    response := errorResponse{
-        Error: message,
-    }
-    
-    w.Header().Set("Content-Type", "application/json")
-    w.WriteHeader(status)
-    json.NewEncoder(w).Encode(response)
-    // Note: We're not returning an error here since we can't do much with it anyway
-    // after we've already started writing the response
-}
-
-// Function to get API key from header
-
-func GetAPIKey(headers http.Header) (string, error) {
-	
-	// Gets the bearer token and does stuff with it
-	authHeader := headers.Get("Authorization")
-	
-	if authHeader == "" {
-		log.Print("Error: Authorization header is empty")
-		return "", errors.New("authorization header is missing")
-	}
-	
-	if !strings.HasPrefix(authHeader, "ApiKey ") {
-		log.Print("Error: Authorization header does not start with 'ApiKey '")
-		return "", errors.New("invalid authorization header format")
-	}
-
-	polkaKey := strings.TrimPrefix(authHeader, "ApiKey ")
-
-	if strings.TrimSpace(polkaKey) == "" {
-		log.Print("Error: Key is empty after trimming")
-		return "", errors.New("authorization token is empty")
-	}
-
-	return polkaKey, nil
-}
-
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"errors"
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Pulls the bearer token off the request and returns the user it was issued to
+// Personal access tokens and OAuth apps' tokens also work if they have the
+// scope, logins work for everything
+func (cfg *ApiConfig) authenticatedUser(r *http.Request, scope string) (uuid.UUID, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	var userID uuid.UUID
+	if auth.IsAccessToken(token) {
+		userID, err = cfg.accessTokenUser(r.Context(), token, scope)
+	} else {
+		userID, err = cfg.jwtUser(token, scope)
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// Suspended and deactivated users are turned away everywhere
+	err = cfg.checkUserState(r.Context(), userID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return userID, nil
+}
+
+// The user an access token JWT was issued to, OAuth apps' tokens need the scope
+func (cfg *ApiConfig) jwtUser(token, scope string) (uuid.UUID, error) {
+	claims, err := cfg.jwtKeys.AccessClaims(token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if claims.ClientID != "" && (scope == sessionOnly || !auth.HasScope(claims.Scopes(), scope)) {
+		return uuid.Nil, &scopeError{scope: scope}
+	}
+
+	return uuid.Parse(claims.Subject)
+}
+
+// 403 if the token was fine but isn't allowed to do this, otherwise 401 with msg
+func respondWithAuthError(w http.ResponseWriter, err error, msg string) {
+	var scopeErr *scopeError
+	if errors.As(err, &scopeErr) {
+		respondWithError(w, http.StatusForbidden, scopeErr.message())
+		return
+	}
+	var stateErr *accountStateError
+	if errors.As(err, &stateErr) {
+		respondWithError(w, http.StatusForbidden, stateErr.message())
+		return
+	}
+	respondWithError(w, http.StatusUnauthorized, msg)
+}
+
+// Returns the user behind the bearer token if there is a valid one
+// Public endpoints use this to personalise the response without requiring a login
+func (cfg *ApiConfig) optionalUser(r *http.Request) uuid.NullUUID {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.NullUUID{}
+	}
+
+	userID, err := cfg.authenticatedUser(r, auth.ScopeChirpsRead)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+
+	return uuid.NullUUID{UUID: userID, Valid: true}
+}
+
+// Fills in everything about a chirp that doesn't live on its own row,
+// every handler returning chirps should run them through here
+func (cfg *ApiConfig) decorateChirps(ctx context.Context, viewer uuid.NullUUID, chirps ...*Chirp) error {
+	err := cfg.addEmbeds(ctx, chirps...)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.hideChirpsFromHiddenUsers(ctx, viewer, chirps...)
+	if err != nil {
+		return err
+	}
+
+	// Embedded originals get their counts in the same queries as the rest
+	all := append([]*Chirp{}, chirps...)
+	for _, chirp := range chirps {
+		if chirp.Embedded != nil && chirp.Embedded.Chirp != nil {
+			all = append(all, chirp.Embedded.Chirp)
+		}
+	}
+
+	err = cfg.addMentions(ctx, all...)
+	if err != nil {
+		return err
+	}
+
+	return cfg.addLikeInfo(ctx, viewer, all...)
+}
+
+// Same as decorateChirps for a slice of chirps
+func (cfg *ApiConfig) decorateChirpSlice(ctx context.Context, viewer uuid.NullUUID, chirps []Chirp) error {
+	ptrs := make([]*Chirp, len(chirps))
+	for i := range chirps {
+		ptrs[i] = &chirps[i]
+	}
+	return cfg.decorateChirps(ctx, viewer, ptrs...)
+}
+
+// Converts a database chirp into the JSON shape returned by the API
+func chirpFromDB(chirp database.Chirp) Chirp {
+	c := Chirp{
+		ID:            chirp.ID,
+		CreatedAt:     chirp.CreatedAt,
+		UpdatedAt:     chirp.UpdatedAt,
+		Body:          chirp.Body,
+		User_ID:       chirp.UserID,
+		Kind:          chirp.Kind,
+		referenceID:   chirp.ReferenceID,
+		Edited:        chirp.RevisionCount > 0,
+		RevisionCount: chirp.RevisionCount,
+	}
+
+	if chirp.InReplyTo.Valid {
+		c.InReplyTo = &chirp.InReplyTo.UUID
+	}
+	if chirp.ThreadRootID.Valid {
+		c.ThreadRootID = &chirp.ThreadRootID.UUID
+	}
+
+	// Deleted chirps with replies stay in the thread as a tombstone, with no body or author
+	if chirp.DeletedAt.Valid {
+		c.Body = ""
+		c.User_ID = uuid.Nil
+		c.Deleted = true
+	}
+
+	// Chirps hidden by a moderator keep their place in threads the same way
+	if chirp.HiddenAt.Valid {
+		c.Body = ""
+		c.User_ID = uuid.Nil
+		c.Hidden = true
+	}
+
+	return c
+}
+
+// Returns one page of chirps, optionally only those from a single author
+// The ordering and the cursor are both applied in SQL, we ask for one extra
+// row so we know whether there is another page after this one
+
+func (cfg *ApiConfig) listChirps(ctx context.Context, authorID, viewer uuid.NullUUID, page pageParams) (chirpPage, error) {
+
+	var cursorCreatedAt sql.NullTime
+	var cursorID uuid.NullUUID
+	if page.Cursor != nil {
+		cursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	var chirpsFromDB []database.Chirp
+	var err error
+	if page.Desc {
+		chirpsFromDB, err = cfg.DBQueries.ListChirpsDesc(ctx, database.ListChirpsDescParams{
+			ViewerID:        viewer,
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           int32(page.Limit + 1),
+		})
+	} else {
+		chirpsFromDB, err = cfg.DBQueries.ListChirpsAsc(ctx, database.ListChirpsAscParams{
+			ViewerID:        viewer,
+			AuthorID:        authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			Limit:           int32(page.Limit + 1),
+		})
+	}
+	if err != nil {
+		log.Print("Failed to fetch chirps")
+		return chirpPage{}, err
+	}
+
+	return newChirpPage(chirpsFromDB, page.Limit), nil
+}
+
+// Helper function to handle all JSON encoding
+
+func respondWithJSON(w http.ResponseWriter, status int, data interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func respondWithError(w http.ResponseWriter, status int, message string) {
+    type errorResponse struct {
+        Error string `json:"error"`
+    }
+    
+    response := errorResponse{
+        Error: message,
+    }
+    
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(response)
+    // Note: We're not returning an error here since we can't do much with it anyway
+    // after we've already started writing the response
+}
+
+// Function to get API key from header
+
+func GetAPIKey(headers http.Header) (string, error) {
+	
+	// Gets the bearer token and does stuff with it
+	authHeader := headers.Get("Authorization")
+	
+	if authHeader == "" {
+		log.Print("Error: Authorization header is empty")
+		return "", errors.New("authorization header is missing")
+	}
+	
+	if !strings.HasPrefix(authHeader, "ApiKey ") {
+		log.Print("Error: Authorization header does not start with 'ApiKey '")
+		return "", errors.New("invalid authorization header format")
+	}
+
+	polkaKey := strings.TrimPrefix(authHeader, "ApiKey ")
+
+	if strings.TrimSpace(polkaKey) == "" {
+		log.Print("Error: Key is empty after trimming")
+		return "", errors.New("authorization token is empty")
+	}
+
+	return polkaKey, nil
+}
+
+
+// Serves the public signing keys as a JWKS document
+func (cfg *ApiConfig) getJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	err := respondWithJSON(w, http.StatusOK, cfg.jwtKeys.JWKS())
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
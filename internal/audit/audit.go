@@ -0,0 +1,108 @@
+// Package audit keeps an append-only log of security and admin events.
+// Each event's hash covers the hash of the one before it, so changing or
+// removing a row breaks the chain from that row onwards
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Something worth keeping a record of
+type Event struct {
+	// e.g. "auth.login.success", dots group actions so "auth" finds them all
+	Action  string
+	ActorID uuid.NullUUID
+	// What was acted on, e.g. "chirp" and its ID
+	TargetType string
+	TargetID   string
+	IP         string
+	RequestID  string
+	Metadata   map[string]any
+}
+
+// The prev_hash of the first event
+const genesisHash = ""
+
+// Encodes metadata the same way every time, keys sorted and numbers
+// written the same way Postgres hands them back from JSONB
+func canonicalMetadata(raw json.RawMessage) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return json.RawMessage("{}"), nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// The hash of an event and the hash before it. The ID isn't included as
+// the sequence can skip numbers when an insert is rolled back
+func Hash(e database.AuditEvent) (string, error) {
+	metadata, err := canonicalMetadata(e.Metadata)
+	if err != nil {
+		return "", err
+	}
+
+	actor := ""
+	if e.ActorID.Valid {
+		actor = e.ActorID.UUID.String()
+	}
+
+	// A JSON array so no field can run into the next one
+	data, err := json.Marshal([]any{
+		e.PrevHash,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		e.Action,
+		actor,
+		e.TargetType,
+		e.TargetID,
+		e.IpAddress,
+		e.RequestID,
+		metadata,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// An event that doesn't fit in the chain
+type ChainError struct {
+	ID     int64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit event %d: %s", e.ID, e.Reason)
+}
+
+// Checks events (oldest first) follow on from prev and haven't been
+// changed. Returns the last hash to carry on checking from, or a
+// *ChainError for the first event that's wrong
+func Verify(prev string, events []database.AuditEvent) (string, error) {
+	for _, e := range events {
+		if e.PrevHash != prev {
+			return prev, &ChainError{ID: e.ID, Reason: "doesn't follow on from the event before it"}
+		}
+
+		hash, err := Hash(e)
+		if err != nil {
+			return prev, &ChainError{ID: e.ID, Reason: "metadata isn't valid JSON"}
+		}
+		if hash != e.Hash {
+			return prev, &ChainError{ID: e.ID, Reason: "hash doesn't match its contents"}
+		}
+		prev = e.Hash
+	}
+	return prev, nil
+}
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Builds a chain of events the same way Record does
+func testChain(t *testing.T, n int) []database.AuditEvent {
+	t.Helper()
+	created := time.Date(2024, 1, 1, 12, 0, 0, 123456000, time.UTC)
+	prev := genesisHash
+	var events []database.AuditEvent
+	for i := 0; i < n; i++ {
+		e := database.AuditEvent{
+			ID:        int64(i + 1),
+			CreatedAt: created.Add(time.Duration(i) * time.Second),
+			Action:    "auth.login.success",
+			ActorID:   uuid.NullUUID{UUID: uuid.New(), Valid: true},
+			IpAddress: "10.0.0.1",
+			RequestID: "req-1",
+			Metadata:  json.RawMessage(`{"session_id":"abc","mfa":false}`),
+			PrevHash:  prev,
+		}
+		var err error
+		e.Hash, err = Hash(e)
+		require.NoError(t, err)
+		events = append(events, e)
+		prev = e.Hash
+	}
+	return events
+}
+
+func TestHashIgnoresMetadataFormatting(t *testing.T) {
+	e := testChain(t, 1)[0]
+
+	// How Postgres gives JSONB back, keys reordered with spaces added
+	e.Metadata = json.RawMessage(`{"mfa": false, "session_id": "abc"}`)
+	hash, err := Hash(e)
+	require.NoError(t, err)
+	assert.Equal(t, e.Hash, hash)
+
+	// The ID doesn't matter, the time zone of the same instant doesn't either
+	e.ID = 99
+	e.CreatedAt = e.CreatedAt.In(time.FixedZone("AEST", 10*60*60))
+	hash, err = Hash(e)
+	require.NoError(t, err)
+	assert.Equal(t, e.Hash, hash)
+}
+
+func TestVerify(t *testing.T) {
+	events := testChain(t, 4)
+
+	last, err := Verify(genesisHash, events)
+	require.NoError(t, err)
+	assert.Equal(t, events[3].Hash, last)
+
+	// Can be checked in batches
+	last, err = Verify(genesisHash, events[:2])
+	require.NoError(t, err)
+	_, err = Verify(last, events[2:])
+	assert.NoError(t, err)
+}
+
+func TestVerifyFindsChanges(t *testing.T) {
+	events := testChain(t, 4)
+	events[1].Metadata = json.RawMessage(`{"session_id":"xyz","mfa":false}`)
+
+	_, err := Verify(genesisHash, events)
+	var chainErr *ChainError
+	require.ErrorAs(t, err, &chainErr)
+	assert.Equal(t, int64(2), chainErr.ID)
+
+	// Rehashing the changed row still breaks the next one
+	events[1].Hash, err = Hash(events[1])
+	require.NoError(t, err)
+	_, err = Verify(genesisHash, events)
+	require.ErrorAs(t, err, &chainErr)
+	assert.Equal(t, int64(3), chainErr.ID)
+}
+
+func TestVerifyFindsRemovedEvents(t *testing.T) {
+	events := testChain(t, 4)
+	events = append(events[:2], events[3:]...)
+
+	_, err := Verify(genesisHash, events)
+	var chainErr *ChainError
+	require.ErrorAs(t, err, &chainErr)
+	assert.Equal(t, int64(4), chainErr.ID)
+}
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/database"
+)
+
+// How many events are read at a time when checking the whole chain
+const verifyBatchSize = 500
+
+// Writes events to the audit_events table
+type Recorder struct {
+	db *sql.DB
+}
+
+func NewRecorder(db *sql.DB) *Recorder {
+	return &Recorder{db: db}
+}
+
+// Adds an event to the end of the chain. Events are added one at a time
+// (across every server) so each one chains off the latest
+func (r *Recorder) Record(ctx context.Context, e Event) (database.AuditEvent, error) {
+	metadata := json.RawMessage("{}")
+	if len(e.Metadata) > 0 {
+		var err error
+		metadata, err = json.Marshal(e.Metadata)
+		if err != nil {
+			return database.AuditEvent{}, err
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.AuditEvent{}, err
+	}
+	defer tx.Rollback()
+	q := database.New(tx)
+
+	// Held until the transaction ends
+	err = q.LockAuditEvents(ctx)
+	if err != nil {
+		return database.AuditEvent{}, err
+	}
+
+	prev, err := q.GetLastAuditHash(ctx)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return database.AuditEvent{}, err
+		}
+		prev = genesisHash
+	}
+
+	// Postgres keeps microseconds, anything finer would change the hash
+	event := database.AuditEvent{
+		CreatedAt:  time.Now().UTC().Truncate(time.Microsecond),
+		Action:     e.Action,
+		ActorID:    e.ActorID,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IpAddress:  e.IP,
+		RequestID:  e.RequestID,
+		Metadata:   metadata,
+		PrevHash:   prev,
+	}
+	event.Hash, err = Hash(event)
+	if err != nil {
+		return database.AuditEvent{}, err
+	}
+
+	created, err := q.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		CreatedAt:  event.CreatedAt,
+		Action:     event.Action,
+		ActorID:    event.ActorID,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		IpAddress:  event.IpAddress,
+		RequestID:  event.RequestID,
+		Metadata:   event.Metadata,
+		PrevHash:   event.PrevHash,
+		Hash:       event.Hash,
+	})
+	if err != nil {
+		return database.AuditEvent{}, err
+	}
+
+	return created, tx.Commit()
+}
+
+// Checks the whole chain from the first event, returning how many events
+// were fine. The error is a *ChainError if one of them wasn't
+func (r *Recorder) Verify(ctx context.Context) (int, error) {
+	q := database.New(r.db)
+	prev := genesisHash
+	var lastID int64
+	checked := 0
+	for {
+		events, err := q.ListAuditEventsAfter(ctx, database.ListAuditEventsAfterParams{
+			ID:    lastID,
+			Limit: verifyBatchSize,
+		})
+		if err != nil {
+			return checked, err
+		}
+
+		for _, e := range events {
+			prev, err = Verify(prev, []database.AuditEvent{e})
+			if err != nil {
+				return checked, err
+			}
+			checked++
+			lastID = e.ID
+		}
+
+		if len(events) < verifyBatchSize {
+			return checked, nil
+		}
+	}
+}
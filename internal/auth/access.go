@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Personal access tokens start with this so they can be told apart from
+// JWTs and spotted by secret scanners
+const AccessTokenPrefix = "chirpy_pat_"
+
+// What a personal access token is allowed to do
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+var allScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// Makes a new random personal access token, only its HashToken is stored
+func MakeAccessToken() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return AccessTokenPrefix + hex.EncodeToString(key), nil
+}
+
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// Checks every requested scope is a real one, returns them sorted without duplicates
+func ParseScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required, one of %s", strings.Join(allScopes, ", "))
+	}
+
+	parsed := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !slices.Contains(allScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q, must be one of %s", scope, strings.Join(allScopes, ", "))
+		}
+		parsed = append(parsed, scope)
+	}
+
+	slices.Sort(parsed)
+	return slices.Compact(parsed), nil
+}
+
+func HasScope(scopes []string, scope string) bool {
+	return slices.Contains(scopes, scope)
+}
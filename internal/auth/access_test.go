@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakeAccessToken(t *testing.T) {
+	token, err := MakeAccessToken()
+	assert.NoError(t, err)
+	assert.True(t, IsAccessToken(token))
+	assert.Len(t, token, len(AccessTokenPrefix)+64)
+
+	other, err := MakeAccessToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+
+	// A JWT isn't one
+	assert.False(t, IsAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig"))
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{"chirps:write", "chirps:read", "chirps:write"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"chirps:read", "chirps:write"}, scopes)
+	assert.True(t, HasScope(scopes, ScopeChirpsRead))
+	assert.False(t, HasScope(scopes, ScopeProfileWrite))
+
+	_, err = ParseScopes([]string{"chirps:read", "admin"})
+	assert.Error(t, err)
+
+	_, err = ParseScopes(nil)
+	assert.Error(t, err)
+}
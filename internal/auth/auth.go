@@ -1,137 +1,146 @@
-package auth
-
-import (
-	"log"
-	"golang.org/x/crypto/bcrypt"
-	"github.com/golang-jwt/jwt/v5"
-	"time"
-	"github.com/google/uuid"
-	"fmt"
-	"errors"
-	"net/http"
-	"strings"
-	"crypto/rand"
-	"encoding/hex"
-	"github.com/Tim-Restart/chirpy/internal/database"
-	"context"
-)
-
-// Function to hash a given password and return the hash
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		log.Print("Error hasing password")
-		return "", err
-	}
-
-	return string(hashedPassword), nil
-
-}
-
-// Function to check inputed password against users recorded hash
-
-func CheckPasswordHash(hashedPassword, password string) error {
-	// Hash the entered password first
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-}
-
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	// Function to make and issue JWT
-
-	claims := jwt.RegisteredClaims{
-		// A usual scenario is to set the expiration time relative to the current time
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		Issuer:    "chirpy",
-		Subject:   userID.String(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	tokenString, err := token.SignedString([]byte(tokenSecret))
-	if err != nil {
-		log.Print("Error issuing token")
-		return "", err
-	}
-	
-	return tokenString, nil
-}
-
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Verify the signing method
-		// Return the key for validation
-		return []byte(tokenSecret), nil
-	},
-)
-
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	// Extract claims
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok {
-		return uuid.Nil, fmt.Errorf("invalid token claims")
-	}
-
-	// Extract the user ID from the Subject field
-	userID, err := uuid.Parse(claims.Subject)
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	return userID, nil
-}
-
-func GetBearerToken(headers http.Header) (string, error) {
-	// Gets the bearer token and does stuff with it
-	authHeader := headers.Get("Authorization")
-	if authHeader == "" {
-		log.Print("Error: Authorization header is empty")
-		return "", errors.New("authorization header is missing")
-	}
-
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		log.Print("Error: Authorization header does not start with 'Bearer '")
-		return "", errors.New("invalid authorization header format")
-	}
-
-	token := strings.TrimPrefix(authHeader, "Bearer ")
-
-	if strings.TrimSpace(token) == "" {
-		log.Print("Error: Token is empty after trimming")
-		return "", errors.New("authorization token is empty")
-	}
-
-	return token, nil
-
-}
-
-// Makes a refresh token
-func MakeRefreshToken() (string, error) {
-	key := make([]byte, 32) // Makes an empty byte slice to be filled by the rand.Read
-	
-	if _, err := rand.Read(key); err != nil {
-		return "", err
-	}
-	encodedKey := hex.EncodeToString(key)
-	return encodedKey, nil
-}
-
-func SaveRefreshToken(token string, userID uuid.UUID, dbQueries database.Queries) error {
-	ctx := context.Background()
-
-	params := database.SaveRefTokenParams{
-		Token:  token,
-		UserID: userID,
-	}
-	err := dbQueries.SaveRefToken(ctx, params)
-	if err != nil {
-		return err
-	}
-
-
-	return nil
+package auth
+
+import (
+	"log"
+	"github.com/golang-jwt/jwt/v5"
+	"time"
+	"github.com/google/uuid"
+	"errors"
+	"net/http"
+	"strings"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"context"
+	"sync"
+)
+
+// Function to hash a given password and return the hash
+// Uses whichever PasswordHasher is set, argon2id unless changed
+func HashPassword(password string) (string, error) {
+	hashedPassword, err := passwordHasher.Hash(password)
+	if err != nil {
+		log.Print("Error hasing password")
+		return "", err
+	}
+
+	return hashedPassword, nil
+
+}
+
+// Function to check inputed password against users recorded hash
+
+func CheckPasswordHash(hashedPassword, password string) error {
+	// Works out from the hash how it was made, bcrypt or argon2id
+	return checkPassword(hashedPassword, password)
+}
+
+// A real hash of a password nobody has, made the first time it's needed
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("chirpy dummy password")
+	return hash
+})
+
+// Does the same work as checking a real password, so a login for an
+// email that doesn't exist takes as long as one with a wrong password
+func CheckDummyPassword(password string) {
+	_ = CheckPasswordHash(dummyHash(), password)
+}
+
+// Claims in our access tokens, sid is the session the token was issued for
+// and role is the user's role when it was issued
+// client_id and scope are only on tokens issued to OAuth apps
+// purpose is only set on tokens that aren't access tokens, like MFA challenges
+type Claims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+	Role      string `json:"role,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Purpose   string `json:"purpose,omitempty"`
+}
+
+// The scopes an OAuth app's token was given, space separated in the token
+func (c Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// Purpose of the token handed out after a correct password when 2FA is on
+const PurposeMFAPending = "mfa_pending"
+
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return MakeSessionJWT(userID, uuid.Nil, tokenSecret, expiresIn)
+}
+
+// Same as MakeJWT but records which session (login) the token belongs to
+func MakeSessionJWT(userID, sessionID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	tokenString, err := SecretKeySet(tokenSecret).MakeSessionJWT(userID, sessionID, "", expiresIn)
+	if err != nil {
+		log.Print("Error issuing token")
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	return SecretKeySet(tokenSecret).ValidateJWT(tokenString)
+}
+
+// Returns the session a valid token was issued for, uuid.Nil if it doesn't say
+func SessionFromJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	return SecretKeySet(tokenSecret).SessionFromJWT(tokenString)
+}
+
+func GetBearerToken(headers http.Header) (string, error) {
+	// Gets the bearer token and does stuff with it
+	authHeader := headers.Get("Authorization")
+	if authHeader == "" {
+		log.Print("Error: Authorization header is empty")
+		return "", errors.New("authorization header is missing")
+	}
+
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		log.Print("Error: Authorization header does not start with 'Bearer '")
+		return "", errors.New("invalid authorization header format")
+	}
+
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+
+	if strings.TrimSpace(token) == "" {
+		log.Print("Error: Token is empty after trimming")
+		return "", errors.New("authorization token is empty")
+	}
+
+	return token, nil
+
+}
+
+// Makes a refresh token
+func MakeRefreshToken() (string, error) {
+	key := make([]byte, 32) // Makes an empty byte slice to be filled by the rand.Read
+	
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	encodedKey := hex.EncodeToString(key)
+	return encodedKey, nil
+}
+
+// Saves a refresh token, familyID is new at login and carried over when the token is rotated
+func SaveRefreshToken(token string, userID, familyID uuid.UUID, dbQueries database.Queries) error {
+	ctx := context.Background()
+
+	params := database.SaveRefTokenParams{
+		Token:    token,
+		UserID:   userID,
+		FamilyID: familyID,
+	}
+	err := dbQueries.SaveRefToken(ctx, params)
+	if err != nil {
+		return err
+	}
+
+
+	return nil
 }
\ No newline at end of file
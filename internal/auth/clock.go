@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Where the auth package gets the time from, tests swap in a fake one
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+var (
+	clockMu sync.RWMutex
+	clock   Clock = systemClock{}
+)
+
+// Replaces the clock and returns the old one so it can be put back
+func SetClock(c Clock) Clock {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	old := clock
+	clock = c
+	return old
+}
+
+func now() time.Time {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
+	return clock.Now()
+}
+
+// A clock that only moves when told to
+type FakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{t: t}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
@@ -0,0 +1,365 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// A key for signing or checking access tokens, the ID goes in the token's
+// kid header so we know which key to check it with
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	// signKey is nil for keys that are only kept around to check old tokens
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// Makes an HS256 key from a shared secret
+func NewHMACKey(id, secret string) *Key {
+	return &Key{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+// An HS256 key that can only check tokens, so ones signed with the shared
+// secret keep working after switching to asymmetric keys
+func NewHMACVerifyKey(id, secret string) *Key {
+	return &Key{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		verifyKey: []byte(secret),
+	}
+}
+
+// Reads an Ed25519 or RSA key from PEM, private keys can sign and
+// public keys can only verify
+func ParseKeyPEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM data found", id)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		switch priv := priv.(type) {
+		case ed25519.PrivateKey:
+			return &Key{ID: id, Method: jwt.SigningMethodEdDSA, signKey: priv, verifyKey: priv.Public()}, nil
+		case *rsa.PrivateKey:
+			return &Key{ID: id, Method: jwt.SigningMethodRS256, signKey: priv, verifyKey: &priv.PublicKey}, nil
+		}
+	case "RSA PRIVATE KEY":
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, signKey: priv, verifyKey: &priv.PublicKey}, nil
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		switch pub := pub.(type) {
+		case ed25519.PublicKey:
+			return &Key{ID: id, Method: jwt.SigningMethodEdDSA, verifyKey: pub}, nil
+		case *rsa.PublicKey:
+			return &Key{ID: id, Method: jwt.SigningMethodRS256, verifyKey: pub}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("key %s: only Ed25519 and RSA keys are supported", id)
+}
+
+// The keys we sign with and accept, one signs new tokens and any of them
+// can check a token, so a key can be swapped out without logging everyone out
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{keys: map[string]*Key{}}
+}
+
+// A key set that signs with a single HS256 secret, tokens don't get a kid
+func SecretKeySet(secret string) *KeySet {
+	ks := NewKeySet()
+	ks.Add(NewHMACKey("", secret), true)
+	return ks
+}
+
+// Loads every .pem file in a directory, the key ID is the file name without .pem
+// activeID picks the key that signs new tokens, the rest only verify
+func LoadKeyDir(dir, activeID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	ks := NewKeySet()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParseKeyPEM(id, data)
+		if err != nil {
+			return nil, err
+		}
+
+		err = ks.Add(key, id == activeID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ks.signing == nil {
+		return nil, fmt.Errorf("no private key named %q in %s", activeID, dir)
+	}
+
+	return ks, nil
+}
+
+// Adds a key, active makes it the one new tokens are signed with
+func (ks *KeySet) Add(key *Key, active bool) error {
+	if _, ok := ks.keys[key.ID]; ok {
+		return fmt.Errorf("duplicate key ID %q", key.ID)
+	}
+	if active && key.signKey == nil {
+		return fmt.Errorf("key %q can't sign, it's only a public key", key.ID)
+	}
+
+	ks.keys[key.ID] = key
+	if active {
+		ks.signing = key
+	}
+	return nil
+}
+
+// Signs the claims with the active key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.signing == nil {
+		return "", errors.New("no signing key")
+	}
+
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	if ks.signing.ID != "" {
+		token.Header["kid"] = ks.signing.ID
+	}
+
+	return token.SignedString(ks.signing.signKey)
+}
+
+// Checks a token against the key named in its kid header and fills in claims
+// The token has to use the same algorithm as the key, so a public key can't
+// be passed off as an HMAC secret
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.verifyKey, nil
+	}, jwt.WithTimeFunc(now))
+	return err
+}
+
+func newClaims(userID uuid.UUID, expiresIn time.Duration) Claims {
+	issued := now()
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			// A usual scenario is to set the expiration time relative to the current time
+			ExpiresAt: jwt.NewNumericDate(issued.Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(issued.UTC()),
+			Issuer:    "chirpy",
+			Subject:   userID.String(),
+		},
+	}
+}
+
+func (ks *KeySet) MakeSessionJWT(userID, sessionID uuid.UUID, role string, expiresIn time.Duration) (string, error) {
+	claims := newClaims(userID, expiresIn)
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	}
+	if role != RoleUser {
+		claims.Role = role
+	}
+
+	return ks.Sign(claims)
+}
+
+// An access token for an OAuth app, it can only do what scopes allow
+// and never carries the user's role
+func (ks *KeySet) MakeOAuthJWT(userID, sessionID, clientID uuid.UUID, scopes []string, expiresIn time.Duration) (string, error) {
+	claims := newClaims(userID, expiresIn)
+	claims.SessionID = sessionID.String()
+	claims.ClientID = clientID.String()
+	claims.Scope = strings.Join(scopes, " ")
+
+	return ks.Sign(claims)
+}
+
+// Checks an access token and returns everything in it
+func (ks *KeySet) AccessClaims(tokenString string) (Claims, error) {
+	return ks.parseAccessToken(tokenString)
+}
+
+// Parses an access token, tokens made for anything else are refused
+func (ks *KeySet) parseAccessToken(tokenString string) (Claims, error) {
+	var claims Claims
+	err := ks.Parse(tokenString, &claims)
+	if err != nil {
+		return claims, err
+	}
+
+	if claims.Purpose != "" {
+		return claims, fmt.Errorf("not an access token")
+	}
+
+	return claims, nil
+}
+
+// Checks the token and returns the user it was issued to
+func (ks *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := ks.parseAccessToken(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return uuid.Parse(claims.Subject)
+}
+
+// Returns the user a valid token was issued to and their role at the time,
+// tokens without a role are for plain users
+func (ks *KeySet) RoleFromJWT(tokenString string) (uuid.UUID, string, error) {
+	claims, err := ks.parseAccessToken(tokenString)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	if claims.Role == "" {
+		return userID, RoleUser, nil
+	}
+	return userID, claims.Role, nil
+}
+
+// Returns the session a valid token was issued for, uuid.Nil if it doesn't say
+func (ks *KeySet) SessionFromJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := ks.parseAccessToken(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if claims.SessionID == "" {
+		return uuid.Nil, nil
+	}
+
+	return uuid.Parse(claims.SessionID)
+}
+
+// A short lived token that proves the password was right, it's swapped
+// for real tokens once a 2FA code is checked
+func (ks *KeySet) MakeMFAToken(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	claims := newClaims(userID, expiresIn)
+	claims.Purpose = PurposeMFAPending
+	return ks.Sign(claims)
+}
+
+// Checks an MFA challenge token and returns the user it's for
+func (ks *KeySet) ValidateMFAToken(tokenString string) (uuid.UUID, error) {
+	var claims Claims
+	err := ks.Parse(tokenString, &claims)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if claims.Purpose != PurposeMFAPending {
+		return uuid.Nil, fmt.Errorf("not an MFA token")
+	}
+
+	return uuid.Parse(claims.Subject)
+}
+
+// A public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// The public half of every asymmetric key, for other services to check our tokens
+// HMAC secrets are never included
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, key := range ks.keys {
+		jwk := JWK{
+			KeyID:     key.ID,
+			Algorithm: key.Method.Alg(),
+			Use:       "sig",
+		}
+
+		switch pub := key.verifyKey.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	// Map order is random, keep the output stable
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID })
+
+	return jwks
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Writes a new Ed25519 private key to dir/<id>.pem
+func writeEd25519Key(t *testing.T, dir, id string) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	assert.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, id+".pem"), data, 0600))
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "2024-01")
+	writeEd25519Key(t, dir, "2024-02")
+
+	userID := uuid.New()
+
+	// Token signed with the old key
+	oldKeys, err := LoadKeyDir(dir, "2024-01")
+	assert.NoError(t, err)
+	token, err := oldKeys.MakeSessionJWT(userID, uuid.Nil, RoleUser, time.Hour)
+	assert.NoError(t, err)
+
+	// Still accepted after switching to the new key
+	newKeys, err := LoadKeyDir(dir, "2024-02")
+	assert.NoError(t, err)
+	extractedID, err := newKeys.ValidateJWT(token)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, extractedID)
+
+	// But not once the old key is gone
+	assert.NoError(t, os.Remove(filepath.Join(dir, "2024-01.pem")))
+	newKeys, err = LoadKeyDir(dir, "2024-02")
+	assert.NoError(t, err)
+	_, err = newKeys.ValidateJWT(token)
+	assert.Error(t, err)
+
+	// The active key has to exist
+	_, err = LoadKeyDir(dir, "missing")
+	assert.Error(t, err)
+}
+
+// Tokens signed with SECRET still work after moving to a key directory
+func TestSecretTokensAfterSwitch(t *testing.T) {
+	userID := uuid.New()
+	token, err := SecretKeySet("secret").MakeSessionJWT(userID, uuid.Nil, RoleUser, time.Hour)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "main")
+	keys, err := LoadKeyDir(dir, "main")
+	assert.NoError(t, err)
+	assert.NoError(t, keys.Add(NewHMACVerifyKey("", "secret"), false))
+
+	extractedID, err := keys.ValidateJWT(token)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, extractedID)
+
+	// New tokens are signed with the key from the directory
+	token, err = keys.MakeSessionJWT(userID, uuid.Nil, RoleUser, time.Hour)
+	assert.NoError(t, err)
+	_, err = SecretKeySet("secret").ValidateJWT(token)
+	assert.Error(t, err)
+
+	// And the secret can't be made the signing key
+	assert.Error(t, NewKeySet().Add(NewHMACVerifyKey("", "secret"), true))
+}
+
+func TestKeySetRejectsOtherAlgorithms(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "main")
+	keys, err := LoadKeyDir(dir, "main")
+	assert.NoError(t, err)
+
+	// An HS256 token isn't accepted just because it has a known kid
+	hmacKeys := NewKeySet()
+	assert.NoError(t, hmacKeys.Add(NewHMACKey("main", "secret"), true))
+	token, err := hmacKeys.MakeSessionJWT(uuid.New(), uuid.Nil, RoleUser, time.Hour)
+	assert.NoError(t, err)
+
+	_, err = keys.ValidateJWT(token)
+	assert.Error(t, err)
+}
+
+func TestJWKS(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "main")
+	keys, err := LoadKeyDir(dir, "main")
+	assert.NoError(t, err)
+
+	jwks := keys.JWKS()
+	assert.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "main", jwks.Keys[0].KeyID)
+	assert.Equal(t, "OKP", jwks.Keys[0].KeyType)
+	assert.Equal(t, "EdDSA", jwks.Keys[0].Algorithm)
+	assert.NotEmpty(t, jwks.Keys[0].X)
+
+	// Shared secrets are never published
+	assert.Empty(t, SecretKeySet("secret").JWKS().Keys)
+}
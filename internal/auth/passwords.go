@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// Makes password hashes, the hash says which algorithm and settings made it
+// so old ones keep working after the settings change
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Reports whether hash was made by this hasher with its current settings
+	Current(hash string) bool
+}
+
+// The hasher new passwords are hashed with
+var passwordHasher PasswordHasher = Argon2idHasher{Params: DefaultArgon2Params}
+
+// Swaps the hasher new passwords use, returns the old one
+func SetPasswordHasher(h PasswordHasher) PasswordHasher {
+	old := passwordHasher
+	passwordHasher = h
+	return old
+}
+
+// Checks a password against a hash made by any hasher we've ever used
+func checkPassword(hash, password string) error {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		return checkArgon2id(hash, password)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+// Reports whether a hash should be replaced next time we see the password
+func NeedsRehash(hash string) bool {
+	return !passwordHasher.Current(hash)
+}
+
+// Settings for argon2id, memory is in KiB
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// The second recommended option from RFC 9106, for when 2GiB is too much
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Parses memory, iterations and parallelism written like they are in a
+// hash, e.g. "m=65536,t=3,p=2", anything left out is the default
+func ParseArgon2Params(s string) (Argon2Params, error) {
+	params := DefaultArgon2Params
+	if s == "" {
+		return params, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		key, raw, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return params, fmt.Errorf("argon2 setting %q should look like m=65536", part)
+		}
+		parsed, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil || parsed == 0 {
+			return params, fmt.Errorf("argon2 setting %q should be a positive number", part)
+		}
+		value := uint32(parsed)
+
+		switch key {
+		case "m":
+			params.Memory = value
+		case "t":
+			params.Iterations = value
+		case "p":
+			if value > 255 {
+				return params, fmt.Errorf("argon2 parallelism can't be more than 255")
+			}
+			params.Parallelism = uint8(value)
+		default:
+			return params, fmt.Errorf("unknown argon2 setting %q, use m, t or p", key)
+		}
+	}
+
+	return params, nil
+}
+
+const argon2idPrefix = "$argon2id$"
+
+var b64 = base64.RawStdEncoding
+
+// Hashes with argon2id, written in the PHC string format
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+type Argon2idHasher struct {
+	Params Argon2Params
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version,
+		h.Params.Memory, h.Params.Iterations, h.Params.Parallelism,
+		b64.EncodeToString(salt), b64.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) Current(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false
+	}
+
+	return params.Memory == h.Params.Memory &&
+		params.Iterations == h.Params.Iterations &&
+		params.Parallelism == h.Params.Parallelism &&
+		uint32(len(salt)) == h.Params.SaltLength &&
+		uint32(len(key)) == h.Params.KeyLength
+}
+
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, errors.New("invalid argon2 settings")
+	}
+
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errors.New("invalid argon2 salt")
+	}
+	key, err := b64.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, errors.New("invalid argon2 hash")
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+func checkArgon2id(hash, password string) error {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// Hashes with bcrypt, which only looks at the first 72 bytes of a password
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h BcryptHasher) Current(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost == h.Cost
+}
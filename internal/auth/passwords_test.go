@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Small settings so the tests don't take ages
+var testArgon2Params = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHasher(t *testing.T) {
+	defer SetPasswordHasher(SetPasswordHasher(Argon2idHasher{Params: testArgon2Params}))
+
+	hash, err := HashPassword("correct horse battery staple")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	assert.NoError(t, CheckPasswordHash(hash, "correct horse battery staple"))
+	assert.ErrorIs(t, CheckPasswordHash(hash, "correct horse battery stapler"), ErrPasswordMismatch)
+	assert.False(t, NeedsRehash(hash))
+
+	// Stronger settings make the old hash out of date, but it still works
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+	SetPasswordHasher(Argon2idHasher{Params: stronger})
+	assert.True(t, NeedsRehash(hash))
+	assert.NoError(t, CheckPasswordHash(hash, "correct horse battery staple"))
+}
+
+func TestLongPasswordsArentTruncated(t *testing.T) {
+	defer SetPasswordHasher(SetPasswordHasher(Argon2idHasher{Params: testArgon2Params}))
+
+	// bcrypt would only see the first 72 bytes of these
+	long := strings.Repeat("a", 80)
+	hash, err := HashPassword(long + "1")
+	assert.NoError(t, err)
+	assert.Error(t, CheckPasswordHash(hash, long+"2"))
+}
+
+func TestBcryptHashesStillWork(t *testing.T) {
+	defer SetPasswordHasher(SetPasswordHasher(Argon2idHasher{Params: testArgon2Params}))
+
+	old, err := bcrypt.GenerateFromPassword([]byte("hunter2hunter2"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	assert.NoError(t, CheckPasswordHash(string(old), "hunter2hunter2"))
+	assert.ErrorIs(t, CheckPasswordHash(string(old), "hunter3hunter3"), ErrPasswordMismatch)
+	assert.True(t, NeedsRehash(string(old)))
+
+	SetPasswordHasher(BcryptHasher{Cost: bcrypt.MinCost})
+	assert.False(t, NeedsRehash(string(old)))
+}
+
+func TestParseArgon2Params(t *testing.T) {
+	params, err := ParseArgon2Params("m=19456,t=2,p=1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(19456), params.Memory)
+	assert.Equal(t, uint32(2), params.Iterations)
+	assert.Equal(t, uint8(1), params.Parallelism)
+	assert.Equal(t, DefaultArgon2Params.KeyLength, params.KeyLength)
+
+	params, err = ParseArgon2Params("")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultArgon2Params, params)
+
+	_, err = ParseArgon2Params("m=lots")
+	assert.Error(t, err)
+	_, err = ParseArgon2Params("x=1")
+	assert.Error(t, err)
+}
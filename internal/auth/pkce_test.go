@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPKCE(t *testing.T) {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	assert.Equal(t, challenge, PKCEChallenge(verifier))
+	assert.True(t, VerifyPKCE(verifier, challenge))
+	assert.False(t, VerifyPKCE(verifier[:42]+"A", challenge))
+
+	// Too short, and characters that aren't allowed
+	assert.False(t, ValidPKCEValue("abc"))
+	assert.False(t, ValidPKCEValue(strings.Repeat("a", 42)+"!"))
+	assert.True(t, ValidPKCEValue(strings.Repeat("a", 128)))
+	assert.False(t, ValidPKCEValue(strings.Repeat("a", 129)))
+}
+
+func TestOAuthJWT(t *testing.T) {
+	keys := SecretKeySet("test-secret")
+	userID, sessionID, clientID := uuid.New(), uuid.New(), uuid.New()
+
+	token, err := keys.MakeOAuthJWT(userID, sessionID, clientID, []string{ScopeChirpsRead, ScopeChirpsWrite}, time.Hour)
+	assert.NoError(t, err)
+
+	claims, err := keys.AccessClaims(token)
+	assert.NoError(t, err)
+	assert.Equal(t, userID.String(), claims.Subject)
+	assert.Equal(t, clientID.String(), claims.ClientID)
+	assert.Equal(t, []string{ScopeChirpsRead, ScopeChirpsWrite}, claims.Scopes())
+
+	// Never an admin, whoever the user is
+	_, role, err := keys.RoleFromJWT(token)
+	assert.NoError(t, err)
+	assert.Equal(t, RoleUser, role)
+}
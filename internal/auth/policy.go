@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Common breached passwords that are always refused
+//
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// Rules a new password has to follow
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	breached  map[string]struct{}
+}
+
+// A policy with the built in breached password list, lengths are in characters
+func NewPasswordPolicy(minLength int) *PasswordPolicy {
+	p := &PasswordPolicy{
+		MinLength: minLength,
+		// Long enough for any passphrase, short enough hashing can't be abused
+		MaxLength: 1024,
+		breached:  map[string]struct{}{},
+	}
+	p.addBreached(strings.NewReader(commonPasswords))
+	return p
+}
+
+// Adds every password in a file (one per line) to the breached list
+func (p *PasswordPolicy) LoadBreachedFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return p.addBreached(f)
+}
+
+func (p *PasswordPolicy) addBreached(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.breached[strings.ToLower(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// Returns an error saying what's wrong with the password, nil if it's fine
+func (p *PasswordPolicy) Check(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	if length > p.MaxLength {
+		return fmt.Errorf("password can't be more than %d characters", p.MaxLength)
+	}
+
+	// Changing the case of a known password doesn't make it any less known
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		return fmt.Errorf("password is too common, it has appeared in data breaches")
+	}
+
+	return nil
+}
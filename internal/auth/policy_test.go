@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := NewPasswordPolicy(10)
+
+	assert.NoError(t, policy.Check("a perfectly fine passphrase"))
+	assert.Error(t, policy.Check("short"))
+
+	// Counted in characters, not bytes
+	assert.NoError(t, policy.Check("ééééééééééé"))
+
+	// On the built in list, whatever the case
+	assert.Error(t, policy.Check("qwertyuiop"))
+	assert.Error(t, policy.Check("QwertyUIOP"))
+}
+
+func TestPasswordPolicyBreachedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	err := os.WriteFile(path, []byte("# comment\nmy-leaked-password\n\n"), 0o600)
+	assert.NoError(t, err)
+
+	policy := NewPasswordPolicy(8)
+	assert.NoError(t, policy.Check("my-leaked-password"))
+
+	assert.NoError(t, policy.LoadBreachedFile(path))
+	assert.Error(t, policy.Check("my-leaked-password"))
+	assert.NoError(t, policy.Check("# comment"))
+
+	assert.Error(t, policy.LoadBreachedFile(filepath.Join(t.TempDir(), "missing.txt")))
+}
@@ -0,0 +1,26 @@
+package auth
+
+// Roles a user can have, each one can do everything the ones before it can
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// Reports whether role is allowed to do things that need min,
+// unknown roles aren't allowed anything
+func RoleAtLeast(role, min string) bool {
+	rank, ok := roleRank[role]
+	return ok && rank >= roleRank[min]
+}
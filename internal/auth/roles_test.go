@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleAtLeast(t *testing.T) {
+	assert.True(t, RoleAtLeast(RoleAdmin, RoleModerator))
+	assert.True(t, RoleAtLeast(RoleModerator, RoleModerator))
+	assert.False(t, RoleAtLeast(RoleUser, RoleModerator))
+	assert.False(t, RoleAtLeast("superuser", RoleUser))
+
+	assert.True(t, ValidRole(RoleAdmin))
+	assert.False(t, ValidRole(""))
+}
+
+func TestRoleJWT(t *testing.T) {
+	keys := SecretKeySet("test-secret")
+	userID := uuid.New()
+
+	token, err := keys.MakeSessionJWT(userID, uuid.New(), RoleModerator, time.Hour)
+	assert.NoError(t, err)
+
+	extractedID, role, err := keys.RoleFromJWT(token)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, extractedID)
+	assert.Equal(t, RoleModerator, role)
+
+	// Tokens from before roles existed are plain users
+	token, err = MakeJWT(userID, "test-secret", time.Hour)
+	assert.NoError(t, err)
+	_, role, err = keys.RoleFromJWT(token)
+	assert.NoError(t, err)
+	assert.Equal(t, RoleUser, role)
+}
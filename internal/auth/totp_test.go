@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// The SHA1 secret from the RFC 6238 test vectors, base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, last 6 of the 8 digit codes
+	code, err := TOTPCode(rfcSecret, TOTPCounter(time.Unix(59, 0)))
+	assert.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	code, err = TOTPCode(rfcSecret, TOTPCounter(time.Unix(1111111109, 0)))
+	assert.NoError(t, err)
+	assert.Equal(t, "081804", code)
+}
+
+func TestValidateTOTP(t *testing.T) {
+	fake := NewFakeClock(time.Unix(59, 0))
+	defer SetClock(SetClock(fake))
+
+	counter, ok := ValidateTOTP(rfcSecret, "287082")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), counter)
+
+	// One step later is still fine, phone clocks drift
+	fake.Advance(30 * time.Second)
+	_, ok = ValidateTOTP(rfcSecret, "287082")
+	assert.True(t, ok)
+
+	// Two steps later it's too old
+	fake.Advance(30 * time.Second)
+	_, ok = ValidateTOTP(rfcSecret, "287082")
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(rfcSecret, "not a code")
+	assert.False(t, ok)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	assert.NoError(t, err)
+	assert.Len(t, codes, 10)
+	assert.Len(t, codes[0], 11)
+
+	// Hashes ignore how the user typed it
+	assert.Equal(t, HashRecoveryCode(codes[0]), HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+	assert.NotEqual(t, HashRecoveryCode(codes[0]), HashRecoveryCode(codes[1]))
+}
+
+func TestMFAToken(t *testing.T) {
+	fake := NewFakeClock(time.Now())
+	defer SetClock(SetClock(fake))
+
+	keys := SecretKeySet("test-secret")
+	userID := uuid.New()
+
+	token, err := keys.MakeMFAToken(userID, 5*time.Minute)
+	assert.NoError(t, err)
+
+	extractedID, err := keys.ValidateMFAToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, userID, extractedID)
+
+	// It's not an access token
+	_, err = keys.ValidateJWT(token)
+	assert.Error(t, err)
+
+	// And an access token isn't an MFA token
+	access, err := keys.MakeSessionJWT(userID, uuid.Nil, RoleUser, time.Hour)
+	assert.NoError(t, err)
+	_, err = keys.ValidateMFAToken(access)
+	assert.Error(t, err)
+
+	// It runs out
+	fake.Advance(6 * time.Minute)
+	_, err = keys.ValidateMFAToken(token)
+	assert.Error(t, err)
+}
@@ -1,11 +1,11 @@
-// internal/database/database_test.go
-package database
-
-import (
-	"testing"
-)
-
-func TestDatabaseFunctionality(t *testing.T) {
-	// This test doesn't do anything yet, but ensures we have a test file
-	// You would add actual tests here for your database functions
+// internal/database/database_test.go
+package database
+
+import (
+	"testing"
+)
+
+func TestDatabaseFunctionality(t *testing.T) {
+	// This test doesn't do anything yet, but ensures we have a test file
+	// You would add actual tests here for your database functions
 }
\ No newline at end of file
@@ -6,17 +6,186 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type AccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type AuditEvent struct {
+	ID         int64
+	CreatedAt  time.Time
+	Action     string
+	ActorID    uuid.NullUUID
+	TargetType string
+	TargetID   string
+	IpAddress  string
+	RequestID  string
+	Metadata   json.RawMessage
+	PrevHash   string
+	Hash       string
+}
+
 type Chirp struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Body          string
+	UserID        uuid.UUID
+	SearchVector  interface{}
+	InReplyTo     uuid.NullUUID
+	ThreadRootID  uuid.NullUUID
+	DeletedAt     sql.NullTime
+	Kind          string
+	ReferenceID   uuid.NullUUID
+	RevisionCount int32
+	HiddenAt      sql.NullTime
+}
+
+type ChirpHashtag struct {
+	ChirpID   uuid.UUID
+	HashtagID uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpLike struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpMention struct {
+	ChirpID     uuid.UUID
+	UserID      uuid.UUID
+	StartOffset int32
+	EndOffset   int32
+	CreatedAt   time.Time
+}
+
+type ChirpRevision struct {
 	ID        uuid.UUID
+	ChirpID   uuid.UUID
+	Body      string
 	CreatedAt time.Time
+}
+
+type EmailToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Purpose   string
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Hashtag struct {
+	ID        uuid.UUID
+	Tag       string
+	CreatedAt time.Time
+}
+
+type LoginFailure struct {
+	LockKey       string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type ModerationRule struct {
+	ID        uuid.UUID
+	Pattern   string
+	Action    string
+	CreatedBy uuid.NullUUID
+	CreatedAt time.Time
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Kind      string
+	ActorID   uuid.NullUUID
+	ChirpID   uuid.NullUUID
+	GroupKey  sql.NullString
+	CreatedAt time.Time
+	ReadAt    sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+	CreatedAt    time.Time
+}
+
+type OauthCode struct {
+	CodeHash        string
+	ClientID        uuid.UUID
+	UserID          uuid.UUID
+	RedirectUri     string
+	Scopes          []string
+	CodeChallenge   string
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+	UsedAt          sql.NullTime
+	SessionID       uuid.NullUUID
+	RedirectUriSent bool
+}
+
+type RateLimitBucket struct {
+	BucketKey string
+	Tokens    float64
 	UpdatedAt time.Time
-	Body      string
+}
+
+type Report struct {
+	ID             uuid.UUID
+	ReporterID     uuid.NullUUID
+	ChirpID        uuid.NullUUID
+	ChirpBody      sql.NullString
+	ReportedUserID uuid.UUID
+	Category       string
+	Details        string
+	Status         string
+	CreatedAt      time.Time
+	ResolvedAt     sql.NullTime
+}
+
+type ReportAction struct {
+	ID          uuid.UUID
+	ReportID    uuid.UUID
+	ModeratorID uuid.NullUUID
+	Action      string
+	Note        string
+	CreatedAt   time.Time
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
 	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
 }
 
 type RefreshToken struct {
@@ -26,13 +195,40 @@ type RefreshToken struct {
 	UserID    uuid.UUID
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	FamilyID  uuid.UUID
+}
+
+type Session struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	UserAgent   string
+	IpAddress   string
+	DeviceLabel string
+	CreatedAt   time.Time
+	LastUsedAt  time.Time
+	RevokedAt   sql.NullTime
+	ClientID    uuid.NullUUID
+	Scopes      []string
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    sql.NullBool
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	IsChirpyRed     sql.NullBool
+	Username        sql.NullString
+	EmailVerifiedAt sql.NullTime
+	Role            string
+	SuspendedUntil  sql.NullTime
+	Status          string
+}
+
+type UserTotp struct {
+	UserID      uuid.UUID
+	Secret      string
+	ConfirmedAt sql.NullTime
+	LastCounter int64
+	CreatedAt   time.Time
 }
@@ -8,11 +8,101 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const addChirpMentions = `-- name: AddChirpMentions :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, start_offset, end_offset, created_at)
+SELECT $1,
+    unnest($2::uuid[]),
+    unnest($3::int[]),
+    unnest($4::int[]),
+    NOW()
+ON CONFLICT (chirp_id, start_offset) DO NOTHING
+`
+
+type AddChirpMentionsParams struct {
+	ChirpID      uuid.UUID
+	UserIds      []uuid.UUID
+	StartOffsets []int32
+	EndOffsets   []int32
+}
+
+func (q *Queries) AddChirpMentions(ctx context.Context, arg AddChirpMentionsParams) error {
+	_, err := q.db.ExecContext(ctx, addChirpMentions,
+		arg.ChirpID,
+		pq.Array(arg.UserIds),
+		pq.Array(arg.StartOffsets),
+		pq.Array(arg.EndOffsets),
+	)
+	return err
+}
+
+const addLoginFailure = `-- name: AddLoginFailure :one
+INSERT INTO login_failures (lock_key, failures, last_failure_at, locked_until)
+VALUES (
+    $1, 1, $2,
+    CASE WHEN $3::int <= 1
+        THEN $2::timestamp + make_interval(secs => LEAST($4::float8, $5::float8 * POWER(2, 1 - $3::int)))
+    END
+)
+ON CONFLICT (lock_key) DO UPDATE
+SET failures = CASE WHEN login_failures.last_failure_at < $6 THEN 1 ELSE login_failures.failures + 1 END,
+    last_failure_at = EXCLUDED.last_failure_at,
+    locked_until = CASE WHEN (CASE WHEN login_failures.last_failure_at < $6 THEN 1 ELSE login_failures.failures + 1 END) >= $3::int
+        THEN EXCLUDED.last_failure_at + make_interval(secs => LEAST($4::float8, $5::float8 * POWER(2, LEAST((CASE WHEN login_failures.last_failure_at < $6 THEN 1 ELSE login_failures.failures + 1 END) - $3::int, 62))))
+    END
+WHERE login_failures.locked_until IS NULL OR login_failures.locked_until <= EXCLUDED.last_failure_at
+RETURNING lock_key, failures, last_failure_at, locked_until
+`
+
+type AddLoginFailureParams struct {
+	LockKey          string
+	Now              time.Time
+	FreeAttempts     int32
+	MaxDelaySeconds  float64
+	BaseDelaySeconds float64
+	Since            time.Time
+}
+
+func (q *Queries) AddLoginFailure(ctx context.Context, arg AddLoginFailureParams) (LoginFailure, error) {
+	row := q.db.QueryRowContext(ctx, addLoginFailure,
+		arg.LockKey,
+		arg.Now,
+		arg.FreeAttempts,
+		arg.MaxDelaySeconds,
+		arg.BaseDelaySeconds,
+		arg.Since,
+	)
+	var i LoginFailure
+	err := row.Scan(
+		&i.LockKey,
+		&i.Failures,
+		&i.LastFailureAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const addRecoveryCodes = `-- name: AddRecoveryCodes :exec
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at, used_at)
+SELECT gen_random_uuid(), $1, unnest($2::text[]), NOW(), NULL
+`
+
+type AddRecoveryCodesParams struct {
+	UserID     uuid.UUID
+	CodeHashes []string
+}
+
+func (q *Queries) AddRecoveryCodes(ctx context.Context, arg AddRecoveryCodesParams) error {
+	_, err := q.db.ExecContext(ctx, addRecoveryCodes, arg.UserID, pq.Array(arg.CodeHashes))
+	return err
+}
+
 const checkUser = `-- name: CheckUser :one
 SELECT id
 FROM users
@@ -32,19 +122,3027 @@ WHERE user_id = $1
 ORDER BY created_at ASC
 `
 
-func (q *Queries) ChirpsFrom(ctx context.Context, userID uuid.UUID) ([]string, error) {
-	rows, err := q.db.QueryContext(ctx, chirpsFrom, userID)
+func (q *Queries) ChirpsFrom(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, chirpsFrom, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			return nil, err
+		}
+		items = append(items, body)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const clearChirpMentions = `-- name: ClearChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1
+`
+
+func (q *Queries) ClearChirpMentions(ctx context.Context, chirpID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, clearChirpMentions, chirpID)
+	return err
+}
+
+const confirmTOTP = `-- name: ConfirmTOTP :execrows
+UPDATE user_totp
+SET confirmed_at = NOW(), last_counter = $2
+WHERE user_id = $1 AND confirmed_at IS NULL AND last_counter < $2
+`
+
+type ConfirmTOTPParams struct {
+	UserID      uuid.UUID
+	LastCounter int64
+}
+
+func (q *Queries) ConfirmTOTP(ctx context.Context, arg ConfirmTOTPParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, confirmTOTP, arg.UserID, arg.LastCounter)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const countChirpLikes = `-- name: CountChirpLikes :many
+SELECT chirp_id, COUNT(*) AS like_count
+FROM chirp_likes
+WHERE chirp_id = ANY($1::uuid[])
+GROUP BY chirp_id
+`
+
+type CountChirpLikesRow struct {
+	ChirpID   uuid.UUID
+	LikeCount int64
+}
+
+func (q *Queries) CountChirpLikes(ctx context.Context, chirpIds []uuid.UUID) ([]CountChirpLikesRow, error) {
+	rows, err := q.db.QueryContext(ctx, countChirpLikes, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountChirpLikesRow
+	for rows.Next() {
+		var i CountChirpLikesRow
+		if err := rows.Scan(&i.ChirpID, &i.LikeCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countFollowers = `-- name: CountFollowers :one
+SELECT COUNT(*)
+FROM follows
+WHERE followee_id = $1
+`
+
+func (q *Queries) CountFollowers(ctx context.Context, followeeID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countFollowers, followeeID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countFollowing = `-- name: CountFollowing :one
+SELECT COUNT(*)
+FROM follows
+WHERE follower_id = $1
+`
+
+func (q *Queries) CountFollowing(ctx context.Context, followerID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countFollowing, followerID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUnreadNotifications = `-- name: CountUnreadNotifications :one
+SELECT COUNT(DISTINCT COALESCE(group_key, id::text))
+FROM notifications
+WHERE user_id = $1 AND read_at IS NULL
+`
+
+func (q *Queries) CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUnreadNotifications, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAccessToken = `-- name: CreateAccessToken :one
+INSERT INTO access_tokens (id, user_id, name, token_hash, scopes, created_at, expires_at, last_used_at, revoked_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW(), $5, NULL, NULL)
+RETURNING id, user_id, name, token_hash, scopes, created_at, expires_at, last_used_at, revoked_at
+`
+
+type CreateAccessTokenParams struct {
+	UserID    uuid.UUID
+	Name      string
+	TokenHash string
+	Scopes    []string
+	ExpiresAt sql.NullTime
+}
+
+func (q *Queries) CreateAccessToken(ctx context.Context, arg CreateAccessTokenParams) (AccessToken, error) {
+	row := q.db.QueryRowContext(ctx, createAccessToken,
+		arg.UserID,
+		arg.Name,
+		arg.TokenHash,
+		pq.Array(arg.Scopes),
+		arg.ExpiresAt,
+	)
+	var i AccessToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		pq.Array(&i.Scopes),
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const createAuditEvent = `-- name: CreateAuditEvent :one
+INSERT INTO audit_events (created_at, action, actor_id, target_type, target_id, ip_address, request_id, metadata, prev_hash, hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING id, created_at, action, actor_id, target_type, target_id, ip_address, request_id, metadata, prev_hash, hash
+`
+
+type CreateAuditEventParams struct {
+	CreatedAt  time.Time
+	Action     string
+	ActorID    uuid.NullUUID
+	TargetType string
+	TargetID   string
+	IpAddress  string
+	RequestID  string
+	Metadata   json.RawMessage
+	PrevHash   string
+	Hash       string
+}
+
+func (q *Queries) CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvent, error) {
+	row := q.db.QueryRowContext(ctx, createAuditEvent,
+		arg.CreatedAt,
+		arg.Action,
+		arg.ActorID,
+		arg.TargetType,
+		arg.TargetID,
+		arg.IpAddress,
+		arg.RequestID,
+		arg.Metadata,
+		arg.PrevHash,
+		arg.Hash,
+	)
+	var i AuditEvent
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Action,
+		&i.ActorID,
+		&i.TargetType,
+		&i.TargetID,
+		&i.IpAddress,
+		&i.RequestID,
+		&i.Metadata,
+		&i.PrevHash,
+		&i.Hash,
+	)
+	return i, err
+}
+
+const createEmailToken = `-- name: CreateEmailToken :exec
+INSERT INTO email_tokens (token_hash, user_id, purpose, email, created_at, expires_at, used_at)
+VALUES ($1, $2, $3, $4, NOW(), $5, NULL)
+`
+
+type CreateEmailTokenParams struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Purpose   string
+	Email     string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreateEmailToken(ctx context.Context, arg CreateEmailTokenParams) error {
+	_, err := q.db.ExecContext(ctx, createEmailToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.Purpose,
+		arg.Email,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createModerationRule = `-- name: CreateModerationRule :one
+INSERT INTO moderation_rules (id, pattern, action, created_by, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW())
+RETURNING id, pattern, action, created_by, created_at
+`
+
+type CreateModerationRuleParams struct {
+	Pattern   string
+	Action    string
+	CreatedBy uuid.NullUUID
+}
+
+func (q *Queries) CreateModerationRule(ctx context.Context, arg CreateModerationRuleParams) (ModerationRule, error) {
+	row := q.db.QueryRowContext(ctx, createModerationRule, arg.Pattern, arg.Action, arg.CreatedBy)
+	var i ModerationRule
+	err := row.Scan(
+		&i.ID,
+		&i.Pattern,
+		&i.Action,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createNotification = `-- name: CreateNotification :exec
+INSERT INTO notifications (id, user_id, kind, actor_id, chirp_id, group_key, created_at)
+SELECT gen_random_uuid(), $1, $2, $3, $4, $5, NOW()
+WHERE NOT EXISTS (
+    SELECT 1 FROM notifications
+    WHERE user_id = $1
+    AND kind = $2
+    AND actor_id IS NOT DISTINCT FROM $3::uuid
+    AND chirp_id IS NOT DISTINCT FROM $4::uuid
+)
+`
+
+type CreateNotificationParams struct {
+	UserID   uuid.UUID
+	Kind     string
+	ActorID  uuid.NullUUID
+	ChirpID  uuid.NullUUID
+	GroupKey sql.NullString
+}
+
+func (q *Queries) CreateNotification(ctx context.Context, arg CreateNotificationParams) error {
+	_, err := q.db.ExecContext(ctx, createNotification,
+		arg.UserID,
+		arg.Kind,
+		arg.ActorID,
+		arg.ChirpID,
+		arg.GroupKey,
+	)
+	return err
+}
+
+const createOAuthClient = `-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, owner_id, name, secret_hash, redirect_uris, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW())
+RETURNING id, owner_id, name, secret_hash, redirect_uris, created_at
+`
+
+type CreateOAuthClientParams struct {
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+}
+
+func (q *Queries) CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClient, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthClient,
+		arg.OwnerID,
+		arg.Name,
+		arg.SecretHash,
+		pq.Array(arg.RedirectUris),
+	)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.Name,
+		&i.SecretHash,
+		pq.Array(&i.RedirectUris),
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createOAuthCode = `-- name: CreateOAuthCode :exec
+INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, redirect_uri_sent, scopes, code_challenge, created_at, expires_at, used_at, session_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), $8, NULL, NULL)
+`
+
+type CreateOAuthCodeParams struct {
+	CodeHash        string
+	ClientID        uuid.UUID
+	UserID          uuid.UUID
+	RedirectUri     string
+	RedirectUriSent bool
+	Scopes          []string
+	CodeChallenge   string
+	ExpiresAt       time.Time
+}
+
+func (q *Queries) CreateOAuthCode(ctx context.Context, arg CreateOAuthCodeParams) error {
+	_, err := q.db.ExecContext(ctx, createOAuthCode,
+		arg.CodeHash,
+		arg.ClientID,
+		arg.UserID,
+		arg.RedirectUri,
+		arg.RedirectUriSent,
+		pq.Array(arg.Scopes),
+		arg.CodeChallenge,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createOAuthSession = `-- name: CreateOAuthSession :one
+INSERT INTO sessions (id, user_id, user_agent, ip_address, device_label, created_at, last_used_at, revoked_at, client_id, scopes)
+VALUES (
+    gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW(), NULL, $5, $6
+)
+RETURNING id, user_id, user_agent, ip_address, device_label, created_at, last_used_at, revoked_at, client_id, scopes
+`
+
+type CreateOAuthSessionParams struct {
+	UserID      uuid.UUID
+	UserAgent   string
+	IpAddress   string
+	DeviceLabel string
+	ClientID    uuid.NullUUID
+	Scopes      []string
+}
+
+func (q *Queries) CreateOAuthSession(ctx context.Context, arg CreateOAuthSessionParams) (Session, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthSession,
+		arg.UserID,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.DeviceLabel,
+		arg.ClientID,
+		pq.Array(arg.Scopes),
+	)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.DeviceLabel,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const createReport = `-- name: CreateReport :one
+INSERT INTO reports (id, reporter_id, chirp_id, chirp_body, reported_user_id, category, details, status, created_at, resolved_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, 'open', NOW(), NULL)
+RETURNING id, reporter_id, chirp_id, chirp_body, reported_user_id, category, details, status, created_at, resolved_at
+`
+
+type CreateReportParams struct {
+	ReporterID     uuid.NullUUID
+	ChirpID        uuid.NullUUID
+	ChirpBody      sql.NullString
+	ReportedUserID uuid.UUID
+	Category       string
+	Details        string
+}
+
+func (q *Queries) CreateReport(ctx context.Context, arg CreateReportParams) (Report, error) {
+	row := q.db.QueryRowContext(ctx, createReport,
+		arg.ReporterID,
+		arg.ChirpID,
+		arg.ChirpBody,
+		arg.ReportedUserID,
+		arg.Category,
+		arg.Details,
+	)
+	var i Report
+	err := row.Scan(
+		&i.ID,
+		&i.ReporterID,
+		&i.ChirpID,
+		&i.ChirpBody,
+		&i.ReportedUserID,
+		&i.Category,
+		&i.Details,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ResolvedAt,
+	)
+	return i, err
+}
+
+const createReportAction = `-- name: CreateReportAction :one
+INSERT INTO report_actions (id, report_id, moderator_id, action, note, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW())
+RETURNING id, report_id, moderator_id, action, note, created_at
+`
+
+type CreateReportActionParams struct {
+	ReportID    uuid.UUID
+	ModeratorID uuid.NullUUID
+	Action      string
+	Note        string
+}
+
+func (q *Queries) CreateReportAction(ctx context.Context, arg CreateReportActionParams) (ReportAction, error) {
+	row := q.db.QueryRowContext(ctx, createReportAction,
+		arg.ReportID,
+		arg.ModeratorID,
+		arg.Action,
+		arg.Note,
+	)
+	var i ReportAction
+	err := row.Scan(
+		&i.ID,
+		&i.ReportID,
+		&i.ModeratorID,
+		&i.Action,
+		&i.Note,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createSession = `-- name: CreateSession :one
+INSERT INTO sessions (id, user_id, user_agent, ip_address, device_label, created_at, last_used_at, revoked_at)
+VALUES (
+    gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW(), NULL
+)
+RETURNING id, user_id, user_agent, ip_address, device_label, created_at, last_used_at, revoked_at, client_id, scopes
+`
+
+type CreateSessionParams struct {
+	UserID      uuid.UUID
+	UserAgent   string
+	IpAddress   string
+	DeviceLabel string
+}
+
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
+	row := q.db.QueryRowContext(ctx, createSession,
+		arg.UserID,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.DeviceLabel,
+	)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.DeviceLabel,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const createUser = `-- name: CreateUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3
+)
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, email_verified_at, role, suspended_until, status
+`
+
+type CreateUserParams struct {
+	Email          string
+	HashedPassword string
+	Username       sql.NullString
+}
+
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.Status,
+	)
+	return i, err
+}
+
+const deleteAllUsers = `-- name: DeleteAllUsers :exec
+DELETE FROM users
+`
+
+func (q *Queries) DeleteAllUsers(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteAllUsers)
+	return err
+}
+
+const deleteChirp = `-- name: DeleteChirp :execrows
+DELETE FROM chirps
+WHERE id = $1
+AND NOT EXISTS (
+    SELECT 1 FROM chirps replies WHERE replies.in_reply_to = $1
+)
+`
+
+func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteExpiredOAuthCodes = `-- name: DeleteExpiredOAuthCodes :exec
+DELETE FROM oauth_codes
+WHERE expires_at < $1
+`
+
+func (q *Queries) DeleteExpiredOAuthCodes(ctx context.Context, expiresAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteExpiredOAuthCodes, expiresAt)
+	return err
+}
+
+const deleteLoginFailures = `-- name: DeleteLoginFailures :exec
+DELETE FROM login_failures
+WHERE lock_key = $1
+`
+
+func (q *Queries) DeleteLoginFailures(ctx context.Context, lockKey string) error {
+	_, err := q.db.ExecContext(ctx, deleteLoginFailures, lockKey)
+	return err
+}
+
+const deleteModerationRule = `-- name: DeleteModerationRule :one
+DELETE FROM moderation_rules
+WHERE id = $1
+RETURNING id, pattern, action, created_by, created_at
+`
+
+func (q *Queries) DeleteModerationRule(ctx context.Context, id uuid.UUID) (ModerationRule, error) {
+	row := q.db.QueryRowContext(ctx, deleteModerationRule, id)
+	var i ModerationRule
+	err := row.Scan(
+		&i.ID,
+		&i.Pattern,
+		&i.Action,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteOAuthClient = `-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND owner_id = $2
+`
+
+type DeleteOAuthClientParams struct {
+	ID      uuid.UUID
+	OwnerID uuid.UUID
+}
+
+func (q *Queries) DeleteOAuthClient(ctx context.Context, arg DeleteOAuthClientParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOAuthClient, arg.ID, arg.OwnerID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteOldLoginFailures = `-- name: DeleteOldLoginFailures :exec
+DELETE FROM login_failures
+WHERE last_failure_at < $1
+AND (locked_until IS NULL OR locked_until <= $1)
+`
+
+func (q *Queries) DeleteOldLoginFailures(ctx context.Context, before time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteOldLoginFailures, before)
+	return err
+}
+
+const deleteRateLimitBuckets = `-- name: DeleteRateLimitBuckets :exec
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1
+`
+
+func (q *Queries) DeleteRateLimitBuckets(ctx context.Context, updatedAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, deleteRateLimitBuckets, updatedAt)
+	return err
+}
+
+const deleteRecoveryCodes = `-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRecoveryCodes, userID)
+	return err
+}
+
+const deleteTOTP = `-- name: DeleteTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteTOTP(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteTOTP, userID)
+	return err
+}
+
+const editChirp = `-- name: EditChirp :one
+WITH old AS (
+    SELECT id, body
+    FROM chirps
+    WHERE id = $1
+    AND created_at > NOW() - make_interval(secs => $2::float8)
+    FOR UPDATE
+), saved AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+    SELECT gen_random_uuid(), old.id, old.body, NOW()
+    FROM old
+)
+UPDATE chirps
+SET body = $3, updated_at = NOW(), revision_count = chirps.revision_count + 1
+FROM old
+WHERE chirps.id = old.id
+RETURNING chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.thread_root_id, chirps.deleted_at, chirps.kind, chirps.reference_id, chirps.revision_count, chirps.hidden_at
+`
+
+type EditChirpParams struct {
+	ID                uuid.UUID
+	EditWindowSeconds float64
+	Body              string
+}
+
+func (q *Queries) EditChirp(ctx context.Context, arg EditChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, editChirp, arg.ID, arg.EditWindowSeconds, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.ThreadRootID,
+		&i.DeletedAt,
+		&i.Kind,
+		&i.ReferenceID,
+		&i.RevisionCount,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const expireEmailTokens = `-- name: ExpireEmailTokens :exec
+UPDATE email_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+`
+
+type ExpireEmailTokensParams struct {
+	UserID  uuid.UUID
+	Purpose string
+}
+
+func (q *Queries) ExpireEmailTokens(ctx context.Context, arg ExpireEmailTokensParams) error {
+	_, err := q.db.ExecContext(ctx, expireEmailTokens, arg.UserID, arg.Purpose)
+	return err
+}
+
+const followUser = `-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (follower_id, followee_id) DO NOTHING
+`
+
+type FollowUserParams struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+}
+
+func (q *Queries) FollowUser(ctx context.Context, arg FollowUserParams) error {
+	_, err := q.db.ExecContext(ctx, followUser, arg.FollowerID, arg.FolloweeID)
+	return err
+}
+
+const forgiveLoginFailure = `-- name: ForgiveLoginFailure :exec
+UPDATE login_failures
+SET failures = GREATEST(failures - 1, 0), locked_until = NULL
+WHERE lock_key = $1
+`
+
+func (q *Queries) ForgiveLoginFailure(ctx context.Context, lockKey string) error {
+	_, err := q.db.ExecContext(ctx, forgiveLoginFailure, lockKey)
+	return err
+}
+
+const getAccessTokenByHash = `-- name: GetAccessTokenByHash :one
+SELECT id, user_id, name, token_hash, scopes, created_at, expires_at, last_used_at, revoked_at
+FROM access_tokens
+WHERE token_hash = $1
+`
+
+func (q *Queries) GetAccessTokenByHash(ctx context.Context, tokenHash string) (AccessToken, error) {
+	row := q.db.QueryRowContext(ctx, getAccessTokenByHash, tokenHash)
+	var i AccessToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		pq.Array(&i.Scopes),
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const getChirp = `-- name: GetChirp :one
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, thread_root_id, deleted_at, kind, reference_id, revision_count, hidden_at 
+FROM chirps
+WHERE ID = $1
+`
+
+func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.ThreadRootID,
+		&i.DeletedAt,
+		&i.Kind,
+		&i.ReferenceID,
+		&i.RevisionCount,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT c.id, c.in_reply_to, 1 AS depth
+    FROM chirps c
+    WHERE c.id = (SELECT p.in_reply_to FROM chirps p WHERE p.id = $1)
+    UNION ALL
+    SELECT c.id, c.in_reply_to, a.depth + 1
+    FROM chirps c
+    JOIN ancestors a ON c.id = a.in_reply_to
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.thread_root_id, chirps.deleted_at, chirps.kind, chirps.reference_id, chirps.revision_count, chirps.hidden_at
+FROM chirps
+JOIN ancestors ON ancestors.id = chirps.id
+ORDER BY ancestors.depth DESC
+`
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ThreadRootID,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.ReferenceID,
+			&i.RevisionCount,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpDescendants = `-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT c.id, 1 AS depth, ARRAY[to_char(c.created_at, 'YYYYMMDDHH24MISSUS') || c.id::text] AS path
+    FROM chirps c
+    WHERE c.in_reply_to = $1
+    UNION ALL
+    SELECT c.id, d.depth + 1, d.path || (to_char(c.created_at, 'YYYYMMDDHH24MISSUS') || c.id::text)
+    FROM chirps c
+    JOIN descendants d ON c.in_reply_to = d.id
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.thread_root_id, chirps.deleted_at, chirps.kind, chirps.reference_id, chirps.revision_count, chirps.hidden_at, descendants.depth::int AS depth
+FROM chirps
+JOIN descendants ON descendants.id = chirps.id
+ORDER BY descendants.path
+LIMIT $2
+OFFSET $3
+`
+
+type GetChirpDescendantsParams struct {
+	ID     uuid.UUID
+	Limit  int32
+	Offset int32
+}
+
+type GetChirpDescendantsRow struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Body          string
+	UserID        uuid.UUID
+	SearchVector  interface{}
+	InReplyTo     uuid.NullUUID
+	ThreadRootID  uuid.NullUUID
+	DeletedAt     sql.NullTime
+	Kind          string
+	ReferenceID   uuid.NullUUID
+	RevisionCount int32
+	HiddenAt      sql.NullTime
+	Depth         int32
+}
+
+func (q *Queries) GetChirpDescendants(ctx context.Context, arg GetChirpDescendantsParams) ([]GetChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpDescendants, arg.ID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpDescendantsRow
+	for rows.Next() {
+		var i GetChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ThreadRootID,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.ReferenceID,
+			&i.RevisionCount,
+			&i.HiddenAt,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirps = `-- name: GetChirps :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, thread_root_id, deleted_at, kind, reference_id, revision_count, hidden_at FROM chirps 
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ThreadRootID,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.ReferenceID,
+			&i.RevisionCount,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, thread_root_id, deleted_at, kind, reference_id, revision_count, hidden_at
+FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ThreadRootID,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.ReferenceID,
+			&i.RevisionCount,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getEmail = `-- name: GetEmail :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, email_verified_at, role, suspended_until, status
+FROM users
+WHERE email = $1
+`
+
+func (q *Queries) GetEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.Status,
+	)
+	return i, err
+}
+
+const getLastAuditHash = `-- name: GetLastAuditHash :one
+SELECT hash
+FROM audit_events
+ORDER BY id DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLastAuditHash(ctx context.Context) (string, error) {
+	row := q.db.QueryRowContext(ctx, getLastAuditHash)
+	var hash string
+	err := row.Scan(&hash)
+	return hash, err
+}
+
+const getLoginFailures = `-- name: GetLoginFailures :one
+SELECT lock_key, failures, last_failure_at, locked_until
+FROM login_failures
+WHERE lock_key = $1
+`
+
+func (q *Queries) GetLoginFailures(ctx context.Context, lockKey string) (LoginFailure, error) {
+	row := q.db.QueryRowContext(ctx, getLoginFailures, lockKey)
+	var i LoginFailure
+	err := row.Scan(
+		&i.LockKey,
+		&i.Failures,
+		&i.LastFailureAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const getNotification = `-- name: GetNotification :one
+SELECT id, user_id, kind, actor_id, chirp_id, group_key, created_at, read_at
+FROM notifications
+WHERE id = $1 AND user_id = $2
+`
+
+type GetNotificationParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) GetNotification(ctx context.Context, arg GetNotificationParams) (Notification, error) {
+	row := q.db.QueryRowContext(ctx, getNotification, arg.ID, arg.UserID)
+	var i Notification
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Kind,
+		&i.ActorID,
+		&i.ChirpID,
+		&i.GroupKey,
+		&i.CreatedAt,
+		&i.ReadAt,
+	)
+	return i, err
+}
+
+const getOAuthClient = `-- name: GetOAuthClient :one
+SELECT id, owner_id, name, secret_hash, redirect_uris, created_at
+FROM oauth_clients
+WHERE id = $1
+`
+
+func (q *Queries) GetOAuthClient(ctx context.Context, id uuid.UUID) (OauthClient, error) {
+	row := q.db.QueryRowContext(ctx, getOAuthClient, id)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.Name,
+		&i.SecretHash,
+		pq.Array(&i.RedirectUris),
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getOAuthCode = `-- name: GetOAuthCode :one
+SELECT code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at, used_at, session_id, redirect_uri_sent
+FROM oauth_codes
+WHERE code_hash = $1
+`
+
+func (q *Queries) GetOAuthCode(ctx context.Context, codeHash string) (OauthCode, error) {
+	row := q.db.QueryRowContext(ctx, getOAuthCode, codeHash)
+	var i OauthCode
+	err := row.Scan(
+		&i.CodeHash,
+		&i.ClientID,
+		&i.UserID,
+		&i.RedirectUri,
+		pq.Array(&i.Scopes),
+		&i.CodeChallenge,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.SessionID,
+		&i.RedirectUriSent,
+	)
+	return i, err
+}
+
+const getRateLimitBucket = `-- name: GetRateLimitBucket :one
+SELECT bucket_key, tokens, updated_at
+FROM rate_limit_buckets
+WHERE bucket_key = $1
+`
+
+func (q *Queries) GetRateLimitBucket(ctx context.Context, bucketKey string) (RateLimitBucket, error) {
+	row := q.db.QueryRowContext(ctx, getRateLimitBucket, bucketKey)
+	var i RateLimitBucket
+	err := row.Scan(&i.BucketKey, &i.Tokens, &i.UpdatedAt)
+	return i, err
+}
+
+const getReport = `-- name: GetReport :one
+SELECT id, reporter_id, chirp_id, chirp_body, reported_user_id, category, details, status, created_at, resolved_at
+FROM reports
+WHERE id = $1
+`
+
+func (q *Queries) GetReport(ctx context.Context, id uuid.UUID) (Report, error) {
+	row := q.db.QueryRowContext(ctx, getReport, id)
+	var i Report
+	err := row.Scan(
+		&i.ID,
+		&i.ReporterID,
+		&i.ChirpID,
+		&i.ChirpBody,
+		&i.ReportedUserID,
+		&i.Category,
+		&i.Details,
+		&i.Status,
+		&i.CreatedAt,
+		&i.ResolvedAt,
+	)
+	return i, err
+}
+
+const getSession = `-- name: GetSession :one
+SELECT id, user_id, user_agent, ip_address, device_label, created_at, last_used_at, revoked_at, client_id, scopes
+FROM sessions
+WHERE id = $1
+`
+
+func (q *Queries) GetSession(ctx context.Context, id uuid.UUID) (Session, error) {
+	row := q.db.QueryRowContext(ctx, getSession, id)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.DeviceLabel,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const getUser = `-- name: GetUser :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, email_verified_at, role, suspended_until, status
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.EmailVerifiedAt,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.Status,
+	)
+	return i, err
+}
+
+const getUserEmail = `-- name: GetUserEmail :one
+SELECT email
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserEmail(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRowContext(ctx, getUserEmail, id)
+	var email string
+	err := row.Scan(&email)
+	return email, err
+}
+
+const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :many
+SELECT user_id, expires_at, revoked_at, family_id
+FROM refresh_tokens
+WHERE token = $1
+`
+
+type GetUserFromRefreshTokenRow struct {
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+	FamilyID  uuid.UUID
+}
+
+func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) ([]GetUserFromRefreshTokenRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserFromRefreshToken, token)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserFromRefreshTokenRow
+	for rows.Next() {
+		var i GetUserFromRefreshTokenRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.FamilyID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserOfChirp = `-- name: GetUserOfChirp :one
+SELECT user_id
+FROM chirps
+WHERE id = $1
+`
+
+func (q *Queries) GetUserOfChirp(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, getUserOfChirp, id)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const getUserRole = `-- name: GetUserRole :one
+SELECT role
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserRole(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRowContext(ctx, getUserRole, id)
+	var role string
+	err := row.Scan(&role)
+	return role, err
+}
+
+const getUsersByUsernames = `-- name: GetUsersByUsernames :many
+SELECT id, username
+FROM users
+WHERE username = ANY($1::text[])
+`
+
+type GetUsersByUsernamesRow struct {
+	ID       uuid.UUID
+	Username sql.NullString
+}
+
+func (q *Queries) GetUsersByUsernames(ctx context.Context, usernames []string) ([]GetUsersByUsernamesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByUsernames, pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersByUsernamesRow
+	for rows.Next() {
+		var i GetUsersByUsernamesRow
+		if err := rows.Scan(&i.ID, &i.Username); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserState = `-- name: GetUserState :one
+SELECT status, suspended_until, role
+FROM users
+WHERE id = $1
+`
+
+type GetUserStateRow struct {
+	Status         string
+	SuspendedUntil sql.NullTime
+	Role           string
+}
+
+func (q *Queries) GetUserState(ctx context.Context, id uuid.UUID) (GetUserStateRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserState, id)
+	var i GetUserStateRow
+	err := row.Scan(&i.Status, &i.SuspendedUntil, &i.Role)
+	return i, err
+}
+
+const getUserTOTP = `-- name: GetUserTOTP :one
+SELECT user_id, secret, confirmed_at, last_counter, created_at
+FROM user_totp
+WHERE user_id = $1
+`
+
+func (q *Queries) GetUserTOTP(ctx context.Context, userID uuid.UUID) (UserTotp, error) {
+	row := q.db.QueryRowContext(ctx, getUserTOTP, userID)
+	var i UserTotp
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastCounter,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const hideChirp = `-- name: HideChirp :execrows
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE id = $1 AND hidden_at IS NULL
+`
+
+func (q *Queries) HideChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, hideChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const isChirpyRed = `-- name: IsChirpyRed :one
+SELECT is_chirpy_red
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) IsChirpyRed(ctx context.Context, id uuid.UUID) (sql.NullBool, error) {
+	row := q.db.QueryRowContext(ctx, isChirpyRed, id)
+	var is_chirpy_red sql.NullBool
+	err := row.Scan(&is_chirpy_red)
+	return is_chirpy_red, err
+}
+
+const likeChirp = `-- name: LikeChirp :exec
+INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING
+`
+
+type LikeChirpParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
+}
+
+func (q *Queries) LikeChirp(ctx context.Context, arg LikeChirpParams) error {
+	_, err := q.db.ExecContext(ctx, likeChirp, arg.UserID, arg.ChirpID)
+	return err
+}
+
+const likedChirpIDs = `-- name: LikedChirpIDs :many
+SELECT chirp_id
+FROM chirp_likes
+WHERE user_id = $1
+AND chirp_id = ANY($2::uuid[])
+`
+
+type LikedChirpIDsParams struct {
+	UserID   uuid.UUID
+	ChirpIds []uuid.UUID
+}
+
+func (q *Queries) LikedChirpIDs(ctx context.Context, arg LikedChirpIDsParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, likedChirpIDs, arg.UserID, pq.Array(arg.ChirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var chirp_id uuid.UUID
+		if err := rows.Scan(&chirp_id); err != nil {
+			return nil, err
+		}
+		items = append(items, chirp_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAccessTokens = `-- name: ListAccessTokens :many
+SELECT id, user_id, name, token_hash, scopes, created_at, expires_at, last_used_at, revoked_at
+FROM access_tokens
+WHERE user_id = $1 AND revoked_at IS NULL
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListAccessTokens(ctx context.Context, userID uuid.UUID) ([]AccessToken, error) {
+	rows, err := q.db.QueryContext(ctx, listAccessTokens, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AccessToken
+	for rows.Next() {
+		var i AccessToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.TokenHash,
+			pq.Array(&i.Scopes),
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.LastUsedAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listActiveSessions = `-- name: ListActiveSessions :many
+SELECT id, user_id, user_agent, ip_address, device_label, created_at, last_used_at, revoked_at, client_id, scopes
+FROM sessions
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND EXISTS (
+    SELECT 1 FROM refresh_tokens
+    WHERE refresh_tokens.family_id = sessions.id
+    AND refresh_tokens.revoked_at IS NULL
+    AND refresh_tokens.expires_at > NOW()
+)
+ORDER BY last_used_at DESC
+`
+
+func (q *Queries) ListActiveSessions(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	rows, err := q.db.QueryContext(ctx, listActiveSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Session
+	for rows.Next() {
+		var i Session
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.DeviceLabel,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.RevokedAt,
+			&i.ClientID,
+			pq.Array(&i.Scopes),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditEvents = `-- name: ListAuditEvents :many
+SELECT id, created_at, action, actor_id, target_type, target_id, ip_address, request_id, metadata, prev_hash, hash
+FROM audit_events
+WHERE ($1::text IS NULL OR action = $1 OR starts_with(action, $1 || '.'))
+AND ($2::uuid IS NULL OR actor_id = $2)
+AND ($3::text IS NULL OR target_type = $3)
+AND ($4::text IS NULL OR target_id = $4)
+AND ($5::text IS NULL OR ip_address = $5)
+AND ($6::text IS NULL OR request_id = $6)
+AND ($7::timestamp IS NULL OR created_at >= $7)
+AND ($8::timestamp IS NULL OR created_at < $8)
+AND ($9::bigint IS NULL OR id < $9)
+ORDER BY id DESC
+LIMIT $10
+`
+
+type ListAuditEventsParams struct {
+	Action     sql.NullString
+	ActorID    uuid.NullUUID
+	TargetType sql.NullString
+	TargetID   sql.NullString
+	IpAddress  sql.NullString
+	RequestID  sql.NullString
+	Since      sql.NullTime
+	Until      sql.NullTime
+	BeforeID   sql.NullInt64
+	Limit      int32
+}
+
+func (q *Queries) ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditEvents,
+		arg.Action,
+		arg.ActorID,
+		arg.TargetType,
+		arg.TargetID,
+		arg.IpAddress,
+		arg.RequestID,
+		arg.Since,
+		arg.Until,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Action,
+			&i.ActorID,
+			&i.TargetType,
+			&i.TargetID,
+			&i.IpAddress,
+			&i.RequestID,
+			&i.Metadata,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditEventsAfter = `-- name: ListAuditEventsAfter :many
+SELECT id, created_at, action, actor_id, target_type, target_id, ip_address, request_id, metadata, prev_hash, hash
+FROM audit_events
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2
+`
+
+type ListAuditEventsAfterParams struct {
+	ID    int64
+	Limit int32
+}
+
+func (q *Queries) ListAuditEventsAfter(ctx context.Context, arg ListAuditEventsAfterParams) ([]AuditEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditEventsAfter, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Action,
+			&i.ActorID,
+			&i.TargetType,
+			&i.TargetID,
+			&i.IpAddress,
+			&i.RequestID,
+			&i.Metadata,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpLikes = `-- name: ListChirpLikes :many
+SELECT user_id, created_at
+FROM chirp_likes
+WHERE chirp_id = $1
+AND (
+    $2::timestamp IS NULL
+    OR (created_at, user_id) < ($2::timestamp, $3::uuid)
+)
+ORDER BY created_at DESC, user_id DESC
+LIMIT $4
+`
+
+type ListChirpLikesParams struct {
+	ChirpID         uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+type ListChirpLikesRow struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+func (q *Queries) ListChirpLikes(ctx context.Context, arg ListChirpLikesParams) ([]ListChirpLikesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpLikes,
+		arg.ChirpID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpLikesRow
+	for rows.Next() {
+		var i ListChirpLikesRow
+		if err := rows.Scan(&i.UserID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpMentions = `-- name: ListChirpMentions :many
+SELECT chirp_id, user_id, start_offset, end_offset
+FROM chirp_mentions
+WHERE chirp_id = ANY($1::uuid[])
+ORDER BY chirp_id, start_offset
+`
+
+type ListChirpMentionsRow struct {
+	ChirpID     uuid.UUID
+	UserID      uuid.UUID
+	StartOffset int32
+	EndOffset   int32
+}
+
+func (q *Queries) ListChirpMentions(ctx context.Context, chirpIds []uuid.UUID) ([]ListChirpMentionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpMentions, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpMentionsRow
+	for rows.Next() {
+		var i ListChirpMentionsRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.UserID,
+			&i.StartOffset,
+			&i.EndOffset,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpRevisions = `-- name: ListChirpRevisions :many
+SELECT id, chirp_id, body, created_at
+FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]ChirpRevision, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpRevisions, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChirpRevision
+	for rows.Next() {
+		var i ChirpRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChirpID,
+			&i.Body,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, thread_root_id, deleted_at, kind, reference_id, revision_count, hidden_at
+FROM chirps
+WHERE deleted_at IS NULL
+AND hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, $1::uuid)
+AND ($2::uuid IS NULL OR user_id = $2::uuid)
+AND (
+    $3::timestamp IS NULL
+    OR (created_at, id) > ($3::timestamp, $4::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $5
+`
+
+type ListChirpsAscParams struct {
+	ViewerID        uuid.NullUUID
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.ViewerID,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ThreadRootID,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.ReferenceID,
+			&i.RevisionCount,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, thread_root_id, deleted_at, kind, reference_id, revision_count, hidden_at
+FROM chirps
+WHERE deleted_at IS NULL
+AND hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, $1::uuid)
+AND ($2::uuid IS NULL OR user_id = $2::uuid)
+AND (
+    $3::timestamp IS NULL
+    OR (created_at, id) < ($3::timestamp, $4::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $5
+`
+
+type ListChirpsDescParams struct {
+	ViewerID        uuid.NullUUID
+	AuthorID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.ViewerID,
+		arg.AuthorID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ThreadRootID,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.ReferenceID,
+			&i.RevisionCount,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFollowers = `-- name: ListFollowers :many
+SELECT follower_id AS user_id, created_at
+FROM follows
+WHERE followee_id = $1
+AND (
+    $2::timestamp IS NULL
+    OR (created_at, follower_id) < ($2::timestamp, $3::uuid)
+)
+ORDER BY created_at DESC, follower_id DESC
+LIMIT $4
+`
+
+type ListFollowersParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+type ListFollowersRow struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+func (q *Queries) ListFollowers(ctx context.Context, arg ListFollowersParams) ([]ListFollowersRow, error) {
+	rows, err := q.db.QueryContext(ctx, listFollowers,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFollowersRow
+	for rows.Next() {
+		var i ListFollowersRow
+		if err := rows.Scan(&i.UserID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFollowing = `-- name: ListFollowing :many
+SELECT followee_id AS user_id, created_at
+FROM follows
+WHERE follower_id = $1
+AND (
+    $2::timestamp IS NULL
+    OR (created_at, followee_id) < ($2::timestamp, $3::uuid)
+)
+ORDER BY created_at DESC, followee_id DESC
+LIMIT $4
+`
+
+type ListFollowingParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+type ListFollowingRow struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+func (q *Queries) ListFollowing(ctx context.Context, arg ListFollowingParams) ([]ListFollowingRow, error) {
+	rows, err := q.db.QueryContext(ctx, listFollowing,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFollowingRow
+	for rows.Next() {
+		var i ListFollowingRow
+		if err := rows.Scan(&i.UserID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listHashtagChirps = `-- name: ListHashtagChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.thread_root_id, chirps.deleted_at, chirps.kind, chirps.reference_id, chirps.revision_count, chirps.hidden_at
+FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE hashtags.tag = $1
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, $2::uuid)
+AND (
+    $3::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < ($3::timestamp, $4::uuid)
+)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $5
+`
+
+type ListHashtagChirpsParams struct {
+	Tag             string
+	ViewerID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListHashtagChirps(ctx context.Context, arg ListHashtagChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listHashtagChirps,
+		arg.Tag,
+		arg.ViewerID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ThreadRootID,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.ReferenceID,
+			&i.RevisionCount,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listHiddenUsers = `-- name: ListHiddenUsers :many
+SELECT id
+FROM users
+WHERE id = ANY($1::uuid[])
+AND status IN ('shadow_banned', 'deactivated')
+`
+
+func (q *Queries) ListHiddenUsers(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listHiddenUsers, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLoginFailures = `-- name: ListLoginFailures :many
+SELECT lock_key, failures, last_failure_at, locked_until
+FROM login_failures
+WHERE last_failure_at > $1 OR locked_until > $1
+ORDER BY last_failure_at DESC
+`
+
+func (q *Queries) ListLoginFailures(ctx context.Context, since time.Time) ([]LoginFailure, error) {
+	rows, err := q.db.QueryContext(ctx, listLoginFailures, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LoginFailure
+	for rows.Next() {
+		var i LoginFailure
+		if err := rows.Scan(
+			&i.LockKey,
+			&i.Failures,
+			&i.LastFailureAt,
+			&i.LockedUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listModerationRules = `-- name: ListModerationRules :many
+SELECT id, pattern, action, created_by, created_at
+FROM moderation_rules
+ORDER BY created_at
+`
+
+func (q *Queries) ListModerationRules(ctx context.Context) ([]ModerationRule, error) {
+	rows, err := q.db.QueryContext(ctx, listModerationRules)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ModerationRule
+	for rows.Next() {
+		var i ModerationRule
+		if err := rows.Scan(
+			&i.ID,
+			&i.Pattern,
+			&i.Action,
+			&i.CreatedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listNotificationGroups = `-- name: ListNotificationGroups :many
+SELECT
+    (array_agg(id ORDER BY created_at DESC))[1]::uuid AS id,
+    kind,
+    chirp_id,
+    COUNT(DISTINCT actor_id) AS actor_count,
+    COALESCE((array_agg(actor_id ORDER BY created_at DESC) FILTER (WHERE actor_id IS NOT NULL))[1:3], '{}')::uuid[] AS recent_actor_ids,
+    MAX(created_at)::timestamp AS latest_at,
+    COUNT(*) FILTER (WHERE read_at IS NULL) AS unread_count
+FROM notifications
+WHERE user_id = $1
+GROUP BY COALESCE(group_key, id::text), kind, chirp_id
+HAVING NOT $2::bool OR COUNT(*) FILTER (WHERE read_at IS NULL) > 0
+ORDER BY latest_at DESC, id DESC
+LIMIT $3 OFFSET $4
+`
+
+type ListNotificationGroupsParams struct {
+	UserID     uuid.UUID
+	UnreadOnly bool
+	Limit      int32
+	Offset     int32
+}
+
+type ListNotificationGroupsRow struct {
+	ID             uuid.UUID
+	Kind           string
+	ChirpID        uuid.NullUUID
+	ActorCount     int64
+	RecentActorIds []uuid.UUID
+	LatestAt       time.Time
+	UnreadCount    int64
+}
+
+func (q *Queries) ListNotificationGroups(ctx context.Context, arg ListNotificationGroupsParams) ([]ListNotificationGroupsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listNotificationGroups,
+		arg.UserID,
+		arg.UnreadOnly,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListNotificationGroupsRow
+	for rows.Next() {
+		var i ListNotificationGroupsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Kind,
+			&i.ChirpID,
+			&i.ActorCount,
+			pq.Array(&i.RecentActorIds),
+			&i.LatestAt,
+			&i.UnreadCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOAuthClients = `-- name: ListOAuthClients :many
+SELECT id, owner_id, name, secret_hash, redirect_uris, created_at
+FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListOAuthClients(ctx context.Context, ownerID uuid.UUID) ([]OauthClient, error) {
+	rows, err := q.db.QueryContext(ctx, listOAuthClients, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []OauthClient
+	for rows.Next() {
+		var i OauthClient
+		if err := rows.Scan(
+			&i.ID,
+			&i.OwnerID,
+			&i.Name,
+			&i.SecretHash,
+			pq.Array(&i.RedirectUris),
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReportActions = `-- name: ListReportActions :many
+SELECT id, report_id, moderator_id, action, note, created_at
+FROM report_actions
+WHERE report_id = ANY($1::uuid[])
+ORDER BY created_at ASC
+`
+
+func (q *Queries) ListReportActions(ctx context.Context, reportIds []uuid.UUID) ([]ReportAction, error) {
+	rows, err := q.db.QueryContext(ctx, listReportActions, pq.Array(reportIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReportAction
+	for rows.Next() {
+		var i ReportAction
+		if err := rows.Scan(
+			&i.ID,
+			&i.ReportID,
+			&i.ModeratorID,
+			&i.Action,
+			&i.Note,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReports = `-- name: ListReports :many
+SELECT id, reporter_id, chirp_id, chirp_body, reported_user_id, category, details, status, created_at, resolved_at
+FROM reports
+WHERE ($1::text IS NULL OR status = $1::text)
+AND ($2::text IS NULL OR category = $2::text)
+AND ($3::uuid IS NULL OR chirp_id = $3::uuid)
+AND ($4::uuid IS NULL OR reported_user_id = $4::uuid)
+AND (
+    $5::timestamp IS NULL
+    OR (created_at, id) > ($5::timestamp, $6::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $7
+`
+
+type ListReportsParams struct {
+	Status          sql.NullString
+	Category        sql.NullString
+	ChirpID         uuid.NullUUID
+	ReportedUserID  uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListReports(ctx context.Context, arg ListReportsParams) ([]Report, error) {
+	rows, err := q.db.QueryContext(ctx, listReports,
+		arg.Status,
+		arg.Category,
+		arg.ChirpID,
+		arg.ReportedUserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Report
+	for rows.Next() {
+		var i Report
+		if err := rows.Scan(
+			&i.ID,
+			&i.ReporterID,
+			&i.ChirpID,
+			&i.ChirpBody,
+			&i.ReportedUserID,
+			&i.Category,
+			&i.Details,
+			&i.Status,
+			&i.CreatedAt,
+			&i.ResolvedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserLikes = `-- name: ListUserLikes :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.thread_root_id, chirps.deleted_at, chirps.kind, chirps.reference_id, chirps.revision_count, chirps.hidden_at, chirp_likes.created_at AS liked_at
+FROM chirp_likes
+JOIN chirps ON chirps.id = chirp_likes.chirp_id
+WHERE chirp_likes.user_id = $1
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, $2::uuid)
+AND (
+    $3::timestamp IS NULL
+    OR (chirp_likes.created_at, chirps.id) < ($3::timestamp, $4::uuid)
+)
+ORDER BY chirp_likes.created_at DESC, chirps.id DESC
+LIMIT $5
+`
+
+type ListUserLikesParams struct {
+	UserID          uuid.UUID
+	ViewerID        uuid.NullUUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+type ListUserLikesRow struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Body          string
+	UserID        uuid.UUID
+	SearchVector  interface{}
+	InReplyTo     uuid.NullUUID
+	ThreadRootID  uuid.NullUUID
+	DeletedAt     sql.NullTime
+	Kind          string
+	ReferenceID   uuid.NullUUID
+	RevisionCount int32
+	HiddenAt      sql.NullTime
+	LikedAt       time.Time
+}
+
+func (q *Queries) ListUserLikes(ctx context.Context, arg ListUserLikesParams) ([]ListUserLikesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUserLikes,
+		arg.UserID,
+		arg.ViewerID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserLikesRow
+	for rows.Next() {
+		var i ListUserLikesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ThreadRootID,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.ReferenceID,
+			&i.RevisionCount,
+			&i.HiddenAt,
+			&i.LikedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserMentions = `-- name: ListUserMentions :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, thread_root_id, deleted_at, kind, reference_id, revision_count, hidden_at
+FROM chirps
+WHERE deleted_at IS NULL
+AND hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, NULL)
+AND EXISTS (
+    SELECT 1 FROM chirp_mentions
+    WHERE chirp_mentions.chirp_id = chirps.id
+    AND chirp_mentions.user_id = $1
+)
+AND (
+    $2::timestamp IS NULL
+    OR (created_at, id) < ($2::timestamp, $3::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListUserMentionsParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListUserMentions(ctx context.Context, arg ListUserMentionsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listUserMentions,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ThreadRootID,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.ReferenceID,
+			&i.RevisionCount,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockAuditEvents = `-- name: LockAuditEvents :exec
+SELECT pg_advisory_xact_lock(hashtext('audit_events'))
+`
+
+func (q *Queries) LockAuditEvents(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, lockAuditEvents)
+	return err
+}
+
+const markAllNotificationsRead = `-- name: MarkAllNotificationsRead :exec
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL
+`
+
+func (q *Queries) MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markAllNotificationsRead, userID)
+	return err
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :execrows
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+`
+
+type MarkEmailVerifiedParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markEmailVerified, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markNotificationGroupRead = `-- name: MarkNotificationGroupRead :exec
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1
+AND read_at IS NULL
+AND COALESCE(group_key, id::text) = (
+    SELECT COALESCE(n.group_key, n.id::text)
+    FROM notifications AS n
+    WHERE n.id = $2 AND n.user_id = $1
+)
+`
+
+type MarkNotificationGroupReadParams struct {
+	UserID uuid.UUID
+	ID     uuid.UUID
+}
+
+func (q *Queries) MarkNotificationGroupRead(ctx context.Context, arg MarkNotificationGroupReadParams) error {
+	_, err := q.db.ExecContext(ctx, markNotificationGroupRead, arg.UserID, arg.ID)
+	return err
+}
+
+const newChirp = `-- name: NewChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, thread_root_id, kind, reference_id)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5, $6
+)
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, thread_root_id, deleted_at, kind, reference_id, revision_count, hidden_at
+`
+
+type NewChirpParams struct {
+	Body         string
+	UserID       uuid.UUID
+	InReplyTo    uuid.NullUUID
+	ThreadRootID uuid.NullUUID
+	Kind         string
+	ReferenceID  uuid.NullUUID
+}
+
+func (q *Queries) NewChirp(ctx context.Context, arg NewChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, newChirp,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyTo,
+		arg.ThreadRootID,
+		arg.Kind,
+		arg.ReferenceID,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.ThreadRootID,
+		&i.DeletedAt,
+		&i.Kind,
+		&i.ReferenceID,
+		&i.RevisionCount,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const promoteFirstAdmin = `-- name: PromoteFirstAdmin :execrows
+UPDATE users
+SET role = 'admin', updated_at = NOW()
+WHERE email = $1
+AND NOT EXISTS (SELECT 1 FROM users WHERE role = 'admin')
+`
+
+func (q *Queries) PromoteFirstAdmin(ctx context.Context, email string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, promoteFirstAdmin, email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const refreshTokenExpiry = `-- name: RefreshTokenExpiry :one
+SELECT expires_at 
+FROM refresh_tokens
+WHERE user_id = $1
+`
+
+func (q *Queries) RefreshTokenExpiry(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	row := q.db.QueryRowContext(ctx, refreshTokenExpiry, userID)
+	var expires_at time.Time
+	err := row.Scan(&expires_at)
+	return expires_at, err
+}
+
+const rehashPassword = `-- name: RehashPassword :exec
+UPDATE users
+SET hashed_password = $1
+WHERE id = $2 AND hashed_password = $3
+`
+
+type RehashPasswordParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+func (q *Queries) RehashPassword(ctx context.Context, arg RehashPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashPassword, arg.NewHash, arg.ID, arg.OldHash)
+	return err
+}
+
+const resolveChirpReports = `-- name: ResolveChirpReports :exec
+UPDATE reports
+SET status = 'actioned', resolved_at = NOW()
+WHERE chirp_id = $1 AND status = 'open'
+`
+
+func (q *Queries) ResolveChirpReports(ctx context.Context, chirpID uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, resolveChirpReports, chirpID)
+	return err
+}
+
+const resolveReport = `-- name: ResolveReport :execrows
+UPDATE reports
+SET status = $2, resolved_at = NOW()
+WHERE id = $1 AND status = 'open'
+`
+
+type ResolveReportParams struct {
+	ID     uuid.UUID
+	Status string
+}
+
+func (q *Queries) ResolveReport(ctx context.Context, arg ResolveReportParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, resolveReport, arg.ID, arg.Status)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeAccessToken = `-- name: RevokeAccessToken :execrows
+UPDATE access_tokens
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeAccessTokenParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) RevokeAccessToken(ctx context.Context, arg RevokeAccessTokenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeAccessToken, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeOtherSessions = `-- name: RevokeOtherSessions :exec
+WITH tokens AS (
+    UPDATE refresh_tokens
+    SET updated_at = NOW(), revoked_at = NOW()
+    WHERE user_id = $1
+    AND revoked_at IS NULL
+    AND ($2::uuid IS NULL OR family_id <> $2::uuid)
+)
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND ($2::uuid IS NULL OR id <> $2::uuid)
+`
+
+type RevokeOtherSessionsParams struct {
+	UserID uuid.UUID
+	KeepID uuid.NullUUID
+}
+
+func (q *Queries) RevokeOtherSessions(ctx context.Context, arg RevokeOtherSessionsParams) error {
+	_, err := q.db.ExecContext(ctx, revokeOtherSessions, arg.UserID, arg.KeepID)
+	return err
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+WITH tokens AS (
+    UPDATE refresh_tokens
+    SET updated_at = NOW(), revoked_at = NOW()
+    WHERE family_id = (
+        SELECT s.id FROM sessions AS s
+        WHERE s.id = $1 AND s.user_id = $2
+    )
+    AND revoked_at IS NULL
+)
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeSession, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeToken = `-- name: RevokeToken :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE token = $1
+`
+
+func (q *Queries) RevokeToken(ctx context.Context, token string) error {
+	_, err := q.db.ExecContext(ctx, revokeToken, token)
+	return err
+}
+
+const revokeTokenFamily = `-- name: RevokeTokenFamily :exec
+WITH tokens AS (
+    UPDATE refresh_tokens
+    SET updated_at = NOW(), revoked_at = NOW()
+    WHERE family_id = $1 AND revoked_at IS NULL
+)
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeTokenFamily, familyID)
+	return err
+}
+
+const rotateOAuthRefreshToken = `-- name: RotateOAuthRefreshToken :one
+WITH old AS (
+    UPDATE refresh_tokens
+    SET revoked_at = NOW(), updated_at = NOW()
+    WHERE token = $1
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+    AND family_id IN (
+        SELECT id FROM sessions
+        WHERE revoked_at IS NULL AND client_id = $2
+    )
+    RETURNING user_id, family_id
+)
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
+SELECT $3, NOW(), NOW(), old.user_id, NOW() + INTERVAL '60 days', NULL, old.family_id
+FROM old
+RETURNING user_id, family_id
+`
+
+type RotateOAuthRefreshTokenParams struct {
+	Token    string
+	ClientID uuid.NullUUID
+	NewToken string
+}
+
+type RotateOAuthRefreshTokenRow struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RotateOAuthRefreshToken(ctx context.Context, arg RotateOAuthRefreshTokenParams) (RotateOAuthRefreshTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, rotateOAuthRefreshToken, arg.Token, arg.ClientID, arg.NewToken)
+	var i RotateOAuthRefreshTokenRow
+	err := row.Scan(&i.UserID, &i.FamilyID)
+	return i, err
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :one
+WITH old AS (
+    UPDATE refresh_tokens
+    SET revoked_at = NOW(), updated_at = NOW()
+    WHERE token = $1
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+    AND family_id IN (SELECT id FROM sessions WHERE revoked_at IS NULL AND client_id IS NULL)
+    RETURNING user_id, family_id
+)
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
+SELECT $2, NOW(), NOW(), old.user_id, NOW() + INTERVAL '60 days', NULL, old.family_id
+FROM old
+RETURNING user_id, family_id
+`
+
+type RotateRefreshTokenParams struct {
+	Token    string
+	NewToken string
+}
+
+type RotateRefreshTokenRow struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (RotateRefreshTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, rotateRefreshToken, arg.Token, arg.NewToken)
+	var i RotateRefreshTokenRow
+	err := row.Scan(&i.UserID, &i.FamilyID)
+	return i, err
+}
+
+const saveRefToken = `-- name: SaveRefToken :exec
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
+VALUES (
+    $1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', NULL, $3
+)
+`
+
+type SaveRefTokenParams struct {
+	Token    string
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) SaveRefToken(ctx context.Context, arg SaveRefTokenParams) error {
+	_, err := q.db.ExecContext(ctx, saveRefToken, arg.Token, arg.UserID, arg.FamilyID)
+	return err
+}
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.thread_root_id, chirps.deleted_at, chirps.kind, chirps.reference_id, chirps.revision_count, chirps.hidden_at,
+    ts_rank(search_vector, query)::real AS rank,
+    ts_headline('english', translate(body, E'\uE000\uE001', ''), query, E'StartSel=\uE000, StopSel=\uE001, MaxFragments=2')::text AS snippet
+FROM chirps, to_tsquery('english', $1) query
+WHERE search_vector @@ query
+AND deleted_at IS NULL
+AND hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, $2::uuid)
+AND ($3::uuid IS NULL OR user_id = $3::uuid)
+AND ($4::timestamp IS NULL OR created_at >= $4::timestamp)
+AND ($5::timestamp IS NULL OR created_at < $5::timestamp)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT $6
+OFFSET $7
+`
+
+type SearchChirpsParams struct {
+	Query    string
+	ViewerID uuid.NullUUID
+	AuthorID uuid.NullUUID
+	Since    sql.NullTime
+	Until    sql.NullTime
+	Limit    int32
+	Offset   int32
+}
+
+type SearchChirpsRow struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Body          string
+	UserID        uuid.UUID
+	SearchVector  interface{}
+	InReplyTo     uuid.NullUUID
+	ThreadRootID  uuid.NullUUID
+	DeletedAt     sql.NullTime
+	Kind          string
+	ReferenceID   uuid.NullUUID
+	RevisionCount int32
+	HiddenAt      sql.NullTime
+	Rank          float32
+	Snippet       string
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		arg.ViewerID,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []string
+	var items []SearchChirpsRow
 	for rows.Next() {
-		var body string
-		if err := rows.Scan(&body); err != nil {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ThreadRootID,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.ReferenceID,
+			&i.RevisionCount,
+			&i.HiddenAt,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
 			return nil, err
 		}
-		items = append(items, body)
+		items = append(items, i)
 	}
 	if err := rows.Close(); err != nil {
 		return nil, err
@@ -55,78 +3153,197 @@ func (q *Queries) ChirpsFrom(ctx context.Context, userID uuid.UUID) ([]string, e
 	return items, nil
 }
 
-const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
-VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
-)
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+const setOAuthCodeSession = `-- name: SetOAuthCodeSession :exec
+UPDATE oauth_codes
+SET session_id = $2
+WHERE code_hash = $1
 `
 
-type CreateUserParams struct {
-	Email          string
+type SetOAuthCodeSessionParams struct {
+	CodeHash  string
+	SessionID uuid.NullUUID
+}
+
+func (q *Queries) SetOAuthCodeSession(ctx context.Context, arg SetOAuthCodeSessionParams) error {
+	_, err := q.db.ExecContext(ctx, setOAuthCodeSession, arg.CodeHash, arg.SessionID)
+	return err
+}
+
+const setPassword = `-- name: SetPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetPasswordParams struct {
+	ID             uuid.UUID
 	HashedPassword string
 }
 
-func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
-	var i User
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Email,
-		&i.HashedPassword,
-		&i.IsChirpyRed,
-	)
-	return i, err
+func (q *Queries) SetPassword(ctx context.Context, arg SetPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, setPassword, arg.ID, arg.HashedPassword)
+	return err
 }
 
-const deleteAllUsers = `-- name: DeleteAllUsers :exec
-DELETE FROM users
+const setUsername = `-- name: SetUsername :exec
+UPDATE users
+SET username = $2, updated_at = NOW()
+WHERE id = $1
 `
 
-func (q *Queries) DeleteAllUsers(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, deleteAllUsers)
+type SetUsernameParams struct {
+	ID       uuid.UUID
+	Username sql.NullString
+}
+
+func (q *Queries) SetUsername(ctx context.Context, arg SetUsernameParams) error {
+	_, err := q.db.ExecContext(ctx, setUsername, arg.ID, arg.Username)
 	return err
 }
 
-const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM chirps
+const setUserRole = `-- name: SetUserRole :execrows
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserRole, arg.ID, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserState = `-- name: SetUserState :execrows
+UPDATE users
+SET status = $2, suspended_until = $3, updated_at = NOW()
 WHERE id = $1
 `
 
-func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirp, id)
+type SetUserStateParams struct {
+	ID             uuid.UUID
+	Status         string
+	SuspendedUntil sql.NullTime
+}
+
+func (q *Queries) SetUserState(ctx context.Context, arg SetUserStateParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserState, arg.ID, arg.Status, arg.SuspendedUntil)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const startTOTPEnrollment = `-- name: StartTOTPEnrollment :execrows
+INSERT INTO user_totp (user_id, secret, confirmed_at, last_counter, created_at)
+VALUES ($1, $2, NULL, 0, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_counter = 0, created_at = NOW()
+WHERE user_totp.confirmed_at IS NULL
+`
+
+type StartTOTPEnrollmentParams struct {
+	UserID uuid.UUID
+	Secret string
+}
+
+func (q *Queries) StartTOTPEnrollment(ctx context.Context, arg StartTOTPEnrollmentParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, startTOTPEnrollment, arg.UserID, arg.Secret)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const tagChirp = `-- name: TagChirp :exec
+WITH tags AS (
+    INSERT INTO hashtags (id, tag, created_at)
+    SELECT gen_random_uuid(), t, NOW()
+    FROM unnest($1::text[]) AS t
+    ON CONFLICT (tag) DO UPDATE SET tag = EXCLUDED.tag
+    RETURNING id
+)
+INSERT INTO chirp_hashtags (chirp_id, hashtag_id, created_at)
+SELECT $2, tags.id, NOW()
+FROM tags
+ON CONFLICT (chirp_id, hashtag_id) DO NOTHING
+`
+
+type TagChirpParams struct {
+	Tags    []string
+	ChirpID uuid.UUID
+}
+
+func (q *Queries) TagChirp(ctx context.Context, arg TagChirpParams) error {
+	_, err := q.db.ExecContext(ctx, tagChirp, pq.Array(arg.Tags), arg.ChirpID)
 	return err
 }
 
-const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id 
-FROM chirps
-WHERE ID = $1
+const takeRateLimitToken = `-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets (bucket_key, tokens, updated_at)
+VALUES ($1, $2::float8 - 1, $3)
+ON CONFLICT (bucket_key) DO UPDATE
+SET tokens = LEAST($2::float8, rate_limit_buckets.tokens + GREATEST(EXTRACT(EPOCH FROM EXCLUDED.updated_at - rate_limit_buckets.updated_at)::float8, 0) * $4::float8) - 1,
+    updated_at = GREATEST(EXCLUDED.updated_at, rate_limit_buckets.updated_at)
+WHERE LEAST($2::float8, rate_limit_buckets.tokens + GREATEST(EXTRACT(EPOCH FROM EXCLUDED.updated_at - rate_limit_buckets.updated_at)::float8, 0) * $4::float8) >= 1
+RETURNING tokens
 `
 
-func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirp, id)
-	var i Chirp
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Body,
-		&i.UserID,
+type TakeRateLimitTokenParams struct {
+	BucketKey string
+	Capacity  float64
+	Now       time.Time
+	Rate      float64
+}
+
+func (q *Queries) TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (float64, error) {
+	row := q.db.QueryRowContext(ctx, takeRateLimitToken,
+		arg.BucketKey,
+		arg.Capacity,
+		arg.Now,
+		arg.Rate,
 	)
-	return i, err
+	var tokens float64
+	err := row.Scan(&tokens)
+	return tokens, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps 
-ORDER BY created_at ASC
+const timelineChirps = `-- name: TimelineChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.search_vector, chirps.in_reply_to, chirps.thread_root_id, chirps.deleted_at, chirps.kind, chirps.reference_id, chirps.revision_count, chirps.hidden_at
+FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = $1
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, NULL)
+AND (
+    $2::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < ($2::timestamp, $3::uuid)
+)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type TimelineChirpsParams struct {
+	FollowerID      uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) TimelineChirps(ctx context.Context, arg TimelineChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, timelineChirps,
+		arg.FollowerID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -140,6 +3357,14 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.ThreadRootID,
+			&i.DeletedAt,
+			&i.Kind,
+			&i.ReferenceID,
+			&i.RevisionCount,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -154,61 +3379,83 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getEmail = `-- name: GetEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
-FROM users
-WHERE email = $1
+const tombstoneChirp = `-- name: TombstoneChirp :exec
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1
 `
 
-func (q *Queries) GetEmail(ctx context.Context, email string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getEmail, email)
-	var i User
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Email,
-		&i.HashedPassword,
-		&i.IsChirpyRed,
-	)
-	return i, err
+func (q *Queries) TombstoneChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, tombstoneChirp, id)
+	return err
 }
 
-const getUserEmail = `-- name: GetUserEmail :one
-SELECT email
-FROM users
+const touchAccessToken = `-- name: TouchAccessToken :exec
+UPDATE access_tokens
+SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+`
+
+func (q *Queries) TouchAccessToken(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, touchAccessToken, id)
+	return err
+}
+
+const touchSession = `-- name: TouchSession :exec
+UPDATE sessions
+SET last_used_at = NOW(), user_agent = $2, ip_address = $3
 WHERE id = $1
 `
 
-func (q *Queries) GetUserEmail(ctx context.Context, id uuid.UUID) (string, error) {
-	row := q.db.QueryRowContext(ctx, getUserEmail, id)
-	var email string
-	err := row.Scan(&email)
-	return email, err
+type TouchSessionParams struct {
+	ID        uuid.UUID
+	UserAgent string
+	IpAddress string
 }
 
-const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :many
-SELECT user_id, expires_at, revoked_at
-FROM refresh_tokens
-WHERE token = $1
+func (q *Queries) TouchSession(ctx context.Context, arg TouchSessionParams) error {
+	_, err := q.db.ExecContext(ctx, touchSession, arg.ID, arg.UserAgent, arg.IpAddress)
+	return err
+}
+
+const trendingHashtags = `-- name: TrendingHashtags :many
+SELECT hashtags.tag,
+    COUNT(*) AS uses,
+    SUM(POWER(0.5, EXTRACT(EPOCH FROM (NOW() - chirp_hashtags.created_at)) / $1::float8))::float8 AS score
+FROM chirp_hashtags
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+WHERE chirp_hashtags.created_at >= NOW() - make_interval(secs => $2::float8)
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, NULL)
+GROUP BY hashtags.tag
+ORDER BY score DESC, hashtags.tag ASC
+LIMIT $3
 `
 
-type GetUserFromRefreshTokenRow struct {
-	UserID    uuid.UUID
-	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+type TrendingHashtagsParams struct {
+	HalfLifeSeconds float64
+	WindowSeconds   float64
+	Limit           int32
 }
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) ([]GetUserFromRefreshTokenRow, error) {
-	rows, err := q.db.QueryContext(ctx, getUserFromRefreshToken, token)
+type TrendingHashtagsRow struct {
+	Tag   string
+	Uses  int64
+	Score float64
+}
+
+func (q *Queries) TrendingHashtags(ctx context.Context, arg TrendingHashtagsParams) ([]TrendingHashtagsRow, error) {
+	rows, err := q.db.QueryContext(ctx, trendingHashtags, arg.HalfLifeSeconds, arg.WindowSeconds, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetUserFromRefreshTokenRow
+	var items []TrendingHashtagsRow
 	for rows.Next() {
-		var i GetUserFromRefreshTokenRow
-		if err := rows.Scan(&i.UserID, &i.ExpiresAt, &i.RevokedAt); err != nil {
+		var i TrendingHashtagsRow
+		if err := rows.Scan(&i.Tag, &i.Uses, &i.Score); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -222,102 +3469,56 @@ func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) ([]
 	return items, nil
 }
 
-const getUserOfChirp = `-- name: GetUserOfChirp :one
-SELECT user_id
-FROM chirps
-WHERE id = $1
-`
-
-func (q *Queries) GetUserOfChirp(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
-	row := q.db.QueryRowContext(ctx, getUserOfChirp, id)
-	var user_id uuid.UUID
-	err := row.Scan(&user_id)
-	return user_id, err
-}
-
-const isChirpyRed = `-- name: IsChirpyRed :one
-SELECT is_chirpy_red
-FROM users
-WHERE id = $1
-`
-
-func (q *Queries) IsChirpyRed(ctx context.Context, id uuid.UUID) (sql.NullBool, error) {
-	row := q.db.QueryRowContext(ctx, isChirpyRed, id)
-	var is_chirpy_red sql.NullBool
-	err := row.Scan(&is_chirpy_red)
-	return is_chirpy_red, err
-}
-
-const newChirp = `-- name: NewChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
-)
-RETURNING id, created_at, updated_at, body, user_id
+const unfollowUser = `-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2
 `
 
-type NewChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+type UnfollowUserParams struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
 }
 
-func (q *Queries) NewChirp(ctx context.Context, arg NewChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, newChirp, arg.Body, arg.UserID)
-	var i Chirp
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Body,
-		&i.UserID,
-	)
-	return i, err
+func (q *Queries) UnfollowUser(ctx context.Context, arg UnfollowUserParams) error {
+	_, err := q.db.ExecContext(ctx, unfollowUser, arg.FollowerID, arg.FolloweeID)
+	return err
 }
 
-const refreshTokenExpiry = `-- name: RefreshTokenExpiry :one
-SELECT expires_at 
-FROM refresh_tokens
-WHERE user_id = $1
+const unlikeChirp = `-- name: UnlikeChirp :exec
+DELETE FROM chirp_likes
+WHERE user_id = $1 AND chirp_id = $2
 `
 
-func (q *Queries) RefreshTokenExpiry(ctx context.Context, userID uuid.UUID) (time.Time, error) {
-	row := q.db.QueryRowContext(ctx, refreshTokenExpiry, userID)
-	var expires_at time.Time
-	err := row.Scan(&expires_at)
-	return expires_at, err
+type UnlikeChirpParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
 }
 
-const revokeToken = `-- name: RevokeToken :exec
-UPDATE refresh_tokens
-SET updated_at = NOW(), revoked_at = NOW()
-WHERE token = $1
-`
-
-func (q *Queries) RevokeToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeToken, token)
+func (q *Queries) UnlikeChirp(ctx context.Context, arg UnlikeChirpParams) error {
+	_, err := q.db.ExecContext(ctx, unlikeChirp, arg.UserID, arg.ChirpID)
 	return err
 }
 
-const saveRefToken = `-- name: SaveRefToken :exec
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
-VALUES (
-    $1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', NULL
-)
+const untagChirp = `-- name: UntagChirp :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1
+AND hashtag_id NOT IN (SELECT id FROM hashtags WHERE tag = ANY($2::text[]))
 `
 
-type SaveRefTokenParams struct {
-	Token  string
-	UserID uuid.UUID
+type UntagChirpParams struct {
+	ChirpID uuid.UUID
+	Keep    []string
 }
 
-func (q *Queries) SaveRefToken(ctx context.Context, arg SaveRefTokenParams) error {
-	_, err := q.db.ExecContext(ctx, saveRefToken, arg.Token, arg.UserID)
+func (q *Queries) UntagChirp(ctx context.Context, arg UntagChirpParams) error {
+	_, err := q.db.ExecContext(ctx, untagChirp, arg.ChirpID, pq.Array(arg.Keep))
 	return err
 }
 
 const updateUser = `-- name: UpdateUser :exec
 UPDATE users
-SET email = $2, hashed_password = $3, updated_at = NOW()
+SET email = $2, hashed_password = $3, updated_at = NOW(),
+    email_verified_at = CASE WHEN email = $2 THEN email_verified_at END
 WHERE id = $1
 `
 
@@ -343,6 +3544,80 @@ func (q *Queries) UpgradeToRed(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const useEmailToken = `-- name: UseEmailToken :one
+UPDATE email_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+AND purpose = $2
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING user_id, email
+`
+
+type UseEmailTokenParams struct {
+	TokenHash string
+	Purpose   string
+}
+
+type UseEmailTokenRow struct {
+	UserID uuid.UUID
+	Email  string
+}
+
+func (q *Queries) UseEmailToken(ctx context.Context, arg UseEmailTokenParams) (UseEmailTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, useEmailToken, arg.TokenHash, arg.Purpose)
+	var i UseEmailTokenRow
+	err := row.Scan(&i.UserID, &i.Email)
+	return i, err
+}
+
+const useOAuthCode = `-- name: UseOAuthCode :one
+UPDATE oauth_codes
+SET used_at = NOW()
+WHERE code_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at, used_at, session_id, redirect_uri_sent
+`
+
+func (q *Queries) UseOAuthCode(ctx context.Context, codeHash string) (OauthCode, error) {
+	row := q.db.QueryRowContext(ctx, useOAuthCode, codeHash)
+	var i OauthCode
+	err := row.Scan(
+		&i.CodeHash,
+		&i.ClientID,
+		&i.UserID,
+		&i.RedirectUri,
+		pq.Array(&i.Scopes),
+		&i.CodeChallenge,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.SessionID,
+		&i.RedirectUriSent,
+	)
+	return i, err
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+`
+
+type UseRecoveryCodeParams struct {
+	UserID   uuid.UUID
+	CodeHash string
+}
+
+func (q *Queries) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useRecoveryCode, arg.UserID, arg.CodeHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const userFromToken = `-- name: UserFromToken :one
 SELECT user_id
 FROM refresh_tokens
@@ -355,3 +3630,22 @@ func (q *Queries) UserFromToken(ctx context.Context, token string) (uuid.UUID, e
 	err := row.Scan(&user_id)
 	return user_id, err
 }
+
+const useTOTPCounter = `-- name: UseTOTPCounter :execrows
+UPDATE user_totp
+SET last_counter = $2
+WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_counter < $2
+`
+
+type UseTOTPCounterParams struct {
+	UserID      uuid.UUID
+	LastCounter int64
+}
+
+func (q *Queries) UseTOTPCounter(ctx context.Context, arg UseTOTPCounterParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPCounter, arg.UserID, arg.LastCounter)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,129 @@
+// Package lockout counts failed attempts at something (like logging in)
+// and makes whoever is failing wait longer and longer between tries
+package lockout
+
+import (
+	"context"
+	"time"
+)
+
+// What's stored for each key, e.g. "email:user@example.com" or "ip:10.0.0.1"
+type Record struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Where failure counts are kept, Fail has to be atomic so attempts made in
+// parallel can't all get in before the lock starts
+type Store interface {
+	// Adds a failure and locks the key for as long as the policy says,
+	// unless it's already locked at now. Returns the record and whether the
+	// failure was added. The count starts again from 1 if the last failure
+	// was more than ResetAfter ago
+	Fail(ctx context.Context, key string, policy Policy, now time.Time) (Record, bool, error)
+	// Takes back one failure and the lock that came with it
+	Forgive(ctx context.Context, key string) error
+	// A zero Record if the key has no failures
+	Get(ctx context.Context, key string) (Record, error)
+	Delete(ctx context.Context, key string) error
+	// Every key that has failed since the given time or is still locked at it
+	List(ctx context.Context, since time.Time) ([]Record, error)
+	// Removes keys that haven't failed since before and aren't locked
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// How quickly failures turn into waiting
+type Policy struct {
+	// Failures allowed before any waiting
+	FreeAttempts int
+	// Wait after the first failure past the free ones, it doubles each time after that
+	BaseDelay time.Duration
+	// Longest anyone has to wait
+	MaxDelay time.Duration
+	// Failures are forgotten after this long without another one
+	ResetAfter time.Duration
+}
+
+// How long to lock for after this many failures
+func (p Policy) LockDuration(failures int) time.Duration {
+	if failures < p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Applies a policy to one kind of key, e.g. every email address
+type Guard struct {
+	store  Store
+	prefix string
+	policy Policy
+
+	// Tests can swap this for a fake clock
+	Now func() time.Time
+}
+
+func NewGuard(store Store, prefix string, policy Policy) *Guard {
+	return &Guard{
+		store:  store,
+		prefix: prefix,
+		policy: policy,
+		Now:    time.Now,
+	}
+}
+
+func (g *Guard) key(id string) string {
+	return g.prefix + ":" + id
+}
+
+// How long until id can try again, 0 if it can go ahead now
+func (g *Guard) Check(ctx context.Context, id string) (time.Duration, error) {
+	record, err := g.store.Get(ctx, g.key(id))
+	if err != nil {
+		return 0, err
+	}
+
+	wait := record.LockedUntil.Sub(g.Now())
+	if wait < 0 {
+		return 0, nil
+	}
+	return wait, nil
+}
+
+// Counts an attempt as a failure before it's tried, so a burst of attempts
+// can't all get in before the lock. Returns how long id has to wait if it's
+// locked out, then the attempt wasn't counted and shouldn't go ahead.
+// Attempts that work call Reset or Forgive afterwards
+func (g *Guard) Attempt(ctx context.Context, id string) (time.Duration, error) {
+	now := g.Now()
+
+	record, added, err := g.store.Fail(ctx, g.key(id), g.policy, now)
+	if err != nil {
+		return 0, err
+	}
+	if added {
+		return 0, nil
+	}
+
+	return max(record.LockedUntil.Sub(now), 0), nil
+}
+
+// Forgets id's failures, e.g. after a successful attempt
+func (g *Guard) Reset(ctx context.Context, id string) error {
+	return g.store.Delete(ctx, g.key(id))
+}
+
+// Takes back the failure Attempt counted, for keys that are shared and
+// shouldn't be reset by one success (like an address)
+func (g *Guard) Forgive(ctx context.Context, id string) error {
+	return g.store.Forgive(ctx, g.key(id))
+}
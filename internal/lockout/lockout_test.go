@@ -0,0 +1,141 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testPolicy = Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     10 * time.Second,
+	ResetAfter:   time.Hour,
+}
+
+func TestLockDuration(t *testing.T) {
+	assert.Equal(t, time.Duration(0), testPolicy.LockDuration(2))
+	assert.Equal(t, time.Second, testPolicy.LockDuration(3))
+	assert.Equal(t, 2*time.Second, testPolicy.LockDuration(4))
+	assert.Equal(t, 8*time.Second, testPolicy.LockDuration(6))
+	assert.Equal(t, 10*time.Second, testPolicy.LockDuration(7))
+	assert.Equal(t, 10*time.Second, testPolicy.LockDuration(100))
+}
+
+func TestGuardBacksOff(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	guard := NewGuard(store, "email", testPolicy)
+	guard.Now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		wait, err := guard.Attempt(ctx, "user@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Duration(0), wait)
+	}
+
+	// The third attempt goes ahead but locks for a second after it
+	wait, err := guard.Attempt(ctx, "user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+
+	wait, err = guard.Check(ctx, "user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, wait)
+
+	// Attempts while locked are turned away without counting
+	wait, err = guard.Attempt(ctx, "user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, wait)
+	record, err := store.Get(ctx, "email:user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, record.Failures)
+
+	// Other keys aren't affected
+	wait, err = guard.Check(ctx, "other@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+
+	// Once it's passed they can try again, and the next failure doubles the wait
+	now = now.Add(time.Second)
+	wait, err = guard.Attempt(ctx, "user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+
+	wait, err = guard.Check(ctx, "user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, wait)
+
+	// Unless the attempt worked and is forgiven
+	assert.NoError(t, guard.Forgive(ctx, "user@example.com"))
+	wait, err = guard.Check(ctx, "user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+	record, err = store.Get(ctx, "email:user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, record.Failures)
+
+	// A long quiet spell forgets the failures
+	now = now.Add(2 * time.Hour)
+	wait, err = guard.Attempt(ctx, "user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), wait)
+	record, err = store.Get(ctx, "email:user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, record.Failures)
+
+	// And so does a reset
+	assert.NoError(t, guard.Reset(ctx, "user@example.com"))
+	records, err := store.List(ctx, now.Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestGuardParallelAttempts(t *testing.T) {
+	ctx := context.Background()
+	guard := NewGuard(NewMemoryStore(), "email", testPolicy)
+
+	// Only the free attempts get through, however many are made at once
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := guard.Attempt(ctx, "user@example.com")
+			assert.NoError(t, err)
+			if wait == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(testPolicy.FreeAttempts), allowed.Load())
+}
+
+func TestMemoryStorePrune(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+
+	_, _, err := store.Fail(ctx, "email:old@example.com", testPolicy, now.Add(-2*time.Hour))
+	assert.NoError(t, err)
+	_, _, err = store.Fail(ctx, "email:new@example.com", testPolicy, now)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Prune(ctx, now.Add(-time.Hour)))
+
+	record, err := store.Get(ctx, "email:old@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, record.Failures)
+	record, err = store.Get(ctx, "email:new@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, record.Failures)
+}
@@ -0,0 +1,94 @@
+package lockout
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Keeps failures in memory, fine for a single server and for tests
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]Record{}}
+}
+
+func (s *MemoryStore) Fail(ctx context.Context, key string, policy Policy, now time.Time) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if record.LockedUntil.After(now) {
+		return record, false, nil
+	}
+	if !ok || record.LastFailureAt.Before(now.Add(-policy.ResetAfter)) {
+		record = Record{Key: key}
+	}
+	record.Failures++
+	record.LastFailureAt = now
+	record.LockedUntil = time.Time{}
+	if lock := policy.LockDuration(record.Failures); lock > 0 {
+		record.LockedUntil = now.Add(lock)
+	}
+	s.records[key] = record
+
+	return record, true, nil
+}
+
+func (s *MemoryStore) Forgive(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok {
+		return nil
+	}
+	record.Failures = max(record.Failures-1, 0)
+	record.LockedUntil = time.Time{}
+	s.records[key] = record
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[key], nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, since time.Time) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := []Record{}
+	for _, record := range s.records {
+		if record.LastFailureAt.After(since) || record.LockedUntil.After(since) {
+			records = append(records, record)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].LastFailureAt.After(records[j].LastFailureAt) })
+	return records, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, record := range s.records {
+		if record.LastFailureAt.Before(before) && !record.LockedUntil.After(before) {
+			delete(s.records, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/database"
+)
+
+// Keeps failures in the login_failures table so every server sees the same counts
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Counting and locking happen in one statement, times are UTC so servers
+// in different time zones agree
+func (s *PostgresStore) Fail(ctx context.Context, key string, policy Policy, now time.Time) (Record, bool, error) {
+	now = now.UTC()
+	row, err := s.db.AddLoginFailure(ctx, database.AddLoginFailureParams{
+		LockKey:          key,
+		Now:              now,
+		FreeAttempts:     int32(policy.FreeAttempts),
+		MaxDelaySeconds:  policy.MaxDelay.Seconds(),
+		BaseDelaySeconds: policy.BaseDelay.Seconds(),
+		Since:            now.Add(-policy.ResetAfter),
+	})
+	if err == nil {
+		return recordFromDB(row), true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Record{}, false, err
+	}
+
+	// Nothing was updated because it's locked, this is only to say how long for
+	record, err := s.Get(ctx, key)
+	return record, false, err
+}
+
+func (s *PostgresStore) Forgive(ctx context.Context, key string) error {
+	return s.db.ForgiveLoginFailure(ctx, key)
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Record, error) {
+	row, err := s.db.GetLoginFailures(ctx, key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Record{}, nil
+		}
+		return Record{}, err
+	}
+	return recordFromDB(row), nil
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, key string) error {
+	return s.db.DeleteLoginFailures(ctx, key)
+}
+
+func (s *PostgresStore) List(ctx context.Context, since time.Time) ([]Record, error) {
+	rows, err := s.db.ListLoginFailures(ctx, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, recordFromDB(row))
+	}
+	return records, nil
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, before time.Time) error {
+	return s.db.DeleteOldLoginFailures(ctx, before.UTC())
+}
+
+func recordFromDB(row database.LoginFailure) Record {
+	return Record{
+		Key:           row.LockKey,
+		Failures:      int(row.Failures),
+		LastFailureAt: row.LastFailureAt,
+		LockedUntil:   row.LockedUntil.Time,
+	}
+}
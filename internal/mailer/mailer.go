@@ -0,0 +1,109 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// An email to send, plain text only
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Anything that can deliver email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Sends mail through an SMTP server
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// Username and password are optional, without them mail is sent unauthenticated
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{
+		addr: host + ":" + port,
+		from: from,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.addr, m.auth, envelopeAddress(m.from), []string{msg.To}, format(m.from, msg))
+}
+
+// Doesn't send anything, it logs each message and writes it to a file in
+// Dir (if set) so links in them can be clicked during development or read by tests
+type LogMailer struct {
+	Dir  string
+	From string
+
+	count atomic.Int64
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Mail to %s: %s", msg.To, msg.Subject)
+
+	if m.Dir == "" {
+		log.Print(msg.Body)
+		return nil
+	}
+
+	err := os.MkdirAll(m.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	// Timestamp first so the files sort in the order they were sent
+	name := fmt.Sprintf("%s-%03d-%s.eml", time.Now().UTC().Format("20060102T150405"), m.count.Add(1), safeName(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg), 0o644)
+}
+
+// Builds the raw message with the headers mail servers expect
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// "Chirpy <no-reply@example.com>" -> "no-reply@example.com"
+func envelopeAddress(from string) string {
+	if start := strings.LastIndex(from, "<"); start >= 0 {
+		return strings.TrimSuffix(from[start+1:], ">")
+	}
+	return from
+}
+
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogMailerWritesFiles(t *testing.T) {
+	dir := t.TempDir()
+	m := &LogMailer{Dir: dir, From: "Chirpy <no-reply@chirpy.test>"}
+
+	err := m.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Verify your email",
+		Body:    "Your token is abc123",
+	})
+	assert.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	data, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "To: user@example.com\r\n")
+	assert.Contains(t, string(data), "Subject: Verify your email\r\n")
+	assert.Contains(t, string(data), "Your token is abc123")
+}
+
+func TestEnvelopeAddress(t *testing.T) {
+	assert.Equal(t, "no-reply@chirpy.test", envelopeAddress("Chirpy <no-reply@chirpy.test>"))
+	assert.Equal(t, "no-reply@chirpy.test", envelopeAddress("no-reply@chirpy.test"))
+}
@@ -0,0 +1,270 @@
+// Package moderation checks text against a list of words and phrases that
+// aren't allowed, with each one either masked out, rejected or flagged for
+// someone to look at. Matching ignores case, accents, lookalike letters,
+// leetspeak and repeated letters so the obvious ways around it don't work
+package moderation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// What happens to text that matches a rule
+type Action string
+
+const (
+	// Swap the matching words for ****
+	ActionMask Action = "mask"
+	// Refuse the text altogether
+	ActionReject Action = "reject"
+	// Let it through but put it in front of a moderator
+	ActionFlag Action = "flag"
+)
+
+func (a Action) Valid() bool {
+	return a == ActionMask || a == ActionReject || a == ActionFlag
+}
+
+// Which action wins when a text matches more than one rule
+func (a Action) severity() int {
+	switch a {
+	case ActionMask:
+		return 1
+	case ActionFlag:
+		return 2
+	case ActionReject:
+		return 3
+	}
+	return 0
+}
+
+// A word or phrase that isn't allowed. ID is blank for rules that didn't
+// come from the database
+type Rule struct {
+	ID      string
+	Pattern string
+	Action  Action
+}
+
+// A rule that matched and the bit of the text it matched
+type Match struct {
+	Rule Rule
+	Text string
+}
+
+type Result struct {
+	// The text with anything from a mask rule replaced
+	Text string
+	// The most severe action out of every rule that matched, blank if none did
+	Action  Action
+	Matches []Match
+}
+
+func (r Result) Rejected() bool {
+	return r.Action == ActionReject
+}
+
+func (r Result) Flagged() bool {
+	return r.Action == ActionFlag
+}
+
+// Patterns of the rules that matched, without repeats
+func (r Result) Patterns() []string {
+	var patterns []string
+	seen := map[string]bool{}
+	for _, m := range r.Matches {
+		if !seen[m.Rule.Pattern] {
+			seen[m.Rule.Pattern] = true
+			patterns = append(patterns, m.Rule.Pattern)
+		}
+	}
+	return patterns
+}
+
+const mask = "****"
+
+type compiledRule struct {
+	rule  Rule
+	words []canonical
+}
+
+// A set of rules ready to check text against, safe to share between goroutines
+type Filter struct {
+	rules []compiledRule
+}
+
+func NewFilter(rules []Rule) (*Filter, error) {
+	f := &Filter{}
+	for _, rule := range rules {
+		if !rule.Action.Valid() {
+			return nil, fmt.Errorf("rule %q: unknown action %q", rule.Pattern, rule.Action)
+		}
+		var words []canonical
+		for _, w := range tokenise(rule.Pattern) {
+			words = append(words, w.full)
+		}
+		if len(words) == 0 {
+			return nil, fmt.Errorf("rule %q: pattern has no words in it", rule.Pattern)
+		}
+		f.rules = append(f.rules, compiledRule{rule: rule, words: words})
+	}
+	return f, nil
+}
+
+// The rules the filter was made from
+func (f *Filter) Rules() []Rule {
+	rules := make([]Rule, len(f.rules))
+	for i, c := range f.rules {
+		rules[i] = c.rule
+	}
+	return rules
+}
+
+func (f *Filter) Check(text string) Result {
+	result := Result{Text: text}
+	words := tokenise(text)
+	// Which bit of each word to mask, by the index of the word
+	masked := map[int]span{}
+
+	for _, c := range f.rules {
+		for i := 0; i+len(c.words) <= len(words); i++ {
+			spans, ok := matchAt(words[i:], c.words)
+			if !ok {
+				continue
+			}
+			start, end := spans[0].start, spans[len(spans)-1].end
+			result.Matches = append(result.Matches, Match{Rule: c.rule, Text: text[start:end]})
+			if c.rule.Action.severity() > result.Action.severity() {
+				result.Action = c.rule.Action
+			}
+			if c.rule.Action == ActionMask {
+				for j, s := range spans {
+					if _, done := masked[i+j]; !done {
+						masked[i+j] = s
+					}
+				}
+			}
+		}
+	}
+
+	if len(masked) > 0 {
+		var b strings.Builder
+		last := 0
+		for i := range words {
+			s, ok := masked[i]
+			if !ok {
+				continue
+			}
+			b.WriteString(text[last:s.start])
+			b.WriteString(mask)
+			last = s.end
+		}
+		b.WriteString(text[last:])
+		result.Text = b.String()
+	}
+	return result
+}
+
+// Do the words starting at the front of text match the pattern, and if so
+// which bit of each word matched
+func matchAt(text []word, pattern []canonical) ([]span, bool) {
+	spans := make([]span, len(pattern))
+	for i, p := range pattern {
+		switch {
+		case text[i].full.matches(p):
+			spans[i] = text[i].fullSpan
+		case text[i].core.matches(p):
+			spans[i] = text[i].coreSpan
+		default:
+			return nil, false
+		}
+	}
+	return spans, true
+}
+
+// Byte offsets into the text being checked
+type span struct {
+	start, end int
+}
+
+// A word in the text. The full word includes any symbols stuck to either
+// end of it, the core has them trimmed off, so "kerfuffle!" still matches
+// while "$hit" gets a chance as "shit" first
+type word struct {
+	full     canonical
+	fullSpan span
+	core     canonical
+	coreSpan span
+}
+
+func tokenise(text string) []word {
+	var words []word
+	start := -1
+	for i, r := range text {
+		if wordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			words = append(words, newWord(text, span{start, i}))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, newWord(text, span{start, len(text)}))
+	}
+	return words
+}
+
+func newWord(text string, full span) word {
+	core := full
+	s := text[full.start:full.end]
+	trimmed := strings.TrimLeftFunc(s, symbol)
+	core.start += len(s) - len(trimmed)
+	trimmed = strings.TrimRightFunc(trimmed, symbol)
+	core.end = core.start + len(trimmed)
+	return word{
+		full:     canonicalise(text[full.start:full.end]),
+		fullSpan: full,
+		core:     canonicalise(text[core.start:core.end]),
+		coreSpan: core,
+	}
+}
+
+func symbol(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !invisible(r)
+}
+
+// Reads rules from a file, one per line as the action then the pattern,
+// e.g. "mask kerfuffle" or "reject buy followers". Blank lines and lines
+// starting with # are skipped
+func ParseRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		action := Action(fields[0])
+		if !action.Valid() {
+			return nil, fmt.Errorf("line %d: unknown action %q", line, action)
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: missing pattern", line)
+		}
+		rules = append(rules, Rule{Pattern: strings.Join(fields[1:], " "), Action: action})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
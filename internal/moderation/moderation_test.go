@@ -0,0 +1,107 @@
+package moderation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFilter(t *testing.T) *Filter {
+	t.Helper()
+	f, err := NewFilter([]Rule{
+		{Pattern: "kerfuffle", Action: ActionMask},
+		{Pattern: "sharbert", Action: ActionMask},
+		{Pattern: "fornax", Action: ActionMask},
+		{Pattern: "buy followers", Action: ActionReject},
+		{Pattern: "crypto giveaway", Action: ActionFlag},
+		{Pattern: "ass", Action: ActionMask},
+	})
+	require.NoError(t, err)
+	return f
+}
+
+func TestCheckMasks(t *testing.T) {
+	f := newTestFilter(t)
+
+	tests := map[string]string{
+		"This is a kerfuffle opinion I need to share with the world":        "This is a **** opinion I need to share with the world",
+		"I hear Mastodon is better than Chirpy. sharbert I need to migrate": "I hear Mastodon is better than Chirpy. **** I need to migrate",
+		"Kerfuffle! What a KERFUFFLE.":                                      "****! What a ****.",
+		"nothing to see here":                                               "nothing to see here",
+		// Accents, lookalike Cyrillic letters and fullwidth letters
+		"kérfüfflé":      "****",
+		"k\u0435rfuffle": "****",
+		"ｆｏｒｎａｘ":         "****",
+		// Leetspeak, repeated letters and zero width spaces
+		"k3rfuffl3":             "****",
+		"f0rn@x":                "****",
+		"sharrrbbbert":          "****",
+		"ker\u200bfuffle is it": "**** is it",
+		// Repeats only count one way, "as" isn't "ass"
+		"as far as I know": "as far as I know",
+		"assss":            "****",
+	}
+	for text, want := range tests {
+		t.Run(text, func(t *testing.T) {
+			got := f.Check(text)
+			assert.Equal(t, want, got.Text)
+		})
+	}
+}
+
+// A lowercase l is just an l, otherwise "tilt" squashes down to "tit"
+func TestCheckLeavesLAlone(t *testing.T) {
+	f, err := NewFilter([]Rule{{Pattern: "tit", Action: ActionMask}})
+	require.NoError(t, err)
+
+	assert.Equal(t, "tilt the table", f.Check("tilt the table").Text)
+	assert.Equal(t, "****", f.Check("t1t").Text)
+}
+
+func TestCheckActions(t *testing.T) {
+	f := newTestFilter(t)
+
+	result := f.Check("clean chirp")
+	assert.Equal(t, Action(""), result.Action)
+	assert.Empty(t, result.Matches)
+
+	result = f.Check("Want to BUY   f0ll0wers? kerfuffle")
+	assert.True(t, result.Rejected())
+	assert.Equal(t, []string{"kerfuffle", "buy followers"}, result.Patterns())
+
+	// Flagged text is left alone apart from anything masked
+	result = f.Check("huge Crypto Giveaway, fornax")
+	assert.True(t, result.Flagged())
+	assert.Equal(t, "huge Crypto Giveaway, ****", result.Text)
+	require.Len(t, result.Matches, 2)
+	assert.Equal(t, "Crypto Giveaway", result.Matches[1].Text)
+
+	// Phrases have to be next to each other
+	result = f.Check("buy some new followers")
+	assert.False(t, result.Rejected())
+}
+
+func TestNewFilterErrors(t *testing.T) {
+	_, err := NewFilter([]Rule{{Pattern: "fine", Action: "ban"}})
+	assert.Error(t, err)
+
+	_, err = NewFilter([]Rule{{Pattern: "  ...  ", Action: ActionMask}})
+	assert.Error(t, err)
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader("# banned words\nmask kerfuffle\n\nreject  buy\tfollowers\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{Pattern: "kerfuffle", Action: ActionMask},
+		{Pattern: "buy followers", Action: ActionReject},
+	}, rules)
+
+	_, err = ParseRules(strings.NewReader("hide kerfuffle\n"))
+	assert.Error(t, err)
+
+	_, err = ParseRules(strings.NewReader("mask\n"))
+	assert.Error(t, err)
+}
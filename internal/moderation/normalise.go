@@ -0,0 +1,125 @@
+package moderation
+
+import (
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Letters from other scripts that look like plain ASCII ones. Normalising
+// takes care of accents and fullwidth letters but not these
+var lookalikes = map[rune]rune{
+	'а': 'a', 'α': 'a',
+	'в': 'b', 'β': 'b', 'ь': 'b',
+	'с': 'c', 'ς': 'c',
+	'е': 'e', 'ε': 'e',
+	'н': 'h',
+	'ι': 'i', 'і': 'i', 'ı': 'i',
+	'ј': 'j',
+	'κ': 'k', 'к': 'k',
+	'м': 'm',
+	'η': 'n',
+	'ο': 'o', 'о': 'o',
+	'ρ': 'p', 'р': 'p',
+	'г': 'r',
+	'ѕ': 's',
+	'τ': 't', 'т': 't',
+	'υ': 'u',
+	'ν': 'v',
+	'ω': 'w',
+	'χ': 'x', 'х': 'x',
+	'у': 'y',
+}
+
+// Digits and symbols people swap in for letters to get past filters
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'!': 'i',
+	'|': 'i',
+	'3': 'e',
+	'4': 'a',
+	'@': 'a',
+	'5': 's',
+	'$': 's',
+	'7': 't',
+	'+': 't',
+	'8': 'b',
+	'9': 'g',
+}
+
+// Case folds a word and splits accented and fullwidth letters into plain
+// ASCII ones plus combining accents, which are then dropped as invisible.
+// A Caser can't be shared between goroutines so each word gets its own
+func normalise(word string) string {
+	return norm.NFKD.String(cases.Fold().String(word))
+}
+
+// Folds a lookalike letter from another script to its ASCII one, then
+// swaps leetspeak for the letter it stands for
+func fold(r rune) rune {
+	if base, ok := lookalikes[r]; ok {
+		r = base
+	}
+	if letter, ok := leet[r]; ok {
+		r = letter
+	}
+	return r
+}
+
+// Characters that can sit inside a word without showing, like zero width
+// spaces and soft hyphens, plus combining accents
+func invisible(r rune) bool {
+	return unicode.Is(unicode.Cf, r) || unicode.Is(unicode.Mn, r)
+}
+
+// Can this rune be part of a word, symbols count when they're used as leetspeak
+func wordRune(r rune) bool {
+	if unicode.IsLetter(r) || unicode.IsDigit(r) || invisible(r) {
+		return true
+	}
+	_, ok := leet[r]
+	return ok
+}
+
+// A letter and how many times it was repeated in a row
+type run struct {
+	r rune
+	n int
+}
+
+// The folded form of a word with repeated letters squashed into runs,
+// so "kerrrfufffle" can still be matched against "kerfuffle"
+type canonical []run
+
+func canonicalise(word string) canonical {
+	var c canonical
+	for _, r := range normalise(word) {
+		if invisible(r) {
+			continue
+		}
+		r = fold(r)
+		if len(c) > 0 && c[len(c)-1].r == r {
+			c[len(c)-1].n++
+			continue
+		}
+		c = append(c, run{r: r, n: 1})
+	}
+	return c
+}
+
+// Does a word from the text match a word from a rule, the text is allowed
+// to repeat letters more than the rule does but not less. That way "ass"
+// doesn't match "as"
+func (c canonical) matches(pattern canonical) bool {
+	if len(c) != len(pattern) || len(c) == 0 {
+		return false
+	}
+	for i := range c {
+		if c[i].r != pattern[i].r || c[i].n < pattern[i].n {
+			return false
+		}
+	}
+	return true
+}
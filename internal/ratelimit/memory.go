@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Keeps buckets in memory, fine for a single server and for tests
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]Bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]Bucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, policy Policy, now time.Time) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := float64(policy.Limit)
+	if bucket, ok := s.buckets[key]; ok {
+		tokens = policy.Refill(bucket, now)
+	}
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	s.buckets[key] = Bucket{Tokens: tokens, UpdatedAt: now}
+	return tokens, allowed, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, bucket := range s.buckets {
+		if bucket.UpdatedAt.Before(before) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/database"
+)
+
+// Keeps buckets in the rate_limit_buckets table so every server shares them
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Refilling and taking happen in one statement, times are UTC so servers
+// in different time zones agree
+func (s *PostgresStore) Take(ctx context.Context, key string, policy Policy, now time.Time) (float64, bool, error) {
+	now = now.UTC()
+	tokens, err := s.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		BucketKey: key,
+		Capacity:  float64(policy.Limit),
+		Now:       now,
+		Rate:      policy.rate(),
+	})
+	if err == nil {
+		return tokens, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+
+	// Nothing was updated because the bucket is empty, this is only to
+	// work out how long until it isn't
+	bucket, err := s.db.GetRateLimitBucket(ctx, key)
+	if err != nil {
+		return 0, false, err
+	}
+	return policy.Refill(Bucket{Tokens: bucket.Tokens, UpdatedAt: bucket.UpdatedAt}, now), false, nil
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, before time.Time) error {
+	return s.db.DeleteRateLimitBuckets(ctx, before.UTC())
+}
@@ -0,0 +1,101 @@
+// Package ratelimit limits how often something (like posting a chirp) can
+// be done with token buckets. Each key gets a bucket of Limit tokens that
+// refills over Per, every request takes one and is refused when it's empty
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// e.g. 30 chirps a minute, the whole minute's worth can be used at once
+type Policy struct {
+	// Keeps different policies' buckets apart, e.g. "chirps"
+	Name  string
+	Limit int
+	Per   time.Duration
+}
+
+// Tokens added back per second
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Per.Seconds()
+}
+
+// A bucket as it was left, missing buckets are full
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// How many tokens the bucket has at now, never more than the limit
+func (p Policy) Refill(b Bucket, now time.Time) float64 {
+	elapsed := max(now.Sub(b.UpdatedAt).Seconds(), 0)
+	return min(float64(p.Limit), b.Tokens+elapsed*p.rate())
+}
+
+// Where buckets are kept, Take has to be atomic so requests made in
+// parallel can't take the same token
+type Store interface {
+	// Refills key's bucket and takes a token if there's a whole one,
+	// returns the tokens left and whether one was taken
+	Take(ctx context.Context, key string, policy Policy, now time.Time) (float64, bool, error)
+	// Removes buckets that haven't been used since before, they'd be full
+	// again by now if before is at least the longest policy's Per ago
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// What happened to a request, with what the RateLimit headers need
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// How long until a request would be allowed, 0 if this one was
+	RetryAfter time.Duration
+	// How long until the bucket is full again
+	Reset time.Duration
+}
+
+func (p Policy) result(tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     p.Limit,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     secondsToDuration((float64(p.Limit) - tokens) / p.rate()),
+	}
+	if !allowed {
+		res.RetryAfter = secondsToDuration((1 - tokens) / p.rate())
+	}
+	return res
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(max(s, 0) * float64(time.Second)))
+}
+
+// Applies policies to keys using a store
+type Limiter struct {
+	store Store
+
+	// Tests can swap this for a fake clock
+	Now func() time.Time
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store, Now: time.Now}
+}
+
+// Takes a token from id's bucket for policy if there's one left
+func (l *Limiter) Allow(ctx context.Context, policy Policy, id string) (Result, error) {
+	tokens, allowed, err := l.store.Take(ctx, policy.Name+":"+id, policy, l.Now())
+	if err != nil {
+		return Result{}, err
+	}
+	return policy.result(tokens, allowed), nil
+}
+
+// Forgets buckets that have been full for a while, longest is the longest
+// Per out of the policies in use
+func (l *Limiter) Prune(ctx context.Context, longest time.Duration) error {
+	return l.store.Prune(ctx, l.Now().Add(-longest))
+}
@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPolicy = Policy{Name: "chirps", Limit: 3, Per: 30 * time.Second}
+
+func newTestLimiter() (*Limiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(NewMemoryStore())
+	l.Now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestAllowUsesUpTheBucket(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestLimiter()
+
+	for want := 2; want >= 0; want-- {
+		res, err := l.Allow(ctx, testPolicy, "user-1")
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, want, res.Remaining)
+		assert.Zero(t, res.RetryAfter)
+	}
+
+	// One token comes back every 10 seconds
+	res, err := l.Allow(ctx, testPolicy, "user-1")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, 10*time.Second, res.RetryAfter)
+	assert.Equal(t, 30*time.Second, res.Reset)
+
+	// Other keys and other policies have their own buckets
+	res, err = l.Allow(ctx, testPolicy, "user-2")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	res, err = l.Allow(ctx, Policy{Name: "login", Limit: 1, Per: time.Minute}, "user-1")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestAllowRefills(t *testing.T) {
+	ctx := context.Background()
+	l, now := newTestLimiter()
+
+	for i := 0; i < 3; i++ {
+		_, err := l.Allow(ctx, testPolicy, "user-1")
+		require.NoError(t, err)
+	}
+
+	*now = now.Add(4 * time.Second)
+	res, err := l.Allow(ctx, testPolicy, "user-1")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 6*time.Second, res.RetryAfter)
+
+	*now = now.Add(6 * time.Second)
+	res, err = l.Allow(ctx, testPolicy, "user-1")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	// Never fills past the limit
+	*now = now.Add(time.Hour)
+	res, err = l.Allow(ctx, testPolicy, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Remaining)
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	l := NewLimiter(store)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l.Now = func() time.Time { return now }
+
+	_, err := l.Allow(ctx, testPolicy, "old")
+	require.NoError(t, err)
+	now = now.Add(time.Minute)
+	_, err = l.Allow(ctx, testPolicy, "new")
+	require.NoError(t, err)
+
+	require.NoError(t, l.Prune(ctx, 30*time.Second))
+	assert.Len(t, store.buckets, 1)
+	assert.Contains(t, store.buckets, "chirps:new")
+}
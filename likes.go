@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// One row of the list of users who liked a chirp
+type likeEntry struct {
+	UserID  uuid.UUID `json:"user_id"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+// Response envelope for the list of users who liked a chirp
+type likePage struct {
+	Users      []likeEntry `json:"users"`
+	Count      int64       `json:"count"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// Fills in like_count on each chirp, and liked_by_me when we know who is asking
+// Counts are worked out from chirp_likes every time so they can't drift
+func (cfg *ApiConfig) addLikeInfo(ctx context.Context, viewer uuid.NullUUID, chirps ...*Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+
+	counts, err := cfg.DBQueries.CountChirpLikes(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	countByID := make(map[uuid.UUID]int64, len(counts))
+	for _, row := range counts {
+		countByID[row.ChirpID] = row.LikeCount
+	}
+
+	for _, chirp := range chirps {
+		chirp.LikeCount = countByID[chirp.ID]
+	}
+
+	if !viewer.Valid {
+		return nil
+	}
+
+	liked, err := cfg.DBQueries.LikedChirpIDs(ctx, database.LikedChirpIDsParams{
+		UserID:   viewer.UUID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	likedByID := make(map[uuid.UUID]bool, len(liked))
+	for _, id := range liked {
+		likedByID[id] = true
+	}
+
+	for _, chirp := range chirps {
+		likedByMe := likedByID[chirp.ID]
+		chirp.LikedByMe = &likedByMe
+	}
+
+	return nil
+}
+
+// Reads the {chirpID} path value and makes sure the chirp exists, isn't deleted
+// and the viewer can see who wrote it. Writes the error response itself, callers just return when ok is false
+func (cfg *ApiConfig) targetChirp(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	chirp, ok := cfg.loadTargetChirp(w, r)
+	return chirp.ID, ok
+}
+
+// Same as targetChirp for callers that need the chirp itself
+func (cfg *ApiConfig) loadTargetChirp(w http.ResponseWriter, r *http.Request) (database.Chirp, bool) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Chirp ID format")
+		return database.Chirp{}, false
+	}
+
+	chirp, err := cfg.DBQueries.GetChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (chirp.DeletedAt.Valid || chirp.HiddenAt.Valid)) {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return database.Chirp{}, false
+	}
+	if err != nil {
+		log.Printf("Error finding chirp in database: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Error finding chirp")
+		return database.Chirp{}, false
+	}
+
+	// Chirps by shadow banned users are only there for their author
+	visible, err := cfg.canSeeChirpsBy(r.Context(), chirp.UserID, cfg.optionalUser(r))
+	if err != nil {
+		log.Printf("Error checking chirp author: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Error finding chirp")
+		return database.Chirp{}, false
+	}
+	if !visible {
+		respondWithError(w, http.StatusNotFound, "Chirp not found")
+		return database.Chirp{}, false
+	}
+
+	return chirp, true
+}
+
+// Likes a chirp as the authenticated user, liking twice is a no-op
+func (cfg *ApiConfig) likeChirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	if !cfg.requireVerifiedEmail(w, r, userID, restrictLike) {
+		return
+	}
+
+	chirpID, ok := cfg.targetChirp(w, r)
+	if !ok {
+		return
+	}
+
+	err = cfg.DBQueries.LikeChirp(r.Context(), database.LikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		log.Printf("Error liking chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to like chirp")
+		return
+	}
+
+	cfg.events.publish(r.Context(), event{
+		Kind:    eventLike,
+		ActorID: userID,
+		ChirpID: uuid.NullUUID{UUID: chirpID, Valid: true},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Removes the authenticated user's like from a chirp
+func (cfg *ApiConfig) unlikeChirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Chirp ID format")
+		return
+	}
+
+	err = cfg.DBQueries.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		log.Printf("Error unliking chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to unlike chirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists who liked a chirp, newest first, with the total count
+func (cfg *ApiConfig) getChirpLikes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	chirpID, ok := cfg.targetChirp(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListChirpLikesParams{
+		ChirpID: chirpID,
+		Limit:   int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	rows, err := cfg.DBQueries.ListChirpLikes(ctx, params)
+	if err != nil {
+		log.Printf("Error listing likes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch likes")
+		return
+	}
+
+	chirp := Chirp{ID: chirpID}
+	err = cfg.addLikeInfo(ctx, uuid.NullUUID{}, &chirp)
+	if err != nil {
+		log.Printf("Error counting likes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch likes")
+		return
+	}
+
+	resp := likePage{Users: []likeEntry{}, Count: chirp.LikeCount}
+	for i, row := range rows {
+		if i == page.Limit {
+			last := rows[i-1]
+			resp.NextCursor = encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.UserID})
+			break
+		}
+		resp.Users = append(resp.Users, likeEntry{UserID: row.UserID, LikedAt: row.CreatedAt})
+	}
+
+	err = respondWithJSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Lists the chirps a user has liked, most recently liked first
+func (cfg *ApiConfig) getUserLikes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := cfg.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	viewer := cfg.optionalUser(r)
+	params := database.ListUserLikesParams{
+		UserID:   userID,
+		ViewerID: viewer,
+		Limit:    int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	rows, err := cfg.DBQueries.ListUserLikes(ctx, params)
+	if err != nil {
+		log.Printf("Error listing liked chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch likes")
+		return
+	}
+
+	// The cursor here is keyed on when the like happened, not when the chirp was made
+	resp := chirpPage{Chirps: []Chirp{}}
+	for i, row := range rows {
+		if i == page.Limit {
+			last := rows[i-1]
+			resp.NextCursor = encodeCursor(pageCursor{CreatedAt: last.LikedAt, ID: last.ID})
+			break
+		}
+		resp.Chirps = append(resp.Chirps, chirpFromDB(database.Chirp{
+			ID:            row.ID,
+			CreatedAt:     row.CreatedAt,
+			UpdatedAt:     row.UpdatedAt,
+			Body:          row.Body,
+			UserID:        row.UserID,
+			InReplyTo:     row.InReplyTo,
+			ThreadRootID:  row.ThreadRootID,
+			DeletedAt:     row.DeletedAt,
+			Kind:          row.Kind,
+			ReferenceID:   row.ReferenceID,
+			RevisionCount: row.RevisionCount,
+			HiddenAt:      row.HiddenAt,
+		}))
+	}
+
+	err = cfg.decorateChirpSlice(ctx, viewer, resp.Chirps)
+	if err != nil {
+		log.Printf("Error counting likes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch likes")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLikeUnlike(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	bob := createTestUser(t, cfg, "bob@example.com")
+	aliceToken := testToken(t, cfg, alice.ID)
+	bobToken := testToken(t, cfg, bob.ID)
+	chirpID := createTestChirp(t, cfg, bob.ID, "like this").ID.String()
+
+	// Liking twice only counts once
+	for i := 0; i < 2; i++ {
+		rec := serveTest(cfg.likeChirp, "PUT", "/api/chirps/"+chirpID+"/like", aliceToken, "", "chirpID", chirpID)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	}
+
+	chirp := fetchTestChirp(t, cfg, aliceToken, chirpID)
+	assert.Equal(t, int64(1), chirp.LikeCount)
+	require.NotNil(t, chirp.LikedByMe)
+	assert.True(t, *chirp.LikedByMe)
+
+	chirp = fetchTestChirp(t, cfg, bobToken, chirpID)
+	assert.Equal(t, int64(1), chirp.LikeCount)
+	require.NotNil(t, chirp.LikedByMe)
+	assert.False(t, *chirp.LikedByMe)
+
+	// Logged out there's nobody for liked_by_me to be about
+	chirp = fetchTestChirp(t, cfg, "", chirpID)
+	assert.Equal(t, int64(1), chirp.LikeCount)
+	assert.Nil(t, chirp.LikedByMe)
+
+	rec := serveTest(cfg.likeChirp, "PUT", "/api/chirps/"+chirpID+"/like", bobToken, "", "chirpID", chirpID)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = serveTest(cfg.getChirpLikes, "GET", "/api/chirps/"+chirpID+"/likes", "", "", "chirpID", chirpID)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var likes likePage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &likes))
+	assert.Equal(t, int64(2), likes.Count)
+	assert.Len(t, likes.Users, 2)
+
+	// So does unliking, and unliking something never liked is fine too
+	for i := 0; i < 2; i++ {
+		rec = serveTest(cfg.unlikeChirp, "DELETE", "/api/chirps/"+chirpID+"/like", aliceToken, "", "chirpID", chirpID)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	}
+
+	chirp = fetchTestChirp(t, cfg, aliceToken, chirpID)
+	assert.Equal(t, int64(1), chirp.LikeCount)
+	require.NotNil(t, chirp.LikedByMe)
+	assert.False(t, *chirp.LikedByMe)
+}
+
+func TestLikeMissingChirp(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	token := testToken(t, cfg, alice.ID)
+
+	rec := serveTest(cfg.likeChirp, "PUT", "/api/chirps/nope/like", token, "", "chirpID", "nope")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	missing := "00000000-0000-0000-0000-000000000001"
+	rec = serveTest(cfg.likeChirp, "PUT", "/api/chirps/"+missing+"/like", token, "", "chirpID", missing)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestRechirpEmbedHasLikes(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	bob := createTestUser(t, cfg, "bob@example.com")
+	aliceToken := testToken(t, cfg, alice.ID)
+	original := createTestChirp(t, cfg, bob.ID, "worth sharing")
+
+	rechirp, err := cfg.DBQueries.NewChirp(context.Background(), database.NewChirpParams{
+		UserID:      alice.ID,
+		Kind:        chirpKindRechirp,
+		ReferenceID: uuid.NullUUID{UUID: original.ID, Valid: true},
+	})
+	require.NoError(t, err)
+
+	rec := serveTest(cfg.likeChirp, "PUT", "/api/chirps/"+original.ID.String()+"/like", aliceToken, "", "chirpID", original.ID.String())
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	chirp := fetchTestChirp(t, cfg, aliceToken, rechirp.ID.String())
+	require.NotNil(t, chirp.Embedded)
+	require.NotNil(t, chirp.Embedded.Chirp)
+	assert.Equal(t, original.ID, chirp.Embedded.ID)
+	assert.Equal(t, int64(1), chirp.Embedded.LikeCount)
+	require.NotNil(t, chirp.Embedded.LikedByMe)
+	assert.True(t, *chirp.Embedded.LikedByMe)
+}
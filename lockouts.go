@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/audit"
+	"github.com/Tim-Restart/chirpy/internal/lockout"
+	"github.com/google/uuid"
+)
+
+// Failed login tracking, by the email tried, by the address it came from
+// and by user for 2FA codes
+type loginLockouts struct {
+	store   lockout.Store
+	account *lockout.Guard
+	ip      *lockout.Guard
+	mfa     *lockout.Guard
+}
+
+// Failures are forgotten after an hour without any
+const lockoutResetAfter = time.Hour
+
+// How often failures that have been forgotten are cleared out
+const lockoutPruneInterval = 10 * time.Minute
+
+func newLoginLockouts(store lockout.Store) *loginLockouts {
+	return &loginLockouts{
+		store: store,
+		account: lockout.NewGuard(store, "email", lockout.Policy{
+			FreeAttempts: 5,
+			BaseDelay:    30 * time.Second,
+			MaxDelay:     15 * time.Minute,
+			ResetAfter:   lockoutResetAfter,
+		}),
+		// Lots of people can share an address, so it gets more goes
+		ip: lockout.NewGuard(store, "ip", lockout.Policy{
+			FreeAttempts: 20,
+			BaseDelay:    30 * time.Second,
+			MaxDelay:     15 * time.Minute,
+			ResetAfter:   lockoutResetAfter,
+		}),
+		mfa: lockout.NewGuard(store, "mfa", lockout.Policy{
+			FreeAttempts: 5,
+			BaseDelay:    30 * time.Second,
+			MaxDelay:     15 * time.Minute,
+			ResetAfter:   lockoutResetAfter,
+		}),
+	}
+}
+
+func normaliseLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Counts an attempt for id and returns how long to wait instead if id is
+// locked out. Better to let them try than lock everyone out when the store
+// is down, so errors count as not locked
+func attemptLogin(ctx context.Context, guard *lockout.Guard, id string) time.Duration {
+	wait, err := guard.Attempt(ctx, id)
+	if err != nil {
+		log.Printf("Error checking lockout: %s", err)
+		return 0
+	}
+	return wait
+}
+
+func respondLockedOut(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, http.StatusTooManyRequests, "Too many failed attempts, try again later")
+}
+
+// Counts a login against the address and the email before the password is
+// checked, so guesses made in parallel can't all get in before the lockout.
+// Returns how long to wait if either is locked out
+func (cfg *ApiConfig) loginLockoutWait(ctx context.Context, r *http.Request, email string) time.Duration {
+	if wait := attemptLogin(ctx, cfg.lockouts.ip, clientIP(r)); wait > 0 {
+		return wait
+	}
+	return attemptLogin(ctx, cfg.lockouts.account, normaliseLoginEmail(email))
+}
+
+// The attempt was already counted as a failure, this only records it
+func (cfg *ApiConfig) recordLoginFailure(r *http.Request, email string) {
+	cfg.recordAudit(r, audit.Event{
+		Action:   auditLoginFailure,
+		Metadata: map[string]any{"email": normaliseLoginEmail(email), "reason": "password"},
+	})
+}
+
+// Only the account is reset, otherwise logging into your own account
+// would let you keep guessing at other people's from the same address.
+// The address just gets this attempt back
+func (cfg *ApiConfig) recordLoginSuccess(ctx context.Context, r *http.Request, email string) {
+	err := cfg.lockouts.account.Reset(ctx, normaliseLoginEmail(email))
+	if err != nil {
+		log.Printf("Error resetting login failures: %s", err)
+	}
+	err = cfg.lockouts.ip.Forgive(ctx, clientIP(r))
+	if err != nil {
+		log.Printf("Error resetting login failures: %s", err)
+	}
+}
+
+func (cfg *ApiConfig) recordMFAResult(ctx context.Context, r *http.Request, userID uuid.UUID, ok bool) {
+	if !ok {
+		cfg.recordAudit(r, audit.Event{
+			Action:   auditLoginFailure,
+			ActorID:  actor(userID),
+			Metadata: map[string]any{"reason": "mfa"},
+		})
+		return
+	}
+
+	err := cfg.lockouts.mfa.Reset(ctx, userID.String())
+	if err != nil {
+		log.Printf("Error recording 2FA attempt: %s", err)
+	}
+}
+
+// Keeps clearing out failures that would be forgotten anyway
+func (cfg *ApiConfig) pruneLockoutsEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := cfg.lockouts.store.Prune(ctx, time.Now().UTC().Add(-lockoutResetAfter))
+			if err != nil {
+				log.Printf("Error pruning lockouts: %s", err)
+			}
+		}
+	}
+}
+
+type lockoutEntry struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// Lists every email, address and user with recent failed attempts
+func (cfg *ApiConfig) getLockouts(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	records, err := cfg.lockouts.store.List(r.Context(), now.Add(-lockoutResetAfter))
+	if err != nil {
+		log.Printf("Error listing lockouts: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to list lockouts")
+		return
+	}
+
+	entries := []lockoutEntry{}
+	for _, record := range records {
+		entry := lockoutEntry{
+			Key:           record.Key,
+			Failures:      record.Failures,
+			LastFailureAt: record.LastFailureAt,
+		}
+		if record.LockedUntil.After(now) {
+			entry.LockedUntil = &record.LockedUntil
+		}
+		entries = append(entries, entry)
+	}
+
+	err = respondWithJSON(w, http.StatusOK, entries)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Clears the failures for one key, e.g. "email:user@example.com"
+func (cfg *ApiConfig) clearLockout(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+
+	// What it was before, for the audit log
+	before, err := cfg.lockouts.store.Get(r.Context(), key)
+	if err != nil {
+		log.Printf("Error getting lockout: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to clear lockout")
+		return
+	}
+
+	err = cfg.lockouts.store.Delete(r.Context(), key)
+	if err != nil {
+		log.Printf("Error clearing lockout: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to clear lockout")
+		return
+	}
+
+	adminID, _, _ := cfg.staffUser(r)
+	metadata := map[string]any{"failures": before.Failures}
+	if before.LockedUntil.After(time.Now()) {
+		metadata["locked_until"] = before.LockedUntil.UTC()
+	}
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditLockoutCleared,
+		ActorID:    actor(adminID),
+		TargetType: "lockout",
+		TargetID:   key,
+		Metadata:   map[string]any{"before": metadata},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
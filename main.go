@@ -1,241 +1,538 @@
-package main
-
-import (
-	"net/http"
-	"encoding/json"
-	"log"
-	_ "github.com/lib/pq"
-	"os"
-	"database/sql"
-	"github.com/joho/godotenv"
-	"github.com/Tim-Restart/chirpy/internal/database"
-	"fmt"
-	"sync/atomic"
-	"time"
-	"github.com/google/uuid"
-)
-
-type ApiConfig struct {
-	fileserverHits atomic.Int32
-	DBQueries      *database.Queries
-	platform       string
-	jwtSecret 	   string
-	polka 		   string
-}
-
-type User struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Email     string    `json:"email"`
-	Hashed_Password string `json:"hashed_password"`
-	Token string `json:"token"`
-	Refresh_Token string `json:"refresh_token"`
-	IsChirpyRed bool `json:"is_chirpy_red"`
-}
-
-type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	User_ID   uuid.UUID `json:"user_id"`
-}
-
-// Struct for incoming JSON posts
-type parameters struct {
-	Body string `json:"body"`
-}
-
-// Successs repsonse struct
-type successResponse struct {
-	Valid bool `json:"valid"`
-}
-
-// Error response struct
-type errorResponse struct {
-	Error string `json:"error"`
-}
-
-func main() {
-
-	// The first section of code below sets the URL by loading the .env file, then connects all SQL stuff, then stores it in a struct.
-
-	// Load the .env file, panic if it doesn't work
-	err := godotenv.Load()
-	if err != nil {
-		panic("Error loading .env files")
-	}
-
-	platform := os.Getenv("PLATFORM")
-
-	// set the dbURL to the path for the sql database from the .env file
-	dbURL := os.Getenv("DB_URL")
-	if dbURL == "" {
-		panic("DB_URL is not set in the enviroment, check .env file")
-	}
-
-	// Open the SQL database connection
-	db, err := sql.Open("postgres", dbURL)
-	if err != nil {
-		panic(err)
-	}
-
-	// Load the .env secret key
-	secret := os.Getenv("SECRET")
-	if secret == "" {
-		panic("SECRET is not set in the enviroment, check .env file")
-	}
-
-	polkaKey := os.Getenv("POLKA_KEY")
-	if polkaKey == "" {
-		panic("Polka key is not set in the enviroment")
-	}
-
-	// Create a new instance of *database.Queries
-	dbQueries := database.New(db)
-
-	// Store it in the apiConfig struct so we have access anywhere
-	// Create an instance of apiConfig
-	cfg := ApiConfig{
-		DBQueries: dbQueries,
-		platform:  platform,
-		polka: polkaKey,
-	}
-
-	// Make a new server
-	mux := http.NewServeMux()
-
-	// Assignes fileHandler so that it can be called in mux.Handle
-	fileHandler := http.FileServer(http.Dir("./"))
-
-	// Register paths and their handlers
-	// FileServer is in http package, Dir converts the '.' to a directory part
-	mux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix("/app", fileHandler)))
-
-	// vaidates the 140 characters of the chirp
-	mux.HandleFunc("POST /api/validate_chirp", func(w http.ResponseWriter, r *http.Request) {
-
-		decoder := json.NewDecoder(r.Body)
-		params := parameters{}
-		err := decoder.Decode(&params)
-		if err != nil {
-			errResp := errorResponse{
-				Error: "Something went wrong",
-			}
-
-			jsonResp, err := json.Marshal(errResp)
-			if err != nil {
-				log.Printf("Error marshalling JSON %s", err)
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusInternalServerError) // Status 500
-				return
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError) // Status 500
-			w.Write(jsonResp)
-			return
-
-		}
-
-		// Checks the length of the chirp
-		if len(params.Body) > 140 {
-			errResp := errorResponse{
-				Error: "Chirp is too long",
-			}
-
-			jsonResp, err := json.Marshal(errResp)
-			if err != nil {
-				log.Printf("Error marshalling JSON %s", err)
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusBadRequest) // Status 400
-				w.Write(jsonResp)
-				return
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest) // Status 400
-			w.Write(jsonResp)
-			return
-		}
-
-		type cleanedBody struct {
-			Cleaned string `json:"cleaned"`
-		}
-
-		chirp := badWordReplacement(params.Body)
-
-		cleanedResp, err := json.Marshal(chirp)
-		if err != nil {
-			log.Printf("Error marshalling JSON %s", err)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(200)
-		w.Write(cleanedResp)
-
-	})
-
-	// mux.HandleFunc()
-
-	// Adds a new chirp to the users wall
-	mux.HandleFunc("POST /api/chirps", cfg.newChirp)
-
-	// Adds a new user to the database
-	mux.HandleFunc("POST /api/users", cfg.addUser)
-
-	// Gets all chirps and returns them by order of created_at
-	mux.HandleFunc("GET /api/chirps", cfg.handleGetChirps)
-
-	// Gets single Chirp from UUID for the Chirp (not the user)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.getChirp)
-
-	// Login endpoint
-	mux.HandleFunc("POST /api/login", cfg.login)
-
-	// returns the server metrics
-	mux.HandleFunc("GET /admin/metrics", cfg.metricsHandler)
-
-	// Resets the server metrics
-	mux.HandleFunc("POST /admin/reset", cfg.metricsResetHandler)
-
-	// Checks to make sure the refresh token is valid
-	mux.HandleFunc("POST /api/refresh", cfg.refresh)
-
-	// Revokes the refresh token
-	mux.HandleFunc("POST /api/revoke", cfg.revoke)
-
-	// Updates the email and password
-	mux.HandleFunc("PUT /api/users", cfg.updateUser)
-
-	//Delete functionality
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.deleteChirp)
-
-	// Upgrade to Chirpy Red! 
-	mux.HandleFunc("POST /api/polka/webhooks", cfg.chirpyRedUpgrade)
-
-	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
-		// Set the content type header
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-
-		// Write the status code
-		w.WriteHeader(http.StatusOK)
-
-		// Write the response body
-		w.Write([]byte("OK\n"))
-
-	})
-
-	// Create a new Server struct
-	server := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
-	}
-
-	fmt.Println("######## Ready to serve my lord ########")
-	// Start the server
-	server.ListenAndServe()
-
-}
+package main
+
+import (
+	"net/http"
+	"encoding/json"
+	"log"
+	_ "github.com/lib/pq"
+	"os"
+	"database/sql"
+	"github.com/joho/godotenv"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/mailer"
+	"github.com/Tim-Restart/chirpy/internal/lockout"
+	"github.com/Tim-Restart/chirpy/internal/audit"
+	"github.com/Tim-Restart/chirpy/internal/ratelimit"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"strings"
+	"strconv"
+	"context"
+	"github.com/google/uuid"
+)
+
+type ApiConfig struct {
+	fileserverHits atomic.Int32
+	db             *sql.DB
+	platform       string
+	DBQueries      *database.Queries
+	jwtKeys        *auth.KeySet
+	polka 		   string
+	editWindow     time.Duration
+	events         *eventBus
+	mailer         mailer.Mailer
+	baseURL        string
+
+	lockouts       *loginLockouts
+	passwordPolicy *auth.PasswordPolicy
+	moderation     *contentFilter
+	audit          *audit.Recorder
+	rateLimiter    *ratelimit.Limiter
+
+	// Actions users can't do until they've verified their email
+	unverifiedRestrictions map[string]bool
+}
+
+type User struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Email     string    `json:"email"`
+	Hashed_Password string `json:"hashed_password"`
+	Token string `json:"token"`
+	Refresh_Token string `json:"refresh_token"`
+	IsChirpyRed bool `json:"is_chirpy_red"`
+	Username string `json:"username,omitempty"`
+	EmailVerified bool `json:"email_verified"`
+	Role string `json:"role,omitempty"`
+}
+
+type Chirp struct {
+	ID            uuid.UUID      `json:"id"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	Body          string         `json:"body"`
+	User_ID       uuid.UUID      `json:"user_id"`
+	InReplyTo     *uuid.UUID     `json:"in_reply_to,omitempty"`
+	ThreadRootID  *uuid.UUID     `json:"thread_root_id,omitempty"`
+	Deleted       bool           `json:"deleted,omitempty"`
+	Hidden        bool           `json:"hidden,omitempty"`
+	LikeCount     int64          `json:"like_count"`
+	LikedByMe     *bool          `json:"liked_by_me,omitempty"`
+	Kind          string         `json:"kind"`
+	Embedded      *embeddedChirp `json:"embedded,omitempty"`
+	Edited        bool           `json:"edited"`
+	RevisionCount int32          `json:"revision_count"`
+	Entities      *chirpEntities `json:"entities,omitempty"`
+
+	// The chirp a rechirp or quote points at, used to look up Embedded
+	referenceID uuid.NullUUID
+}
+
+// The original chirp inside a rechirp or quote
+// If the original has been deleted only "unavailable": true is left
+type embeddedChirp struct {
+	*Chirp
+	Unavailable bool `json:"unavailable,omitempty"`
+}
+
+// Struct for incoming JSON posts
+type parameters struct {
+	Body string `json:"body"`
+}
+
+// Successs repsonse struct
+type successResponse struct {
+	Valid bool `json:"valid"`
+}
+
+// Error response struct
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func main() {
+
+	// The first section of code below sets the URL by loading the .env file, then connects all SQL stuff, then stores it in a struct.
+
+	// Load the .env file, panic if it doesn't work
+	err := godotenv.Load()
+	if err != nil {
+		panic("Error loading .env files")
+	}
+
+	// set the dbURL to the path for the sql database from the .env file
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		panic("DB_URL is not set in the enviroment, check .env file")
+	}
+
+	// Open the SQL database connection
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		panic(err)
+	}
+
+	// Load the .env secret key
+	secret := os.Getenv("SECRET")
+	if secret == "" {
+		panic("SECRET is not set in the enviroment, check .env file")
+	}
+
+	// Access tokens are signed with SECRET (HS256) unless JWT_KEYS_DIR points
+	// at a folder of Ed25519/RSA .pem keys, JWT_ACTIVE_KID names the one that
+	// signs new tokens and the others are still accepted so keys can rotate
+	// SECRET stays as a verify-only key, tokens it signed before the switch
+	// carry on working until they expire instead of logging everyone out
+	jwtKeys := auth.SecretKeySet(secret)
+	if keysDir := os.Getenv("JWT_KEYS_DIR"); keysDir != "" {
+		jwtKeys, err = auth.LoadKeyDir(keysDir, os.Getenv("JWT_ACTIVE_KID"))
+		if err != nil {
+			panic("Unable to load JWT keys: " + err.Error())
+		}
+		err = jwtKeys.Add(auth.NewHMACVerifyKey("", secret), false)
+		if err != nil {
+			panic("Unable to load JWT keys: " + err.Error())
+		}
+	}
+
+	polkaKey := os.Getenv("POLKA_KEY")
+	if polkaKey == "" {
+		panic("Polka key is not set in the enviroment")
+	}
+
+	// How long after posting a chirp can still be edited, 15 minutes unless set
+	editWindow := 15 * time.Minute
+	if s := os.Getenv("CHIRP_EDIT_WINDOW"); s != "" {
+		editWindow, err = time.ParseDuration(s)
+		if err != nil {
+			panic("CHIRP_EDIT_WINDOW is not a valid duration, e.g. 15m")
+		}
+	}
+
+	// Links in emails point here
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
+	// Mail goes out over SMTP if SMTP_HOST is set, otherwise it's logged
+	// (and saved as files in MAIL_DIR if that's set) for local development
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "Chirpy <no-reply@chirpy.local>"
+	}
+	var appMailer mailer.Mailer = &mailer.LogMailer{Dir: os.Getenv("MAIL_DIR"), From: mailFrom}
+	if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
+		smtpPort := os.Getenv("SMTP_PORT")
+		if smtpPort == "" {
+			smtpPort = "587"
+		}
+		appMailer = mailer.NewSMTPMailer(smtpHost, smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), mailFrom)
+	}
+
+	// e.g. UNVERIFIED_RESTRICTIONS=chirp,like,follow, nothing is blocked unless set
+	unverifiedRestrictions, err := parseRestrictions(os.Getenv("UNVERIFIED_RESTRICTIONS"))
+	if err != nil {
+		panic("UNVERIFIED_RESTRICTIONS is not valid: " + err.Error())
+	}
+
+	// New passwords are hashed with argon2id unless PASSWORD_HASH=bcrypt,
+	// hashes made with other settings are upgraded when their owner logs in
+	hasher, err := passwordHasherFromEnv(os.Getenv("PASSWORD_HASH"), os.Getenv("ARGON2_PARAMS"), os.Getenv("BCRYPT_COST"))
+	if err != nil {
+		panic(err.Error())
+	}
+	auth.SetPasswordHasher(hasher)
+
+	// PASSWORD_MIN_LENGTH defaults to 8, BREACHED_PASSWORDS_FILE adds to the
+	// built in list of common passwords that are refused
+	minLength := 8
+	if s := os.Getenv("PASSWORD_MIN_LENGTH"); s != "" {
+		minLength, err = strconv.Atoi(s)
+		if err != nil || minLength < 1 {
+			panic("PASSWORD_MIN_LENGTH must be a positive number")
+		}
+	}
+	passwordPolicy := auth.NewPasswordPolicy(minLength)
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		err = passwordPolicy.LoadBreachedFile(path)
+		if err != nil {
+			panic("Unable to load BREACHED_PASSWORDS_FILE: " + err.Error())
+		}
+	}
+
+	// Create a new instance of *database.Queries
+	dbQueries := database.New(db)
+
+	// ADMIN_EMAIL makes that (already signed up) user an admin if there
+	// isn't one yet, after that admins hand out roles themselves
+	if adminEmail := os.Getenv("ADMIN_EMAIL"); adminEmail != "" {
+		err = bootstrapAdmin(context.Background(), dbQueries, adminEmail)
+		if err != nil {
+			panic("Unable to bootstrap admin: " + err.Error())
+		}
+	}
+
+	// MODERATION_RULES_FILE replaces the built in list of masked words, admins
+	// can add more rules on top of it at /admin/moderation/rules
+	moderationRules, err := loadModerationRules(os.Getenv("MODERATION_RULES_FILE"))
+	if err != nil {
+		panic("Unable to load MODERATION_RULES_FILE: " + err.Error())
+	}
+	contentFilter, err := newContentFilter(dbQueries, moderationRules)
+	if err != nil {
+		panic("Unable to load moderation rules: " + err.Error())
+	}
+	go contentFilter.reloadEvery(context.Background(), moderationReloadInterval)
+
+	// Failed logins are counted in Postgres so every server agrees,
+	// LOCKOUT_STORE=memory keeps them in this process instead
+	var lockoutStore lockout.Store = lockout.NewPostgresStore(dbQueries)
+	switch os.Getenv("LOCKOUT_STORE") {
+	case "", "postgres":
+	case "memory":
+		lockoutStore = lockout.NewMemoryStore()
+	default:
+		panic("LOCKOUT_STORE must be postgres or memory")
+	}
+
+	// Rate limits are shared through Postgres too, RATE_LIMIT_STORE=memory
+	// keeps them in this process
+	var rateLimitStore ratelimit.Store = ratelimit.NewPostgresStore(dbQueries)
+	switch os.Getenv("RATE_LIMIT_STORE") {
+	case "", "postgres":
+	case "memory":
+		rateLimitStore = ratelimit.NewMemoryStore()
+	default:
+		panic("RATE_LIMIT_STORE must be postgres or memory")
+	}
+
+	// Store it in the apiConfig struct so we have access anywhere
+	// Create an instance of apiConfig
+	cfg := ApiConfig{
+		db: db,
+		platform: os.Getenv("PLATFORM"),
+		DBQueries: dbQueries,
+		polka: polkaKey,
+		editWindow: editWindow,
+		events: newEventBus(),
+		jwtKeys: jwtKeys,
+		mailer: appMailer,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		unverifiedRestrictions: unverifiedRestrictions,
+		lockouts: newLoginLockouts(lockoutStore),
+		passwordPolicy: passwordPolicy,
+		moderation: contentFilter,
+		audit: audit.NewRecorder(db),
+		rateLimiter: ratelimit.NewLimiter(rateLimitStore),
+	}
+
+	go cfg.pruneRateLimitsEvery(context.Background(), rateLimitPruneInterval)
+	go cfg.pruneLockoutsEvery(context.Background(), lockoutPruneInterval)
+	go cfg.pruneOAuthCodesEvery(context.Background(), oauthCodePruneInterval)
+
+	// Anything that reacts to events gets hooked up here
+	cfg.registerNotifications(cfg.events)
+
+	// Make a new server
+	mux := http.NewServeMux()
+
+	// Assignes fileHandler so that it can be called in mux.Handle
+	fileHandler := http.FileServer(http.Dir("./"))
+
+	// Register paths and their handlers
+	// FileServer is in http package, Dir converts the '.' to a directory part
+	mux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix("/app", fileHandler)))
+
+	// vaidates the 140 characters of the chirp
+	mux.HandleFunc("POST /api/validate_chirp", func(w http.ResponseWriter, r *http.Request) {
+
+		decoder := json.NewDecoder(r.Body)
+		params := parameters{}
+		err := decoder.Decode(&params)
+		if err != nil {
+			errResp := errorResponse{
+				Error: "Something went wrong",
+			}
+
+			jsonResp, err := json.Marshal(errResp)
+			if err != nil {
+				log.Printf("Error marshalling JSON %s", err)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError) // Status 500
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError) // Status 500
+			w.Write(jsonResp)
+			return
+
+		}
+
+		// Checks the length of the chirp
+		if len(params.Body) > 140 {
+			errResp := errorResponse{
+				Error: "Chirp is too long",
+			}
+
+			jsonResp, err := json.Marshal(errResp)
+			if err != nil {
+				log.Printf("Error marshalling JSON %s", err)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest) // Status 400
+				w.Write(jsonResp)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest) // Status 400
+			w.Write(jsonResp)
+			return
+		}
+
+		type cleanedBody struct {
+			Cleaned string `json:"cleaned"`
+		}
+
+		moderated := cfg.moderation.Check(params.Body)
+		if moderated.Rejected() {
+			respondWithError(w, http.StatusBadRequest, "Chirp contains words that aren't allowed")
+			return
+		}
+		chirp := moderated.Text
+
+		cleanedResp, err := json.Marshal(chirp)
+		if err != nil {
+			log.Printf("Error marshalling JSON %s", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(cleanedResp)
+
+	})
+
+	// mux.HandleFunc()
+
+	// Adds a new chirp to the users wall, some routes are rate limited
+	// (see ratelimits.go) so scripts can't flood them
+	mux.HandleFunc("POST /api/chirps", cfg.rateLimit(chirpRateLimit, cfg.newChirp))
+
+	// Adds a new user to the database
+	mux.HandleFunc("POST /api/users", cfg.rateLimit(signupRateLimit, cfg.addUser))
+
+	// Gets a page of chirps ordered by created_at, optionally filtered by author_id
+	mux.HandleFunc("GET /api/chirps", cfg.handleGetChirps)
+
+	// Full text search over chirp bodies, ranked by relevance
+	mux.HandleFunc("GET /api/chirps/search", cfg.searchChirps)
+
+	// Gets the ancestors and replies of a chirp
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", cfg.getThread)
+
+	// Gets single Chirp from UUID for the Chirp (not the user)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.getChirp)
+
+	// Login endpoint
+	mux.HandleFunc("POST /api/login", cfg.rateLimit(loginRateLimit, cfg.login))
+
+	// Email verification and password resets
+	mux.HandleFunc("POST /api/users/me/verify-email", cfg.rateLimit(emailRateLimit, cfg.resendVerification))
+	mux.HandleFunc("POST /api/verify-email", cfg.verifyEmail)
+	mux.HandleFunc("POST /api/password-reset/request", cfg.rateLimit(passwordResetRateLimit, cfg.requestPasswordReset))
+	mux.HandleFunc("POST /api/password-reset", cfg.resetPassword)
+
+	// Second step of logging in when 2FA is on
+	mux.HandleFunc("POST /api/login/mfa", cfg.rateLimit(loginRateLimit, cfg.loginMFA))
+
+	// Setting up and turning off 2FA
+	mux.HandleFunc("POST /api/users/me/2fa", cfg.enrollTwoFactor)
+	mux.HandleFunc("POST /api/users/me/2fa/confirm", cfg.confirmTwoFactor)
+	mux.HandleFunc("DELETE /api/users/me/2fa", cfg.disableTwoFactor)
+
+	// Public keys other services can check our access tokens with
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.getJWKS)
+
+	// Everything under /admin needs an admin's access token, apart from the
+	// report queue and user states which moderators can use too
+
+	// returns the server metrics
+	mux.HandleFunc("GET /admin/metrics", cfg.requireRole(auth.RoleAdmin, cfg.metricsHandler))
+
+	// Resets the server metrics
+	mux.HandleFunc("POST /admin/reset", cfg.requireRole(auth.RoleAdmin, cfg.metricsResetHandler))
+
+	// Failed login attempts and lockouts
+	mux.HandleFunc("GET /admin/lockouts", cfg.requireRole(auth.RoleAdmin, cfg.getLockouts))
+	mux.HandleFunc("DELETE /admin/lockouts/{key}", cfg.requireRole(auth.RoleAdmin, cfg.clearLockout))
+
+	// Makes users moderators or admins
+	mux.HandleFunc("PUT /admin/users/{userID}/role", cfg.requireRole(auth.RoleAdmin, cfg.setUserRole))
+
+	// Words and phrases that get masked, rejected or flagged in chirps
+	mux.HandleFunc("GET /admin/moderation/rules", cfg.requireRole(auth.RoleAdmin, cfg.getModerationRules))
+	mux.HandleFunc("POST /admin/moderation/rules", cfg.requireRole(auth.RoleAdmin, cfg.createModerationRule))
+	mux.HandleFunc("DELETE /admin/moderation/rules/{ruleID}", cfg.requireRole(auth.RoleAdmin, cfg.deleteModerationRule))
+
+	// Reports from users and the moderation rules, and dealing with them
+	mux.HandleFunc("GET /admin/reports", cfg.requireRole(auth.RoleModerator, cfg.getReports))
+	mux.HandleFunc("GET /admin/reports/{reportID}", cfg.requireRole(auth.RoleModerator, cfg.getReport))
+	mux.HandleFunc("POST /admin/reports/{reportID}/actions", cfg.requireRole(auth.RoleModerator, cfg.actOnReport))
+
+	// Suspending, shadow banning, deactivating and restoring accounts
+	mux.HandleFunc("PUT /admin/users/{userID}/state", cfg.requireRole(auth.RoleModerator, cfg.updateUserState))
+
+	// Security and admin events, and checking nobody has tampered with them
+	mux.HandleFunc("GET /admin/audit", cfg.requireRole(auth.RoleAdmin, cfg.getAuditEvents))
+	mux.HandleFunc("GET /admin/audit/verify", cfg.requireRole(auth.RoleAdmin, cfg.verifyAuditLog))
+
+	// Checks to make sure the refresh token is valid
+	mux.HandleFunc("POST /api/refresh", cfg.refresh)
+
+	// Revokes the refresh token
+	mux.HandleFunc("POST /api/revoke", cfg.revoke)
+
+	// Devices the user is logged in on
+	mux.HandleFunc("GET /api/sessions", cfg.getSessions)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.deleteSession)
+	mux.HandleFunc("POST /api/sessions/revoke-all", cfg.revokeAllSessions)
+
+	// OAuth apps registered by users
+	mux.HandleFunc("POST /api/oauth/clients", cfg.createOAuthClient)
+	mux.HandleFunc("GET /api/oauth/clients", cfg.getOAuthClients)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", cfg.deleteOAuthClient)
+
+	// OAuth 2 authorization server, the code flow with PKCE
+	mux.HandleFunc("GET /oauth/authorize", cfg.authorizeForm)
+	mux.HandleFunc("POST /oauth/authorize", cfg.rateLimit(loginRateLimit, cfg.authorizeSubmit))
+	mux.HandleFunc("POST /oauth/token", cfg.oauthToken)
+	mux.HandleFunc("POST /oauth/introspect", cfg.oauthIntrospect)
+	mux.HandleFunc("POST /oauth/revoke", cfg.oauthRevoke)
+
+	// Personal access tokens for bots and integrations
+	mux.HandleFunc("POST /api/tokens", cfg.createAccessToken)
+	mux.HandleFunc("GET /api/tokens", cfg.getAccessTokens)
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", cfg.revokeAccessToken)
+
+	// Updates the email and password
+	mux.HandleFunc("PUT /api/users", cfg.updateUser)
+
+	// Edits a chirp, keeping the old body as a revision
+	mux.HandleFunc("PATCH /api/chirps/{chirpID}", cfg.editChirp)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", cfg.getChirpRevisions)
+
+	//Delete functionality
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.deleteChirp)
+
+	// Likes
+	mux.HandleFunc("PUT /api/chirps/{chirpID}/like", cfg.likeChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", cfg.unlikeChirp)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/likes", cfg.getChirpLikes)
+	mux.HandleFunc("GET /api/users/{userID}/likes", cfg.getUserLikes)
+
+	// Hashtags
+	mux.HandleFunc("GET /api/hashtags/trending", cfg.getTrendingHashtags)
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", cfg.getHashtagChirps)
+
+	// Follow graph
+	mux.HandleFunc("POST /api/users/{userID}/follow", cfg.followUser)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", cfg.unfollowUser)
+	mux.HandleFunc("GET /api/users/{userID}/followers", cfg.getFollowers)
+	mux.HandleFunc("GET /api/users/{userID}/following", cfg.getFollowing)
+
+	// Reporting chirps and accounts to the moderators
+	mux.HandleFunc("POST /api/chirps/{chirpID}/report", cfg.rateLimit(reportRateLimit, cfg.reportChirp))
+	mux.HandleFunc("POST /api/users/{userID}/report", cfg.rateLimit(reportRateLimit, cfg.reportUser))
+
+	// Chirps that @mention the logged in user
+	mux.HandleFunc("GET /api/users/me/mentions", cfg.getMyMentions)
+
+	// Notifications for the logged in user
+	mux.HandleFunc("GET /api/notifications", cfg.getNotifications)
+	mux.HandleFunc("POST /api/notifications/read", cfg.markAllNotificationsRead)
+	mux.HandleFunc("POST /api/notifications/{notificationID}/read", cfg.markNotificationRead)
+
+	// Chirps from everyone the logged in user follows
+	mux.HandleFunc("GET /api/timeline", cfg.getTimeline)
+
+	// Upgrade to Chirpy Red! 
+	mux.HandleFunc("POST /api/polka/webhooks", cfg.chirpyRedUpgrade)
+
+	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
+		// Set the content type header
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		// Write the status code
+		w.WriteHeader(http.StatusOK)
+
+		// Write the response body
+		w.Write([]byte("OK\n"))
+
+	})
+
+	// Create a new Server struct
+	server := &http.Server{
+		Addr:    ":8080",
+		Handler: middlewareRequestID(mux),
+	}
+
+	fmt.Println("######## Ready to serve my lord ########")
+	// Start the server
+	server.ListenAndServe()
+
+}
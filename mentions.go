@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Usernames are stored lower case, 3 to 30 letters, digits or underscores
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+var errInvalidUsername = errors.New("username must be 3-30 letters, digits or underscores")
+
+// An @mention in a chirp body, offsets are in characters (runes) and end is exclusive
+type mentionEntity struct {
+	Username string    `json:"username"`
+	UserID   uuid.UUID `json:"user_id"`
+	Start    int32     `json:"start"`
+	End      int32     `json:"end"`
+}
+
+// Structured bits of a chirp body that clients can link up
+type chirpEntities struct {
+	Mentions []mentionEntity `json:"mentions"`
+}
+
+// Lower cases a username and checks it's allowed
+func normaliseUsername(username string) (string, error) {
+	username = strings.ToLower(strings.TrimPrefix(username, "@"))
+	if !usernamePattern.MatchString(username) {
+		return "", errInvalidUsername
+	}
+	return username, nil
+}
+
+// Finds every @username in a chirp body, Start is the offset of the @
+// The @ has to start a word, so email addresses aren't mentions
+func extractMentions(body string) []mentionEntity {
+	var mentions []mentionEntity
+
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || (i > 0 && isUsernameRune(runes[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isUsernameRune(runes[end]) {
+			end++
+		}
+
+		username, err := normaliseUsername(string(runes[i+1 : end]))
+		if err == nil {
+			mentions = append(mentions, mentionEntity{
+				Username: username,
+				Start:    int32(i),
+				End:      int32(end),
+			})
+		}
+		i = end - 1
+	}
+
+	return mentions
+}
+
+func isUsernameRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_'
+}
+
+// Stores the mentions in a chirp body that match a real user, replacing any it had before
+func (cfg *ApiConfig) syncMentions(ctx context.Context, chirpID uuid.UUID, body string) error {
+	err := cfg.DBQueries.ClearChirpMentions(ctx, chirpID)
+	if err != nil {
+		return err
+	}
+
+	mentions := extractMentions(body)
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	usernames := make([]string, 0, len(mentions))
+	for _, mention := range mentions {
+		usernames = append(usernames, mention.Username)
+	}
+
+	users, err := cfg.DBQueries.GetUsersByUsernames(ctx, usernames)
+	if err != nil {
+		return err
+	}
+
+	userIDs := make(map[string]uuid.UUID, len(users))
+	for _, user := range users {
+		userIDs[user.Username.String] = user.ID
+	}
+
+	params := database.AddChirpMentionsParams{ChirpID: chirpID}
+	for _, mention := range mentions {
+		userID, ok := userIDs[mention.Username]
+		if !ok {
+			// @someone who doesn't exist is just text
+			continue
+		}
+		params.UserIds = append(params.UserIds, userID)
+		params.StartOffsets = append(params.StartOffsets, mention.Start)
+		params.EndOffsets = append(params.EndOffsets, mention.End)
+	}
+
+	if len(params.UserIds) == 0 {
+		return nil
+	}
+
+	return cfg.DBQueries.AddChirpMentions(ctx, params)
+}
+
+// Loads the stored mentions for a set of chirps into their entities
+func (cfg *ApiConfig) addMentions(ctx context.Context, chirps ...*Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+
+	rows, err := cfg.DBQueries.ListChirpMentions(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	byChirp := map[uuid.UUID][]database.ListChirpMentionsRow{}
+	for _, row := range rows {
+		byChirp[row.ChirpID] = append(byChirp[row.ChirpID], row)
+	}
+
+	for _, chirp := range chirps {
+		if chirp.Deleted || chirp.Hidden || len(byChirp[chirp.ID]) == 0 {
+			continue
+		}
+
+		// The username comes from the text itself, so it matches what's on screen
+		body := []rune(chirp.Body)
+		entities := &chirpEntities{Mentions: []mentionEntity{}}
+		for _, row := range byChirp[chirp.ID] {
+			if int(row.EndOffset) > len(body) {
+				continue
+			}
+			entities.Mentions = append(entities.Mentions, mentionEntity{
+				Username: strings.ToLower(string(body[row.StartOffset+1 : row.EndOffset])),
+				UserID:   row.UserID,
+				Start:    row.StartOffset,
+				End:      row.EndOffset,
+			})
+		}
+		chirp.Entities = entities
+	}
+
+	return nil
+}
+
+// Chirps mentioning the authenticated user, newest first
+func (cfg *ApiConfig) getMyMentions(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListUserMentionsParams{
+		UserID: userID,
+		Limit:  int32(page.Limit + 1),
+	}
+	if page.Cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	chirpsFromDB, err := cfg.DBQueries.ListUserMentions(r.Context(), params)
+	if err != nil {
+		log.Printf("Error listing mentions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch mentions")
+		return
+	}
+
+	chirps := newChirpPage(chirpsFromDB, page.Limit)
+	err = cfg.decorateChirpSlice(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}, chirps.Chirps)
+	if err != nil {
+		log.Printf("Error loading chirp details: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch mentions")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, chirps)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
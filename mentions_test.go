@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractMentions(t *testing.T) {
+
+	// Offsets are in characters and include the @
+	mentions := extractMentions("héllo @Alice and @bob_2!")
+	assert.Len(t, mentions, 2)
+	assert.Equal(t, "alice", mentions[0].Username)
+	assert.Equal(t, int32(6), mentions[0].Start)
+	assert.Equal(t, int32(12), mentions[0].End)
+	assert.Equal(t, "bob_2", mentions[1].Username)
+
+	// Email addresses and names that are too short aren't mentions
+	assert.Empty(t, extractMentions("mail me at tim@example.com or @ab"))
+}
+
+func TestUpdateUserTakenUsernameSavesNothing(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+	alice := createTestUser(t, cfg, "alice@example.com")
+	bob := createTestUser(t, cfg, "bob@example.com")
+	err := cfg.DBQueries.SetUsername(ctx, database.SetUsernameParams{
+		ID:       bob.ID,
+		Username: sql.NullString{String: "bob", Valid: true},
+	})
+	require.NoError(t, err)
+
+	body := `{"email":"new@example.com","password":"another horse battery","username":"bob"}`
+	rec := serveTest(cfg.updateUser, "PUT", "/api/users", testToken(t, cfg, alice.ID), body)
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	// The email and password stay as they were
+	dbUser, err := cfg.DBQueries.GetUser(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", dbUser.Email)
+	assert.NoError(t, auth.CheckPasswordHash(dbUser.HashedPassword, "correct horse battery"))
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/audit"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/Tim-Restart/chirpy/internal/moderation"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// The words Chirpy has always masked, used when there's no MODERATION_RULES_FILE
+var defaultModerationRules = []moderation.Rule{
+	{Pattern: "kerfuffle", Action: moderation.ActionMask},
+	{Pattern: "sharbert", Action: moderation.ActionMask},
+	{Pattern: "fornax", Action: moderation.ActionMask},
+}
+
+// How often rules added on other servers are picked up
+const moderationReloadInterval = time.Minute
+
+// The rules from config plus the ones admins have added, swapped out as a
+// whole whenever the database rules change
+type contentFilter struct {
+	dbQueries   *database.Queries
+	configRules []moderation.Rule
+	filter      atomic.Pointer[moderation.Filter]
+}
+
+// Reads rules from the file at path, or the defaults if path is blank
+func loadModerationRules(path string) ([]moderation.Rule, error) {
+	if path == "" {
+		return defaultModerationRules, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return moderation.ParseRules(f)
+}
+
+func newContentFilter(dbQueries *database.Queries, configRules []moderation.Rule) (*contentFilter, error) {
+	c := &contentFilter{dbQueries: dbQueries, configRules: configRules}
+	err := c.reload(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *contentFilter) Check(text string) moderation.Result {
+	return c.filter.Load().Check(text)
+}
+
+// Rebuilds the filter from config and whatever's in the database now
+func (c *contentFilter) reload(ctx context.Context) error {
+	rows, err := c.dbQueries.ListModerationRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules := append([]moderation.Rule{}, c.configRules...)
+	for _, row := range rows {
+		rules = append(rules, moderation.Rule{
+			ID:      row.ID.String(),
+			Pattern: row.Pattern,
+			Action:  moderation.Action(row.Action),
+		})
+	}
+
+	filter, err := moderation.NewFilter(rules)
+	if err != nil {
+		return err
+	}
+	c.filter.Store(filter)
+	return nil
+}
+
+// Keeps reloading so rules added through another server show up here too
+func (c *contentFilter) reloadEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.reload(ctx); err != nil {
+				log.Printf("Error reloading moderation rules: %s", err)
+			}
+		}
+	}
+}
+
+// Puts a chirp that matched a flag rule in the report queue, with no reporter
+func (cfg *ApiConfig) flagChirp(ctx context.Context, chirp database.Chirp, result moderation.Result) {
+	if !result.Flagged() {
+		return
+	}
+
+	_, err := cfg.DBQueries.CreateReport(ctx, database.CreateReportParams{
+		ChirpID:        uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		ChirpBody:      sql.NullString{String: chirp.Body, Valid: true},
+		ReportedUserID: chirp.UserID,
+		Category:       reportCategoryModerationRule,
+		Details:        "Matched " + strings.Join(result.Patterns(), ", "),
+	})
+	if err != nil {
+		log.Printf("Error flagging chirp %s: %s", chirp.ID, err)
+	}
+}
+
+type moderationRuleResponse struct {
+	ID        *uuid.UUID `json:"id"`
+	Pattern   string     `json:"pattern"`
+	Action    string     `json:"action"`
+	Source    string     `json:"source"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+func newModerationRuleResponse(rule database.ModerationRule) moderationRuleResponse {
+	resp := moderationRuleResponse{
+		ID:        &rule.ID,
+		Pattern:   rule.Pattern,
+		Action:    rule.Action,
+		Source:    "database",
+		CreatedAt: &rule.CreatedAt,
+	}
+	if rule.CreatedBy.Valid {
+		resp.CreatedBy = &rule.CreatedBy.UUID
+	}
+	return resp
+}
+
+// Lists every rule in use, the config ones can only be changed by editing
+// the file and restarting
+func (cfg *ApiConfig) getModerationRules(w http.ResponseWriter, r *http.Request) {
+	rows, err := cfg.DBQueries.ListModerationRules(r.Context())
+	if err != nil {
+		log.Printf("Error listing moderation rules: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to list moderation rules")
+		return
+	}
+
+	rules := []moderationRuleResponse{}
+	for _, rule := range cfg.moderation.configRules {
+		rules = append(rules, moderationRuleResponse{
+			Pattern: rule.Pattern,
+			Action:  string(rule.Action),
+			Source:  "config",
+		})
+	}
+	for _, row := range rows {
+		rules = append(rules, newModerationRuleResponse(row))
+	}
+
+	err = respondWithJSON(w, http.StatusOK, rules)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+func (cfg *ApiConfig) createModerationRule(w http.ResponseWriter, r *http.Request) {
+	adminID, _, err := cfg.staffUser(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	var params struct {
+		Pattern string `json:"pattern"`
+		Action  string `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	rule := moderation.Rule{
+		Pattern: strings.Join(strings.Fields(params.Pattern), " "),
+		Action:  moderation.Action(params.Action),
+	}
+	if !rule.Action.Valid() {
+		respondWithError(w, http.StatusBadRequest, "Action must be mask, reject or flag")
+		return
+	}
+	// Catches patterns that are nothing but punctuation
+	if _, err := moderation.NewFilter([]moderation.Rule{rule}); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Pattern needs at least one word in it")
+		return
+	}
+
+	created, err := cfg.DBQueries.CreateModerationRule(r.Context(), database.CreateModerationRuleParams{
+		Pattern:   rule.Pattern,
+		Action:    string(rule.Action),
+		CreatedBy: uuid.NullUUID{UUID: adminID, Valid: true},
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			respondWithError(w, http.StatusConflict, "There's already a rule for that pattern")
+			return
+		}
+		log.Printf("Error creating moderation rule: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to create moderation rule")
+		return
+	}
+
+	if err := cfg.moderation.reload(r.Context()); err != nil {
+		log.Printf("Error reloading moderation rules: %s", err)
+	}
+
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditRuleCreated,
+		ActorID:    actor(adminID),
+		TargetType: "moderation_rule",
+		TargetID:   created.ID.String(),
+		Metadata:   map[string]any{"after": auditModerationRule(created)},
+	})
+
+	err = respondWithJSON(w, http.StatusCreated, newModerationRuleResponse(created))
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+func (cfg *ApiConfig) deleteModerationRule(w http.ResponseWriter, r *http.Request) {
+	ruleID, err := uuid.Parse(r.PathValue("ruleID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid rule ID format")
+		return
+	}
+
+	deleted, err := cfg.DBQueries.DeleteModerationRule(r.Context(), ruleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Moderation rule not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting moderation rule: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to delete moderation rule")
+		return
+	}
+
+	if err := cfg.moderation.reload(r.Context()); err != nil {
+		log.Printf("Error reloading moderation rules: %s", err)
+	}
+
+	adminID, _, _ := cfg.staffUser(r)
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditRuleDeleted,
+		ActorID:    actor(adminID),
+		TargetType: "moderation_rule",
+		TargetID:   deleted.ID.String(),
+		Metadata:   map[string]any{"before": auditModerationRule(deleted)},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func auditModerationRule(rule database.ModerationRule) map[string]any {
+	return map[string]any{"pattern": rule.Pattern, "action": rule.Action}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Kinds of notification a user can get
+const (
+	notifyFollow    = "follow"
+	notifyLike      = "like"
+	notifyReply     = "reply"
+	notifyMention   = "mention"
+	notifyRechirp   = "rechirp"
+	notifyQuote     = "quote"
+	notifyChirpyRed = "chirpy_red"
+)
+
+// One line in the notifications list, likes and rechirps of the same
+// chirp are rolled up into a single entry
+type notificationGroup struct {
+	ID         uuid.UUID   `json:"id"`
+	Kind       string      `json:"kind"`
+	ChirpID    *uuid.UUID  `json:"chirp_id,omitempty"`
+	ActorIDs   []uuid.UUID `json:"actor_ids"`
+	ActorCount int64       `json:"actor_count"`
+	Message    string      `json:"message"`
+	Read       bool        `json:"read"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+type notificationPage struct {
+	UnreadCount   int64               `json:"unread_count"`
+	Notifications []notificationGroup `json:"notifications"`
+	NextOffset    *int                `json:"next_offset,omitempty"`
+}
+
+// Hooks the notification service up to the events it turns into notifications
+func (cfg *ApiConfig) registerNotifications(bus *eventBus) {
+	bus.subscribe(eventFollow, cfg.notifyOnFollow)
+	bus.subscribe(eventLike, cfg.notifyOnLike)
+	bus.subscribe(eventChirpCreated, cfg.notifyOnChirp)
+	bus.subscribe(eventChirpCreated, cfg.notifyOnMentions)
+	bus.subscribe(eventChirpEdited, cfg.notifyOnMentions)
+	bus.subscribe(eventChirpyRed, cfg.notifyOnChirpyRed)
+}
+
+// Saves a notification, nobody gets notified about their own actions
+// and the same thing only notifies once
+func (cfg *ApiConfig) notify(ctx context.Context, userID uuid.UUID, kind string, actorID, chirpID uuid.NullUUID) error {
+	if actorID.Valid && actorID.UUID == userID {
+		return nil
+	}
+
+	// Likes and rechirps of the same chirp get grouped together
+	var groupKey sql.NullString
+	if (kind == notifyLike || kind == notifyRechirp) && chirpID.Valid {
+		groupKey = sql.NullString{String: kind + ":" + chirpID.UUID.String(), Valid: true}
+	}
+
+	return cfg.DBQueries.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:   userID,
+		Kind:     kind,
+		ActorID:  actorID,
+		ChirpID:  chirpID,
+		GroupKey: groupKey,
+	})
+}
+
+func (cfg *ApiConfig) notifyOnFollow(ctx context.Context, ev event) error {
+	if !ev.UserID.Valid {
+		return nil
+	}
+	return cfg.notify(ctx, ev.UserID.UUID, notifyFollow, uuid.NullUUID{UUID: ev.ActorID, Valid: true}, uuid.NullUUID{})
+}
+
+func (cfg *ApiConfig) notifyOnLike(ctx context.Context, ev event) error {
+	author, err := cfg.chirpAuthor(ctx, ev.ChirpID)
+	if err != nil || !author.Valid {
+		return err
+	}
+	return cfg.notify(ctx, author.UUID, notifyLike, uuid.NullUUID{UUID: ev.ActorID, Valid: true}, ev.ChirpID)
+}
+
+// Tells the author of the chirp being replied to, rechirped or quoted
+func (cfg *ApiConfig) notifyOnChirp(ctx context.Context, ev event) error {
+	if !ev.ChirpID.Valid {
+		return nil
+	}
+
+	chirp, err := cfg.DBQueries.GetChirp(ctx, ev.ChirpID.UUID)
+	if err != nil {
+		return err
+	}
+
+	actor := uuid.NullUUID{UUID: ev.ActorID, Valid: true}
+
+	if chirp.InReplyTo.Valid {
+		author, err := cfg.chirpAuthor(ctx, chirp.InReplyTo)
+		if err != nil {
+			return err
+		}
+		if author.Valid {
+			err = cfg.notify(ctx, author.UUID, notifyReply, actor, ev.ChirpID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if chirp.ReferenceID.Valid {
+		author, err := cfg.chirpAuthor(ctx, chirp.ReferenceID)
+		if err != nil || !author.Valid {
+			return err
+		}
+
+		// Rechirps point at the original so they group up, quotes point
+		// at the quote so you can read what was said
+		if chirp.Kind == chirpKindRechirp {
+			return cfg.notify(ctx, author.UUID, notifyRechirp, actor, chirp.ReferenceID)
+		}
+		return cfg.notify(ctx, author.UUID, notifyQuote, actor, ev.ChirpID)
+	}
+
+	return nil
+}
+
+// Mentions are already resolved to users by the time the event is published
+func (cfg *ApiConfig) notifyOnMentions(ctx context.Context, ev event) error {
+	if !ev.ChirpID.Valid {
+		return nil
+	}
+
+	mentions, err := cfg.DBQueries.ListChirpMentions(ctx, []uuid.UUID{ev.ChirpID.UUID})
+	if err != nil {
+		return err
+	}
+
+	actor := uuid.NullUUID{UUID: ev.ActorID, Valid: true}
+	for _, mention := range mentions {
+		err = cfg.notify(ctx, mention.UserID, notifyMention, actor, ev.ChirpID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cfg *ApiConfig) notifyOnChirpyRed(ctx context.Context, ev event) error {
+	return cfg.notify(ctx, ev.ActorID, notifyChirpyRed, uuid.NullUUID{}, uuid.NullUUID{})
+}
+
+// Finds who wrote a chirp, not valid if the chirp is gone or deleted
+func (cfg *ApiConfig) chirpAuthor(ctx context.Context, chirpID uuid.NullUUID) (uuid.NullUUID, error) {
+	if !chirpID.Valid {
+		return uuid.NullUUID{}, nil
+	}
+
+	chirp, err := cfg.DBQueries.GetChirp(ctx, chirpID.UUID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.NullUUID{}, nil
+		}
+		return uuid.NullUUID{}, err
+	}
+	if chirp.DeletedAt.Valid {
+		return uuid.NullUUID{}, nil
+	}
+
+	return uuid.NullUUID{UUID: chirp.UserID, Valid: true}, nil
+}
+
+// Builds the text for a notification, e.g. "5 people liked your chirp"
+func notificationMessage(kind string, actors int64) string {
+	who := "Someone"
+	if actors > 1 {
+		who = fmt.Sprintf("%d people", actors)
+	}
+
+	switch kind {
+	case notifyFollow:
+		return who + " followed you"
+	case notifyLike:
+		return who + " liked your chirp"
+	case notifyReply:
+		return who + " replied to your chirp"
+	case notifyMention:
+		return who + " mentioned you"
+	case notifyRechirp:
+		return who + " rechirped your chirp"
+	case notifyQuote:
+		return who + " quoted your chirp"
+	case notifyChirpyRed:
+		return "Welcome to Chirpy Red!"
+	}
+	return "You have a new notification"
+}
+
+// Lists the authenticated user's notifications, newest first
+// unread=true only returns the ones that haven't been read yet
+func (cfg *ApiConfig) getNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, auth.ScopeChirpsRead)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	// Ask for one extra so we know if there's another page
+	rows, err := cfg.DBQueries.ListNotificationGroups(r.Context(), database.ListNotificationGroupsParams{
+		UserID:     userID,
+		UnreadOnly: unreadOnly,
+		Limit:      int32(limit + 1),
+		Offset:     int32(offset),
+	})
+	if err != nil {
+		log.Printf("Error listing notifications: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch notifications")
+		return
+	}
+
+	unread, err := cfg.DBQueries.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error counting notifications: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch notifications")
+		return
+	}
+
+	page := notificationPage{
+		UnreadCount:   unread,
+		Notifications: []notificationGroup{},
+	}
+
+	if len(rows) > limit {
+		rows = rows[:limit]
+		next := offset + limit
+		page.NextOffset = &next
+	}
+
+	for _, row := range rows {
+		group := notificationGroup{
+			ID:         row.ID,
+			Kind:       row.Kind,
+			ActorIDs:   row.RecentActorIds,
+			ActorCount: row.ActorCount,
+			Message:    notificationMessage(row.Kind, row.ActorCount),
+			Read:       row.UnreadCount == 0,
+			CreatedAt:  row.LatestAt,
+		}
+		if group.ActorIDs == nil {
+			group.ActorIDs = []uuid.UUID{}
+		}
+		if row.ChirpID.Valid {
+			group.ChirpID = &row.ChirpID.UUID
+		}
+		page.Notifications = append(page.Notifications, group)
+	}
+
+	err = respondWithJSON(w, http.StatusOK, page)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Marks a notification as read, along with the rest of its group
+func (cfg *ApiConfig) markNotificationRead(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	notificationID, err := uuid.Parse(r.PathValue("notificationID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid notification ID format")
+		return
+	}
+
+	_, err = cfg.DBQueries.GetNotification(r.Context(), database.GetNotificationParams{
+		ID:     notificationID,
+		UserID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Notification not found")
+			return
+		}
+		log.Printf("Error finding notification: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to update notification")
+		return
+	}
+
+	err = cfg.DBQueries.MarkNotificationGroupRead(r.Context(), database.MarkNotificationGroupReadParams{
+		UserID: userID,
+		ID:     notificationID,
+	})
+	if err != nil {
+		log.Printf("Error marking notification read: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to update notification")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Marks every notification the authenticated user has as read
+func (cfg *ApiConfig) markAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	err = cfg.DBQueries.MarkAllNotificationsRead(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error marking notifications read: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to update notifications")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
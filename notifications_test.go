@@ -0,0 +1,13 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationMessage(t *testing.T) {
+	assert.Equal(t, "Someone liked your chirp", notificationMessage(notifyLike, 1))
+	assert.Equal(t, "5 people liked your chirp", notificationMessage(notifyLike, 5))
+	assert.Equal(t, "Someone followed you", notificationMessage(notifyFollow, 1))
+}
@@ -0,0 +1,737 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/audit"
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Authorization codes have to be swapped for tokens quickly (RFC 6749 4.1.2)
+const oauthCodeTTL = 10 * time.Minute
+
+// Used codes are kept a while after expiring so reusing one still revokes
+// what the first use got
+const oauthCodeKeepFor = 24 * time.Hour
+
+const oauthCodePruneInterval = time.Hour
+
+// Same lifetime as the access tokens handed out at login
+const oauthAccessTTL = time.Hour
+
+// What each scope lets an app do, shown on the consent page
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:   "Read chirps, your timeline, mentions and notifications",
+	auth.ScopeChirpsWrite:  "Post, edit, delete and like chirps as you",
+	auth.ScopeProfileWrite: "Change your profile and who you follow",
+}
+
+// An error the app is told about (RFC 6749 5.2), either as JSON from the
+// token endpoint or in the query string of its redirect URI
+type oauthError struct {
+	Code        string
+	Description string
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func respondWithOAuthError(w http.ResponseWriter, code int, e *oauthError) {
+	w.Header().Set("Cache-Control", "no-store")
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+
+	err := respondWithJSON(w, code, map[string]string{
+		"error":             e.Code,
+		"error_description": e.Description,
+	})
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Adds params to the query string of a redirect URI, keeping any it already has
+func redirectWithParams(redirectURI string, params map[string]string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, value := range params {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// A checked request from an app for a user's permission
+type authorizeRequest struct {
+	Client          database.OauthClient
+	RedirectURI     string
+	RedirectURISent bool
+	Scopes          []string
+	State           string
+	CodeChallenge   string
+}
+
+// The parameters an authorize request is made of, carried through the consent form
+var authorizeParams = []string{"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method"}
+
+// Checks an authorize request. Problems with the client or redirect URI are
+// plain errors shown to the user, since we can't trust where we'd send them,
+// anything else is an *oauthError to send back to the app
+func (cfg *ApiConfig) parseAuthorizeRequest(ctx context.Context, values url.Values) (authorizeRequest, error) {
+	var req authorizeRequest
+
+	clientID, err := uuid.Parse(values.Get("client_id"))
+	if err != nil {
+		return req, errors.New("This app isn't registered with Chirpy")
+	}
+
+	req.Client, err = cfg.DBQueries.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return req, errors.New("This app isn't registered with Chirpy")
+		}
+		log.Printf("Error getting OAuth client: %s", err)
+		return req, errors.New("Something went wrong, try again")
+	}
+
+	// Has to be exactly one the app registered, it can be left out if there's only one
+	req.RedirectURI = values.Get("redirect_uri")
+	req.RedirectURISent = req.RedirectURI != ""
+	if req.RedirectURI == "" && len(req.Client.RedirectUris) == 1 {
+		req.RedirectURI = req.Client.RedirectUris[0]
+	}
+	registered := false
+	for _, uri := range req.Client.RedirectUris {
+		if uri == req.RedirectURI {
+			registered = true
+		}
+	}
+	if !registered {
+		return req, errors.New("This app asked to send you somewhere it isn't registered to use")
+	}
+
+	req.State = values.Get("state")
+
+	if values.Get("response_type") != "code" {
+		return req, &oauthError{"unsupported_response_type", "only the code response type is supported"}
+	}
+
+	// PKCE is required for every app, and only S256
+	req.CodeChallenge = values.Get("code_challenge")
+	if !auth.ValidPKCEValue(req.CodeChallenge) {
+		return req, &oauthError{"invalid_request", "a valid code_challenge is required"}
+	}
+	if values.Get("code_challenge_method") != "S256" {
+		return req, &oauthError{"invalid_request", "code_challenge_method must be S256"}
+	}
+
+	req.Scopes, err = auth.ParseScopes(strings.Fields(values.Get("scope")))
+	if err != nil {
+		return req, &oauthError{"invalid_scope", err.Error()}
+	}
+
+	return req, nil
+}
+
+var consentPage = template.Must(template.New("consent").Parse(`<html>
+<body>
+	<h1>{{.ClientName}} wants to use your Chirpy account</h1>
+	{{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+	<p>If you allow it, it will be able to:</p>
+	<ul>
+	{{range .Scopes}}<li>{{.}}</li>
+	{{end}}</ul>
+	<p>It won't see your password. You can remove it any time from your sessions.</p>
+	<form method="POST" action="/oauth/authorize">
+		{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+		{{end}}
+		<p><label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username"></label></p>
+		<p><label>Password <input type="password" name="password" autocomplete="current-password"></label></p>
+		<p><label>Two-factor code, if you use one <input type="text" name="code" autocomplete="one-time-code"></label></p>
+		<button type="submit" name="decision" value="allow">Allow</button>
+		<button type="submit" name="decision" value="deny">Deny</button>
+	</form>
+</body>
+</html>`))
+
+var authorizeErrorPage = template.Must(template.New("authorize_error").Parse(`<html>
+<body>
+	<h1>This app can't be authorized</h1>
+	<p>{{.}}</p>
+</body>
+</html>`))
+
+type consentData struct {
+	ClientName string
+	Scopes     []string
+	Params     map[string]string
+	Email      string
+	Error      string
+}
+
+// Pages with a login form on them can't be framed by other sites
+func setConsentHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+}
+
+func renderConsent(w http.ResponseWriter, code int, req authorizeRequest, values url.Values, email, message string) {
+	data := consentData{
+		ClientName: req.Client.Name,
+		Params:     map[string]string{},
+		Email:      email,
+		Error:      message,
+	}
+	for _, scope := range req.Scopes {
+		data.Scopes = append(data.Scopes, scopeDescriptions[scope])
+	}
+	for _, name := range authorizeParams {
+		if value := values.Get(name); value != "" {
+			data.Params[name] = value
+		}
+	}
+
+	setConsentHeaders(w)
+	w.WriteHeader(code)
+	err := consentPage.Execute(w, data)
+	if err != nil {
+		log.Printf("Error rendering consent page: %s", err)
+	}
+}
+
+// Responds to a bad authorize request, on our own page or back at the app
+func (cfg *ApiConfig) rejectAuthorizeRequest(w http.ResponseWriter, r *http.Request, req authorizeRequest, err error) {
+	var oauthErr *oauthError
+	if errors.As(err, &oauthErr) {
+		http.Redirect(w, r, redirectWithParams(req.RedirectURI, map[string]string{
+			"error":             oauthErr.Code,
+			"error_description": oauthErr.Description,
+			"state":             req.State,
+		}), http.StatusFound)
+		return
+	}
+
+	setConsentHeaders(w)
+	w.WriteHeader(http.StatusBadRequest)
+	err = authorizeErrorPage.Execute(w, err.Error())
+	if err != nil {
+		log.Printf("Error rendering authorize error page: %s", err)
+	}
+}
+
+// Shows the consent page for an app asking for access
+func (cfg *ApiConfig) authorizeForm(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	req, err := cfg.parseAuthorizeRequest(r.Context(), values)
+	if err != nil {
+		cfg.rejectAuthorizeRequest(w, r, req, err)
+		return
+	}
+
+	renderConsent(w, http.StatusOK, req, values, "", "")
+}
+
+// Checks the details typed into the consent page, with the same lockouts
+// and 2FA as logging in. Returns the user, or a message to show if it failed
+func (cfg *ApiConfig) consentLogin(ctx context.Context, r *http.Request, email, password, code string) (database.User, string) {
+	dbUser, wait, err := cfg.checkCredentials(ctx, r, email, password)
+	if wait > 0 {
+		return dbUser, "Too many failed attempts, try again later"
+	}
+	if err != nil {
+		return dbUser, "Incorrect email or password"
+	}
+
+	var stateErr *accountStateError
+	if errors.As(userStateError(dbUser.Status, dbUser.SuspendedUntil), &stateErr) {
+		return dbUser, stateErr.message()
+	}
+
+	enabled, err := cfg.twoFactorEnabled(ctx, dbUser.ID)
+	if err != nil {
+		log.Printf("Error checking 2FA: %s", err)
+		return dbUser, "Something went wrong, try again"
+	}
+	if !enabled {
+		return dbUser, ""
+	}
+
+	ok, wait, err := cfg.checkLoginCode(ctx, r, dbUser.ID, code)
+	if wait > 0 {
+		return dbUser, "Too many failed attempts, try again later"
+	}
+	if err != nil {
+		log.Printf("Error checking 2FA code: %s", err)
+		return dbUser, "Something went wrong, try again"
+	}
+	if !ok {
+		return dbUser, "Enter a valid two-factor code"
+	}
+
+	return dbUser, ""
+}
+
+// The consent form was submitted, sends the user back to the app with a
+// code if they allowed it
+func (cfg *ApiConfig) authorizeSubmit(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		setConsentHeaders(w)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	values := r.PostForm
+
+	req, err := cfg.parseAuthorizeRequest(ctx, values)
+	if err != nil {
+		cfg.rejectAuthorizeRequest(w, r, req, err)
+		return
+	}
+
+	if values.Get("decision") != "allow" {
+		cfg.rejectAuthorizeRequest(w, r, req, &oauthError{"access_denied", "the user denied the request"})
+		return
+	}
+
+	email := values.Get("email")
+	dbUser, message := cfg.consentLogin(ctx, r, email, values.Get("password"), values.Get("code"))
+	if message != "" {
+		renderConsent(w, http.StatusUnauthorized, req, values, email, message)
+		return
+	}
+
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditLoginSuccess,
+		ActorID:    actor(dbUser.ID),
+		TargetType: "oauth_client",
+		TargetID:   req.Client.ID.String(),
+		Metadata:   map[string]any{"scopes": req.Scopes},
+	})
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		renderConsent(w, http.StatusInternalServerError, req, values, email, "Something went wrong, try again")
+		return
+	}
+
+	err = cfg.DBQueries.CreateOAuthCode(ctx, database.CreateOAuthCodeParams{
+		CodeHash:        auth.HashToken(code),
+		ClientID:        req.Client.ID,
+		UserID:          dbUser.ID,
+		RedirectUri:     req.RedirectURI,
+		RedirectUriSent: req.RedirectURISent,
+		Scopes:          req.Scopes,
+		CodeChallenge:   req.CodeChallenge,
+		ExpiresAt:       time.Now().UTC().Add(oauthCodeTTL),
+	})
+	if err != nil {
+		log.Printf("Error saving authorization code: %s", err)
+		renderConsent(w, http.StatusInternalServerError, req, values, email, "Something went wrong, try again")
+		return
+	}
+
+	http.Redirect(w, r, redirectWithParams(req.RedirectURI, map[string]string{
+		"code":  code,
+		"state": req.State,
+	}), http.StatusFound)
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// The token endpoint, swaps an authorization code or a refresh token for
+// new tokens. Apps send a form, not JSON (RFC 6749 4.1.3 and 6)
+func (cfg *ApiConfig) oauthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_request", "the body must be a form"})
+		return
+	}
+
+	client, err := cfg.authenticateClient(r)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			respondWithOAuthError(w, http.StatusUnauthorized, &oauthError{"invalid_client", err.Error()})
+			return
+		}
+		log.Printf("Error authenticating OAuth client: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "unable to check client"})
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		cfg.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		cfg.exchangeOAuthRefreshToken(w, r, client)
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"unsupported_grant_type", "grant_type must be authorization_code or refresh_token"})
+	}
+}
+
+func (cfg *ApiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	ctx := r.Context()
+	codeHash := auth.HashToken(r.PostForm.Get("code"))
+
+	code, err := cfg.DBQueries.UseOAuthCode(ctx, codeHash)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error using authorization code: %s", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "unable to check code"})
+			return
+		}
+
+		// A code used twice might have been stolen, so the tokens the first
+		// use got are revoked too (RFC 6749 4.1.2)
+		used, err := cfg.DBQueries.GetOAuthCode(ctx, codeHash)
+		if err == nil && used.SessionID.Valid {
+			log.Printf("SECURITY: authorization code reused for client %s, revoked session %s", used.ClientID, used.SessionID.UUID)
+			err = cfg.DBQueries.RevokeTokenFamily(ctx, used.SessionID.UUID)
+			if err != nil {
+				log.Printf("Error revoking session %s: %s", used.SessionID.UUID, err)
+			}
+		}
+
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_grant", "code is invalid, expired or already used"})
+		return
+	}
+
+	if code.ClientID != client.ID {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_grant", "code was issued to another client"})
+		return
+	}
+
+	// If the app sent a redirect_uri to /oauth/authorize it has to send it again (RFC 6749 4.1.3)
+	redirectURI := r.PostForm.Get("redirect_uri")
+	if (code.RedirectUriSent || redirectURI != "") && redirectURI != code.RedirectUri {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_grant", "redirect_uri doesn't match the authorization request"})
+		return
+	}
+
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_grant", "code_verifier doesn't match the code_challenge"})
+		return
+	}
+
+	// The app gets its own session, so the user sees it and can sign it out
+	session, err := cfg.DBQueries.CreateOAuthSession(ctx, database.CreateOAuthSessionParams{
+		UserID:      code.UserID,
+		UserAgent:   r.UserAgent(),
+		IpAddress:   clientIP(r),
+		DeviceLabel: client.Name,
+		ClientID:    uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:      code.Scopes,
+	})
+	if err != nil {
+		log.Printf("Error starting OAuth session: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "unable to issue tokens"})
+		return
+	}
+
+	err = cfg.DBQueries.SetOAuthCodeSession(ctx, database.SetOAuthCodeSessionParams{
+		CodeHash:  codeHash,
+		SessionID: uuid.NullUUID{UUID: session.ID, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error linking authorization code to session: %s", err)
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "unable to issue tokens"})
+		return
+	}
+
+	err = auth.SaveRefreshToken(refreshToken, code.UserID, session.ID, *cfg.DBQueries)
+	if err != nil {
+		log.Printf("Error saving OAuth refresh token: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "unable to issue tokens"})
+		return
+	}
+
+	cfg.respondWithOAuthTokens(w, code.UserID, session.ID, client.ID, code.Scopes, refreshToken)
+}
+
+func (cfg *ApiConfig) exchangeOAuthRefreshToken(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	ctx := r.Context()
+	token := r.PostForm.Get("refresh_token")
+	clientID := uuid.NullUUID{UUID: client.ID, Valid: true}
+
+	newToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "unable to issue tokens"})
+		return
+	}
+
+	// Same rotation and reuse detection as /api/refresh, but only for this app's sessions
+	rotated, err := cfg.DBQueries.RotateOAuthRefreshToken(ctx, database.RotateOAuthRefreshTokenParams{
+		Token:    token,
+		ClientID: clientID,
+		NewToken: newToken,
+	})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error rotating OAuth refresh token: %s", err)
+			respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "unable to issue tokens"})
+			return
+		}
+		reason := cfg.refreshTokenFailure(ctx, token, clientID)
+		cfg.recordAudit(r, audit.Event{
+			Action:     auditRefreshFailure,
+			TargetType: "oauth_client",
+			TargetID:   client.ID.String(),
+			Metadata:   map[string]any{"reason": reason},
+		})
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_grant", strings.ToLower(reason)})
+		return
+	}
+
+	var stateErr *accountStateError
+	if errors.As(cfg.checkUserState(ctx, rotated.UserID), &stateErr) {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_grant", stateErr.Error()})
+		return
+	}
+
+	session, err := cfg.DBQueries.GetSession(ctx, rotated.FamilyID)
+	if err != nil {
+		log.Printf("Error getting OAuth session: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "unable to issue tokens"})
+		return
+	}
+
+	// The app can ask for less than it was given, never more (RFC 6749 6)
+	scopes := session.Scopes
+	if requested := r.PostForm.Get("scope"); requested != "" {
+		scopes, err = auth.ParseScopes(strings.Fields(requested))
+		if err != nil {
+			respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_scope", err.Error()})
+			return
+		}
+		for _, scope := range scopes {
+			if !auth.HasScope(session.Scopes, scope) {
+				respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_scope", scope + " wasn't granted"})
+				return
+			}
+		}
+	}
+
+	err = cfg.DBQueries.TouchSession(ctx, database.TouchSessionParams{
+		ID:        session.ID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+	})
+	if err != nil {
+		log.Printf("Error updating session: %s", err)
+	}
+
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditRefresh,
+		ActorID:    actor(rotated.UserID),
+		TargetType: "session",
+		TargetID:   session.ID.String(),
+		Metadata:   map[string]any{"client_id": client.ID},
+	})
+
+	cfg.respondWithOAuthTokens(w, rotated.UserID, session.ID, client.ID, scopes, newToken)
+}
+
+func (cfg *ApiConfig) respondWithOAuthTokens(w http.ResponseWriter, userID, sessionID, clientID uuid.UUID, scopes []string, refreshToken string) {
+	accessToken, err := cfg.jwtKeys.MakeOAuthJWT(userID, sessionID, clientID, scopes, oauthAccessTTL)
+	if err != nil {
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "unable to issue tokens"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	err = respondWithJSON(w, http.StatusOK, oauthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	})
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// What's known about a token, active is false for anything we won't vouch for
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// The session an app's token belongs to, if it's one of client's and still live
+// Access tokens are JWTs, anything else is looked up as a refresh token
+func (cfg *ApiConfig) clientTokenSession(ctx context.Context, client database.OauthClient, token string) (database.Session, introspectionResponse, bool) {
+	clientID := uuid.NullUUID{UUID: client.ID, Valid: true}
+
+	if claims, err := cfg.jwtKeys.AccessClaims(token); err == nil {
+		sessionID, err := uuid.Parse(claims.SessionID)
+		if err != nil || claims.ClientID != client.ID.String() {
+			return database.Session{}, introspectionResponse{}, false
+		}
+
+		session, err := cfg.DBQueries.GetSession(ctx, sessionID)
+		if err != nil || session.ClientID != clientID {
+			return session, introspectionResponse{}, false
+		}
+
+		return session, introspectionResponse{
+			Scope:     claims.Scope,
+			Subject:   claims.Subject,
+			TokenType: "Bearer",
+			ExpiresAt: claims.ExpiresAt.Unix(),
+			IssuedAt:  claims.IssuedAt.Unix(),
+		}, true
+	}
+
+	rows, err := cfg.DBQueries.GetUserFromRefreshToken(ctx, token)
+	if err != nil || len(rows) == 0 {
+		return database.Session{}, introspectionResponse{}, false
+	}
+	tokenInfo := rows[0]
+
+	session, err := cfg.DBQueries.GetSession(ctx, tokenInfo.FamilyID)
+	if err != nil || session.ClientID != clientID {
+		return session, introspectionResponse{}, false
+	}
+
+	resp := introspectionResponse{
+		Scope:     strings.Join(session.Scopes, " "),
+		Subject:   tokenInfo.UserID.String(),
+		TokenType: "refresh_token",
+		ExpiresAt: tokenInfo.ExpiresAt.Unix(),
+	}
+	if tokenInfo.RevokedAt.Valid || time.Now().After(tokenInfo.ExpiresAt) {
+		return session, resp, false
+	}
+	return session, resp, true
+}
+
+// Token introspection (RFC 7662), only for apps with a secret and only
+// about their own tokens
+func (cfg *ApiConfig) oauthIntrospect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_request", "the body must be a form"})
+		return
+	}
+
+	client, err := cfg.authenticateClient(r)
+	if err == nil && !client.SecretHash.Valid {
+		err = errInvalidClient
+	}
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			respondWithOAuthError(w, http.StatusUnauthorized, &oauthError{"invalid_client", "introspection needs a confidential client"})
+			return
+		}
+		log.Printf("Error authenticating OAuth client: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "unable to check client"})
+		return
+	}
+
+	resp := introspectionResponse{}
+	session, info, ok := cfg.clientTokenSession(r.Context(), client, r.PostForm.Get("token"))
+	if ok && !session.RevokedAt.Valid {
+		resp = info
+		resp.Active = true
+		resp.ClientID = client.ID.String()
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	err = respondWithJSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Token revocation (RFC 7009), revoking either token signs the app's whole
+// session out. Access tokens already issued work until they expire
+func (cfg *ApiConfig) oauthRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_request", "the body must be a form"})
+		return
+	}
+
+	client, err := cfg.authenticateClient(r)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			respondWithOAuthError(w, http.StatusUnauthorized, &oauthError{"invalid_client", err.Error()})
+			return
+		}
+		log.Printf("Error authenticating OAuth client: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "unable to check client"})
+		return
+	}
+
+	// Unknown and already revoked tokens still get a 200, token_type_hint
+	// isn't needed since we can tell them apart
+	session, _, _ := cfg.clientTokenSession(r.Context(), client, r.PostForm.Get("token"))
+	if session.ID != uuid.Nil && session.ClientID.Valid && session.ClientID.UUID == client.ID {
+		err = cfg.DBQueries.RevokeTokenFamily(r.Context(), session.ID)
+		if err != nil {
+			log.Printf("Error revoking OAuth session %s: %s", session.ID, err)
+			respondWithOAuthError(w, http.StatusServiceUnavailable, &oauthError{"temporarily_unavailable", "unable to revoke token"})
+			return
+		}
+
+		cfg.recordAudit(r, audit.Event{
+			Action:     auditRevoke,
+			ActorID:    actor(session.UserID),
+			TargetType: "session",
+			TargetID:   session.ID.String(),
+			Metadata:   map[string]any{"client_id": client.ID},
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Keeps clearing out authorization codes long after they've expired
+func (cfg *ApiConfig) pruneOAuthCodesEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := cfg.DBQueries.DeleteExpiredOAuthCodes(ctx, time.Now().UTC().Add(-oauthCodeKeepFor))
+			if err != nil {
+				log.Printf("Error pruning authorization codes: %s", err)
+			}
+		}
+	}
+}
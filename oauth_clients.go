@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// A third party app as shown to the user who registered it, the secret is
+// only ever sent back once when it's made
+type oauthClientResponse struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+func oauthClientFromDB(client database.OauthClient) oauthClientResponse {
+	return oauthClientResponse{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Confidential: client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// Where an app can ask for users to be sent back to: https anywhere,
+// http only to this machine, or an app's own scheme like com.example.app:/cb
+func validRedirectURI(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("redirect URI %q must be an absolute URL", s)
+	}
+	if u.Fragment != "" || strings.Contains(s, "#") {
+		return fmt.Errorf("redirect URI %q can't have a fragment", s)
+	}
+
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return fmt.Errorf("redirect URI %q needs a host", s)
+		}
+		return nil
+	case "http":
+		switch u.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+			return nil
+		}
+		return fmt.Errorf("redirect URI %q must use https unless it's localhost", s)
+	}
+
+	// Native apps use a reverse domain name they own as the scheme
+	if strings.Contains(u.Scheme, ".") {
+		return nil
+	}
+	return fmt.Errorf("redirect URI %q has a scheme that isn't allowed", s)
+}
+
+// Registers a new OAuth app owned by the logged in user
+// Confidential apps (ones with a server) get a secret, public ones rely on PKCE
+func (cfg *ApiConfig) createOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	var params struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Confidential bool     `json:"confidential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > maxTokenNameLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("App name must be 1 to %d characters", maxTokenNameLength))
+		return
+	}
+
+	if len(params.RedirectURIs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one redirect URI is required")
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if err := validRedirectURI(uri); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if params.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't register app")
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.DBQueries.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      userID,
+		Name:         name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+	})
+	if err != nil {
+		log.Printf("Error registering OAuth client: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't register app")
+		return
+	}
+
+	resp := oauthClientFromDB(client)
+	resp.ClientSecret = secret
+
+	err = respondWithJSON(w, http.StatusCreated, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Lists the OAuth apps the logged in user has registered
+func (cfg *ApiConfig) getOAuthClients(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	clients, err := cfg.DBQueries.ListOAuthClients(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing OAuth clients: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to list apps")
+		return
+	}
+
+	resp := []oauthClientResponse{}
+	for _, client := range clients {
+		resp = append(resp, oauthClientFromDB(client))
+	}
+
+	err = respondWithJSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Deletes one of the logged in user's OAuth apps, every session it has
+// with any user goes with it
+func (cfg *ApiConfig) deleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid client ID format")
+		return
+	}
+
+	deleted, err := cfg.DBQueries.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      clientID,
+		OwnerID: userID,
+	})
+	if err != nil {
+		log.Printf("Error deleting OAuth client: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to delete app")
+		return
+	}
+
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "App not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unknown apps and wrong secrets look the same from outside
+var errInvalidClient = errors.New("invalid client credentials")
+
+// Works out which app is calling the token, introspection or revocation
+// endpoint, from HTTP Basic auth or client_id/client_secret in the form
+func (cfg *ApiConfig) authenticateClient(r *http.Request) (database.OauthClient, error) {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		// Basic auth values are form encoded first (RFC 6749 2.3.1)
+		var err error
+		if id, err = url.QueryUnescape(id); err != nil {
+			return database.OauthClient{}, errInvalidClient
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return database.OauthClient{}, errInvalidClient
+		}
+	} else {
+		id = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(id)
+	if err != nil {
+		return database.OauthClient{}, errInvalidClient
+	}
+
+	client, err := cfg.DBQueries.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return client, errInvalidClient
+		}
+		return client, err
+	}
+
+	// Public apps can't keep a secret so they don't get one
+	if !client.SecretHash.Valid {
+		if secret != "" {
+			return client, errInvalidClient
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return client, errInvalidClient
+	}
+	return client, nil
+}
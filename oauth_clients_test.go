@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidRedirectURI(t *testing.T) {
+	for _, good := range []string{"https://app.example.com/callback", "http://localhost:8080/cb", "http://127.0.0.1/cb", "com.example.app:/oauth"} {
+		assert.NoError(t, validRedirectURI(good), good)
+	}
+	for _, bad := range []string{"", "/callback", "http://app.example.com/cb", "https://app.example.com/cb#frag", "javascript:alert(1)", "https:///cb"} {
+		assert.Error(t, validRedirectURI(bad), bad)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCodeVerifier = "a-code-verifier-that-is-at-least-forty-three-characters"
+
+func TestCodeExchangeNeedsRedirectURIIfSent(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+	alice := createTestUser(t, cfg, "alice@example.com")
+	client, err := cfg.DBQueries.CreateOAuthClient(ctx, database.CreateOAuthClientParams{
+		OwnerID:      alice.ID,
+		Name:         "test app",
+		RedirectUris: []string{"https://app.example.com/callback"},
+	})
+	require.NoError(t, err)
+
+	exchange := func(sent bool, form url.Values) int {
+		code, err := auth.MakeRefreshToken()
+		require.NoError(t, err)
+		err = cfg.DBQueries.CreateOAuthCode(ctx, database.CreateOAuthCodeParams{
+			CodeHash:        auth.HashToken(code),
+			ClientID:        client.ID,
+			UserID:          alice.ID,
+			RedirectUri:     "https://app.example.com/callback",
+			RedirectUriSent: sent,
+			Scopes:          []string{auth.ScopeChirpsRead},
+			CodeChallenge:   auth.PKCEChallenge(testCodeVerifier),
+			ExpiresAt:       time.Now().UTC().Add(oauthCodeTTL),
+		})
+		require.NoError(t, err)
+
+		form.Set("code", code)
+		form.Set("code_verifier", testCodeVerifier)
+		req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		require.NoError(t, req.ParseForm())
+		rec := httptest.NewRecorder()
+		cfg.exchangeAuthorizationCode(rec, req, client)
+		return rec.Code
+	}
+
+	// Sent to /oauth/authorize, so leaving it out here isn't allowed
+	assert.Equal(t, http.StatusBadRequest, exchange(true, url.Values{}))
+	assert.Equal(t, http.StatusOK, exchange(true, url.Values{"redirect_uri": {"https://app.example.com/callback"}}))
+
+	// Left out both times is fine, but a different one never is
+	assert.Equal(t, http.StatusOK, exchange(false, url.Values{}))
+	assert.Equal(t, http.StatusBadRequest, exchange(false, url.Values{"redirect_uri": {"https://evil.example.com/"}}))
+}
+
+func TestRedirectWithParams(t *testing.T) {
+	assert.Equal(t, "https://app.example.com/cb?code=abc&state=xyz",
+		redirectWithParams("https://app.example.com/cb", map[string]string{"code": "abc", "state": "xyz"}))
+
+	// Keeps the app's own query, and leaves out empty values
+	assert.Equal(t, "https://app.example.com/cb?code=abc&tenant=1",
+		redirectWithParams("https://app.example.com/cb?tenant=1", map[string]string{"code": "abc", "state": ""}))
+}
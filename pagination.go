@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Page sizes for the list endpoints
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// A cursor points at the last row of the previous page, keyed on (created_at, id)
+// so rows sharing a timestamp are never skipped or repeated
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// The parsed limit/cursor/sort query parameters of a list request, Desc is
+// only set by parseSortedPageParams
+type pageParams struct {
+	Limit  int
+	Cursor *pageCursor
+	Desc   bool
+}
+
+// Response envelope for a page of chirps
+type chirpPage struct {
+	Chirps     []Chirp `json:"chirps"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// Turns a cursor into the opaque string handed out to clients
+func encodeCursor(c pageCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Reverses encodeCursor, rejecting anything we didn't hand out
+func decodeCursor(s string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+
+	return pageCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// Reads limit and cursor from the query string, for lists that only go one
+// way. Asking for a sort is an error rather than being quietly ignored
+func parsePageParams(r *http.Request) (pageParams, error) {
+	if r.URL.Query().Has("sort") {
+		return pageParams{}, errors.New("sort isn't supported on this list")
+	}
+	return parseLimitCursor(r)
+}
+
+// Same as parsePageParams plus sort, for lists that can go either way
+func parseSortedPageParams(r *http.Request) (pageParams, error) {
+	params, err := parseLimitCursor(r)
+	if err != nil {
+		return pageParams{}, err
+	}
+
+	switch r.URL.Query().Get("sort") {
+	case "", "asc":
+		params.Desc = false
+	case "desc":
+		params.Desc = true
+	default:
+		return pageParams{}, errors.New("sort must be asc or desc")
+	}
+
+	return params, nil
+}
+
+func parseLimitCursor(r *http.Request) (pageParams, error) {
+	query := r.URL.Query()
+	params := pageParams{Limit: defaultPageLimit}
+
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return pageParams{}, errors.New("limit must be a positive integer")
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+		params.Limit = limit
+	}
+
+	if s := query.Get("cursor"); s != "" {
+		cursor, err := decodeCursor(s)
+		if err != nil {
+			return pageParams{}, err
+		}
+		params.Cursor = &cursor
+	}
+
+	return params, nil
+}
+
+// Reads limit and offset from the query string, for lists that can't be keyed
+// on (created_at, id) like search results and threads
+func parseLimitOffset(r *http.Request) (limit, offset int, err error) {
+	query := r.URL.Query()
+	limit = defaultPageLimit
+
+	if s := query.Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			return 0, 0, errors.New("limit must be a positive integer")
+		}
+		limit = min(limit, maxPageLimit)
+	}
+
+	if s := query.Get("offset"); s != "" {
+		offset, err = strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// Builds a page from rows fetched with limit+1, the extra row only tells us
+// there's more, the cursor is the last row we actually return
+func newChirpPage(chirpsFromDB []database.Chirp, limit int) chirpPage {
+	page := chirpPage{Chirps: []Chirp{}}
+	for i, chirp := range chirpsFromDB {
+		if i == limit {
+			last := chirpsFromDB[i-1]
+			page.NextCursor = encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+			break
+		}
+		page.Chirps = append(page.Chirps, chirpFromDB(chirp))
+	}
+	return page
+}
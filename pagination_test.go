@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Lists that only go one way turn sort away instead of quietly ignoring it
+func TestParsePageParamsSort(t *testing.T) {
+	_, err := parsePageParams(httptest.NewRequest("GET", "/api/timeline?sort=asc", nil))
+	assert.Error(t, err)
+
+	page, err := parsePageParams(httptest.NewRequest("GET", "/api/timeline?limit=5", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 5, page.Limit)
+
+	page, err = parseSortedPageParams(httptest.NewRequest("GET", "/api/chirps?sort=desc", nil))
+	require.NoError(t, err)
+	assert.True(t, page.Desc)
+
+	_, err = parseSortedPageParams(httptest.NewRequest("GET", "/api/chirps?sort=sideways", nil))
+	assert.Error(t, err)
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+
+	// Build a cursor from a known row
+	cursor := pageCursor{
+		CreatedAt: time.Date(2025, 3, 14, 9, 26, 53, 589000000, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	// Encoding then decoding should give back the same row
+	decoded, err := decodeCursor(encodeCursor(cursor))
+	assert.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, cursor.ID, decoded.ID)
+
+	// Anything we didn't hand out should be rejected
+	_, err = decodeCursor("not-a-cursor")
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Works out how new passwords are hashed from PASSWORD_HASH (argon2id or
+// bcrypt), ARGON2_PARAMS (like "m=65536,t=3,p=2") and BCRYPT_COST
+func passwordHasherFromEnv(algorithm, argon2Params, bcryptCost string) (auth.PasswordHasher, error) {
+	switch algorithm {
+	case "", "argon2id":
+		params, err := auth.ParseArgon2Params(argon2Params)
+		if err != nil {
+			return nil, err
+		}
+		return auth.Argon2idHasher{Params: params}, nil
+
+	case "bcrypt":
+		cost := bcrypt.DefaultCost
+		if bcryptCost != "" {
+			var err error
+			cost, err = strconv.Atoi(bcryptCost)
+			if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+				return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+			}
+		}
+		return auth.BcryptHasher{Cost: cost}, nil
+	}
+
+	return nil, fmt.Errorf("PASSWORD_HASH must be argon2id or bcrypt")
+}
+
+// Swaps an out of date hash for one made with the current settings,
+// only possible right after login while we have the password
+func (cfg *ApiConfig) upgradePasswordHash(ctx context.Context, dbUser database.User, password string) {
+	if !auth.NeedsRehash(dbUser.HashedPassword) {
+		return
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing password: %s", err)
+		return
+	}
+
+	// Does nothing if the password was changed in the meantime
+	err = cfg.DBQueries.RehashPassword(ctx, database.RehashPasswordParams{
+		NewHash: hash,
+		ID:      dbUser.ID,
+		OldHash: dbUser.HashedPassword,
+	})
+	if err != nil {
+		log.Printf("Error saving rehashed password: %s", err)
+	}
+}
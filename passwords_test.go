@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordHasherFromEnv(t *testing.T) {
+	hasher, err := passwordHasherFromEnv("", "m=19456,t=2,p=1", "")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(19456), hasher.(auth.Argon2idHasher).Params.Memory)
+
+	hasher, err = passwordHasherFromEnv("bcrypt", "", "12")
+	assert.NoError(t, err)
+	assert.Equal(t, auth.BcryptHasher{Cost: 12}, hasher)
+
+	_, err = passwordHasherFromEnv("bcrypt", "", "99")
+	assert.Error(t, err)
+	_, err = passwordHasherFromEnv("md5", "", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/ratelimit"
+	"github.com/google/uuid"
+)
+
+// A limit on a group of routes
+type rateLimitPolicy struct {
+	ratelimit.Policy
+	// Counts logged in users' requests against them rather than their
+	// address, requests without a valid token still go by address
+	byUser bool
+}
+
+var (
+	loginRateLimit = rateLimitPolicy{
+		Policy: ratelimit.Policy{Name: "login", Limit: 5, Per: time.Minute},
+	}
+	signupRateLimit = rateLimitPolicy{
+		Policy: ratelimit.Policy{Name: "signup", Limit: 10, Per: time.Hour},
+	}
+	// Verification emails, so we can't be used to spam
+	emailRateLimit = rateLimitPolicy{
+		Policy: ratelimit.Policy{Name: "email", Limit: 5, Per: time.Hour},
+		byUser: true,
+	}
+	// Same for password resets, asked for while logged out so only the
+	// address is known
+	passwordResetRateLimit = rateLimitPolicy{
+		Policy: ratelimit.Policy{Name: "password_reset", Limit: 5, Per: time.Hour},
+	}
+	chirpRateLimit = rateLimitPolicy{
+		Policy: ratelimit.Policy{Name: "chirps", Limit: 30, Per: time.Minute},
+		byUser: true,
+	}
+	reportRateLimit = rateLimitPolicy{
+		Policy: ratelimit.Policy{Name: "reports", Limit: 20, Per: time.Hour},
+		byUser: true,
+	}
+)
+
+var rateLimitPolicies = []rateLimitPolicy{loginRateLimit, signupRateLimit, emailRateLimit, passwordResetRateLimit, chirpRateLimit, reportRateLimit}
+
+// How often buckets nobody has used for a while are cleared out
+const rateLimitPruneInterval = 10 * time.Minute
+
+// Who a request counts against. Tokens are only checked enough to know
+// who they belong to, the handler still does the real checks
+func (cfg *ApiConfig) rateLimitID(r *http.Request, byUser bool) string {
+	if byUser {
+		token, err := auth.GetBearerToken(r.Header)
+		if err == nil {
+			// Personal access tokens count against whoever owns them, so
+			// making more tokens doesn't get anyone more requests
+			if auth.IsAccessToken(token) {
+				if userID, ok := cfg.accessTokenOwner(r.Context(), token); ok {
+					return "user:" + userID.String()
+				}
+				return "ip:" + clientIP(r)
+			}
+			claims, err := cfg.jwtKeys.AccessClaims(token)
+			if err == nil {
+				return "user:" + claims.Subject
+			}
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+// The user a personal access token belongs to, if it's one that still works
+func (cfg *ApiConfig) accessTokenOwner(ctx context.Context, token string) (uuid.UUID, bool) {
+	dbToken, err := cfg.DBQueries.GetAccessTokenByHash(ctx, auth.HashToken(token))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error looking up access token: %s", err)
+		}
+		return uuid.Nil, false
+	}
+	if dbToken.RevokedAt.Valid || (dbToken.ExpiresAt.Valid && time.Now().After(dbToken.ExpiresAt.Time)) {
+		return uuid.Nil, false
+	}
+	return dbToken.UserID, true
+}
+
+// Wraps a handler so it can only be called as often as policy allows,
+// responding 429 with a Retry-After once the limit is used up
+func (cfg *ApiConfig) rateLimit(policy rateLimitPolicy, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.rateLimiter == nil {
+			next(w, r)
+			return
+		}
+
+		res, err := cfg.rateLimiter.Allow(r.Context(), policy.Policy, cfg.rateLimitID(r, policy.byUser))
+		if err != nil {
+			// Same as the lockouts, better to let it through than to stop
+			// everything when the store is down
+			log.Printf("Error checking %s rate limit: %s", policy.Name, err)
+			next(w, r)
+			return
+		}
+
+		// The RateLimit-* headers from the IETF draft, on every response so
+		// clients can slow down before they hit the limit
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Per.Seconds())))
+		w.Header().Set("RateLimit-Limit", fmt.Sprint(res.Limit))
+		w.Header().Set("RateLimit-Remaining", fmt.Sprint(res.Remaining))
+		w.Header().Set("RateLimit-Reset", fmt.Sprint(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			w.Header().Set("Retry-After", fmt.Sprint(ceilSeconds(res.RetryAfter)))
+			respondWithError(w, http.StatusTooManyRequests, "Too many requests, try again later")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Keeps clearing out buckets that have filled back up
+func (cfg *ApiConfig) pruneRateLimitsEvery(ctx context.Context, interval time.Duration) {
+	var longest time.Duration
+	for _, policy := range rateLimitPolicies {
+		longest = max(longest, policy.Per)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.rateLimiter.Prune(ctx, longest); err != nil {
+				log.Printf("Error pruning rate limits: %s", err)
+			}
+		}
+	}
+}
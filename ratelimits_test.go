@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitIDUsesAccessTokenOwner(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+
+	id := func(token string) string {
+		req := httptest.NewRequest("POST", "/api/chirps", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return cfg.rateLimitID(req, true)
+	}
+
+	// However many tokens alice makes, they all share the same bucket as logging in
+	first := createTestAccessToken(t, cfg, alice.ID, auth.ScopeChirpsWrite)
+	second := createTestAccessToken(t, cfg, alice.ID, auth.ScopeChirpsWrite)
+	assert.Equal(t, "user:"+alice.ID.String(), id(first))
+	assert.Equal(t, id(first), id(second))
+	assert.Equal(t, id(first), id(testToken(t, cfg, alice.ID)))
+
+	// Anything that only looks like a token goes by address
+	fake, err := auth.MakeAccessToken()
+	require.NoError(t, err)
+	assert.Equal(t, "ip:"+clientIP(httptest.NewRequest("POST", "/api/chirps", nil)), id(fake))
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := &ApiConfig{rateLimiter: ratelimit.NewLimiter(ratelimit.NewMemoryStore())}
+	policy := rateLimitPolicy{Policy: ratelimit.Policy{Name: "test", Limit: 2, Per: time.Minute}}
+	handler := cfg.rateLimit(policy, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	send := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	rec := send("10.0.0.1:1234")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=60", rec.Header().Get("RateLimit-Policy"))
+
+	send("10.0.0.1:1234")
+	rec = send("10.0.0.1:5678")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+
+	// Another address has its own limit
+	assert.Equal(t, http.StatusNoContent, send("10.0.0.2:1234").Code)
+}
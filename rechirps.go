@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// The kinds of chirp, stored in chirps.kind
+const (
+	chirpKindChirp   = "chirp"
+	chirpKindRechirp = "rechirp"
+	chirpKindQuote   = "quote"
+)
+
+var errReferenceNotFound = errors.New("chirp being referenced not found")
+
+// Finds the chirp a new rechirp or quote should point at
+// Rechirping a rechirp points at the original, so embeds never nest
+func (cfg *ApiConfig) resolveReference(ctx context.Context, chirpID uuid.UUID) (uuid.UUID, error) {
+	ref, err := cfg.DBQueries.GetChirp(ctx, chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, errReferenceNotFound
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if ref.DeletedAt.Valid || ref.HiddenAt.Valid {
+		return uuid.Nil, errReferenceNotFound
+	}
+
+	if ref.Kind == chirpKindRechirp {
+		// The original has gone, there's nothing left to point at
+		if !ref.ReferenceID.Valid {
+			return uuid.Nil, errReferenceNotFound
+		}
+		return ref.ReferenceID.UUID, nil
+	}
+
+	return ref.ID, nil
+}
+
+// Looks up the originals of any rechirps and quotes in one query and embeds them
+// Originals that have been deleted are embedded as an "unavailable" stub
+func (cfg *ApiConfig) addEmbeds(ctx context.Context, chirps ...*Chirp) error {
+	var ids []uuid.UUID
+	for _, chirp := range chirps {
+		if chirp.referenceID.Valid {
+			ids = append(ids, chirp.referenceID.UUID)
+		}
+	}
+
+	originals := map[uuid.UUID]Chirp{}
+	if len(ids) > 0 {
+		rows, err := cfg.DBQueries.GetChirpsByIDs(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if !row.DeletedAt.Valid && !row.HiddenAt.Valid {
+				originals[row.ID] = chirpFromDB(row)
+			}
+		}
+	}
+
+	for _, chirp := range chirps {
+		if chirp.Kind != chirpKindRechirp && chirp.Kind != chirpKindQuote {
+			continue
+		}
+
+		original, ok := originals[chirp.referenceID.UUID]
+		if !chirp.referenceID.Valid || !ok {
+			chirp.Embedded = &embeddedChirp{Unavailable: true}
+			continue
+		}
+		chirp.Embedded = &embeddedChirp{Chirp: &original}
+	}
+
+	return nil
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/audit"
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Why something was reported, users pick one of these
+var reportCategories = map[string]bool{
+	"spam":           true,
+	"harassment":     true,
+	"hate":           true,
+	"violence":       true,
+	"sexual":         true,
+	"self_harm":      true,
+	"misinformation": true,
+	"impersonation":  true,
+	"other":          true,
+}
+
+// Used for chirps flagged by the moderation rules rather than by a user
+const reportCategoryModerationRule = "moderation_rule"
+
+const (
+	reportStatusOpen      = "open"
+	reportStatusDismissed = "dismissed"
+	reportStatusActioned  = "actioned"
+)
+
+// What a moderator can do about a report
+const (
+	reportActionDismiss     = "dismiss"
+	reportActionHideChirp   = "hide_chirp"
+	reportActionDeleteChirp = "delete_chirp"
+	reportActionSuspendUser = "suspend_user"
+)
+
+// Longest a report's details can be
+const maxReportDetails = 1000
+
+type reportActionResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	ModeratorID *uuid.UUID `json:"moderator_id"`
+	Action      string     `json:"action"`
+	Note        string     `json:"note"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type reportResponse struct {
+	ID             uuid.UUID              `json:"id"`
+	ReporterID     *uuid.UUID             `json:"reporter_id"`
+	ChirpID        *uuid.UUID             `json:"chirp_id,omitempty"`
+	ChirpBody      *string                `json:"chirp_body,omitempty"`
+	ReportedUserID uuid.UUID              `json:"reported_user_id"`
+	Category       string                 `json:"category"`
+	Details        string                 `json:"details"`
+	Status         string                 `json:"status"`
+	CreatedAt      time.Time              `json:"created_at"`
+	ResolvedAt     *time.Time             `json:"resolved_at,omitempty"`
+	Actions        []reportActionResponse `json:"actions,omitempty"`
+}
+
+type reportPage struct {
+	Reports    []reportResponse `json:"reports"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+func newReportResponse(report database.Report) reportResponse {
+	resp := reportResponse{
+		ID:             report.ID,
+		ReportedUserID: report.ReportedUserID,
+		Category:       report.Category,
+		Details:        report.Details,
+		Status:         report.Status,
+		CreatedAt:      report.CreatedAt,
+	}
+	if report.ReporterID.Valid {
+		resp.ReporterID = &report.ReporterID.UUID
+	}
+	if report.ChirpID.Valid {
+		resp.ChirpID = &report.ChirpID.UUID
+	}
+	if report.ChirpBody.Valid {
+		resp.ChirpBody = &report.ChirpBody.String
+	}
+	if report.ResolvedAt.Valid {
+		resp.ResolvedAt = &report.ResolvedAt.Time
+	}
+	return resp
+}
+
+// Loads the actions taken on each report in one query
+func (cfg *ApiConfig) addReportActions(ctx context.Context, reports []reportResponse) error {
+	if len(reports) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(reports))
+	index := map[uuid.UUID]int{}
+	for i, report := range reports {
+		ids[i] = report.ID
+		index[report.ID] = i
+	}
+
+	rows, err := cfg.DBQueries.ListReportActions(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		action := reportActionResponse{
+			ID:        row.ID,
+			Action:    row.Action,
+			Note:      row.Note,
+			CreatedAt: row.CreatedAt,
+		}
+		if row.ModeratorID.Valid {
+			action.ModeratorID = &row.ModeratorID.UUID
+		}
+		report := &reports[index[row.ReportID]]
+		report.Actions = append(report.Actions, action)
+	}
+	return nil
+}
+
+// Reads the category and details shared by both kinds of report
+func decodeReportParams(r *http.Request) (category, details string, err error) {
+	var params struct {
+		Category string `json:"category"`
+		Details  string `json:"details"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return "", "", errors.New("invalid request body")
+	}
+
+	if !reportCategories[params.Category] {
+		return "", "", errors.New("category must be one of spam, harassment, hate, violence, sexual, self_harm, misinformation, impersonation or other")
+	}
+
+	details = strings.TrimSpace(params.Details)
+	if len(details) > maxReportDetails {
+		return "", "", errors.New("details are too long")
+	}
+
+	return params.Category, details, nil
+}
+
+// Saves a report, responding with 409 if the user already has one open
+// about the same thing
+func (cfg *ApiConfig) saveReport(w http.ResponseWriter, r *http.Request, params database.CreateReportParams) {
+	report, err := cfg.DBQueries.CreateReport(r.Context(), params)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			respondWithError(w, http.StatusConflict, "You've already reported this")
+			return
+		}
+		log.Printf("Error creating report: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to create report")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusCreated, newReportResponse(report))
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Reports a chirp to the moderators
+func (cfg *ApiConfig) reportChirp(w http.ResponseWriter, r *http.Request) {
+	// Reporting counts as posting, so read only tokens can't do it
+	userID, err := cfg.authenticatedUser(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	chirp, ok := cfg.loadTargetChirp(w, r)
+	if !ok {
+		return
+	}
+
+	category, details, err := decodeReportParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if chirp.UserID == userID {
+		respondWithError(w, http.StatusBadRequest, "You can't report your own chirp")
+		return
+	}
+
+	cfg.saveReport(w, r, database.CreateReportParams{
+		ReporterID:     uuid.NullUUID{UUID: userID, Valid: true},
+		ChirpID:        uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		ChirpBody:      sql.NullString{String: chirp.Body, Valid: true},
+		ReportedUserID: chirp.UserID,
+		Category:       category,
+		Details:        details,
+	})
+}
+
+// Reports an account rather than any one chirp, e.g. for impersonation
+func (cfg *ApiConfig) reportUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	reportedID, ok := cfg.targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if reportedID == userID {
+		respondWithError(w, http.StatusBadRequest, "You can't report yourself")
+		return
+	}
+
+	category, details, err := decodeReportParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cfg.saveReport(w, r, database.CreateReportParams{
+		ReporterID:     uuid.NullUUID{UUID: userID, Valid: true},
+		ReportedUserID: reportedID,
+		Category:       category,
+		Details:        details,
+	})
+}
+
+// The moderation queue, oldest first. Only open reports are shown unless
+// status is given, status=all shows everything. Can also be filtered by
+// category, chirp_id and user_id (the reported user)
+func (cfg *ApiConfig) getReports(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	page, err := parsePageParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.ListReportsParams{
+		Status: sql.NullString{String: reportStatusOpen, Valid: true},
+		Limit:  int32(page.Limit + 1),
+	}
+
+	switch status := query.Get("status"); status {
+	case "":
+	case "all":
+		params.Status = sql.NullString{}
+	case reportStatusOpen, reportStatusDismissed, reportStatusActioned:
+		params.Status = sql.NullString{String: status, Valid: true}
+	default:
+		respondWithError(w, http.StatusBadRequest, "status must be open, dismissed, actioned or all")
+		return
+	}
+
+	if category := query.Get("category"); category != "" {
+		if !reportCategories[category] && category != reportCategoryModerationRule {
+			respondWithError(w, http.StatusBadRequest, "Unknown category")
+			return
+		}
+		params.Category = sql.NullString{String: category, Valid: true}
+	}
+
+	if s := query.Get("chirp_id"); s != "" {
+		chirpID, err := uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid chirp_id")
+			return
+		}
+		params.ChirpID = uuid.NullUUID{UUID: chirpID, Valid: true}
+	}
+
+	if s := query.Get("user_id"); s != "" {
+		userID, err := uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+		params.ReportedUserID = uuid.NullUUID{UUID: userID, Valid: true}
+	}
+
+	if page.Cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	rows, err := cfg.DBQueries.ListReports(ctx, params)
+	if err != nil {
+		log.Printf("Error listing reports: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to list reports")
+		return
+	}
+
+	resp := reportPage{Reports: []reportResponse{}}
+	for i, row := range rows {
+		if i == page.Limit {
+			last := rows[i-1]
+			resp.NextCursor = encodeCursor(pageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+			break
+		}
+		resp.Reports = append(resp.Reports, newReportResponse(row))
+	}
+
+	err = cfg.addReportActions(ctx, resp.Reports)
+	if err != nil {
+		log.Printf("Error listing report actions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to list reports")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Looks up the report in the path, responding if it can't
+func (cfg *ApiConfig) targetReport(w http.ResponseWriter, r *http.Request) (database.Report, bool) {
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid report ID format")
+		return database.Report{}, false
+	}
+
+	report, err := cfg.DBQueries.GetReport(r.Context(), reportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Report not found")
+		return database.Report{}, false
+	}
+	if err != nil {
+		log.Printf("Error finding report: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to find report")
+		return database.Report{}, false
+	}
+
+	return report, true
+}
+
+// One report with everything that's been done about it
+func (cfg *ApiConfig) getReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := cfg.targetReport(w, r)
+	if !ok {
+		return
+	}
+
+	cfg.respondWithReport(w, r, report)
+}
+
+func (cfg *ApiConfig) respondWithReport(w http.ResponseWriter, r *http.Request, report database.Report) {
+	resp := []reportResponse{newReportResponse(report)}
+	err := cfg.addReportActions(r.Context(), resp)
+	if err != nil {
+		log.Printf("Error listing report actions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to find report")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, resp[0])
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Deals with a report: dismissing it, hiding or deleting the chirp, or
+// suspending the reported user for suspend_for (e.g. "72h"). Every action
+// is kept with the moderator who took it and their note
+func (cfg *ApiConfig) actOnReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	moderatorID, moderatorRole, err := cfg.staffUser(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	report, ok := cfg.targetReport(w, r)
+	if !ok {
+		return
+	}
+
+	var params struct {
+		Action     string `json:"action"`
+		Note       string `json:"note"`
+		SuspendFor string `json:"suspend_for"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	note := strings.TrimSpace(params.Note)
+	if note == "" {
+		respondWithError(w, http.StatusBadRequest, "A note explaining the action is required")
+		return
+	}
+
+	if report.Status != reportStatusOpen {
+		respondWithError(w, http.StatusConflict, "This report has already been dealt with")
+		return
+	}
+
+	// Everything is checked before anything is changed
+	status := reportStatusActioned
+	var suspendedUntil sql.NullTime
+	switch params.Action {
+	case reportActionDismiss:
+		status = reportStatusDismissed
+
+	case reportActionHideChirp, reportActionDeleteChirp:
+		if !report.ChirpID.Valid {
+			respondWithError(w, http.StatusBadRequest, "This report isn't about a chirp that still exists")
+			return
+		}
+
+	case reportActionSuspendUser:
+		suspendedUntil, err = suspensionEnd(params.SuspendFor)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		allowed, err := cfg.canModerateUser(ctx, moderatorRole, report.ReportedUserID)
+		if err != nil {
+			log.Printf("Error getting reported user's role: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "Unable to act on report")
+			return
+		}
+		if !allowed {
+			respondWithError(w, http.StatusForbidden, "Only admins can suspend moderators and admins")
+			return
+		}
+
+	default:
+		respondWithError(w, http.StatusBadRequest, "Action must be dismiss, hide_chirp, delete_chirp or suspend_user")
+		return
+	}
+
+	resolved, err := cfg.applyReportAction(ctx, report, moderatorID, params.Action, note, status, suspendedUntil)
+	if err != nil {
+		log.Printf("Error acting on report: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to act on report")
+		return
+	}
+	// Someone else dealt with it first
+	if !resolved {
+		respondWithError(w, http.StatusConflict, "This report has already been dealt with")
+		return
+	}
+
+	if params.Action == reportActionDeleteChirp {
+		cfg.recordAudit(r, audit.Event{
+			Action:     auditChirpDeleted,
+			ActorID:    actor(moderatorID),
+			TargetType: "chirp",
+			TargetID:   report.ChirpID.UUID.String(),
+			Metadata: map[string]any{
+				"author_id": report.ReportedUserID,
+				"report_id": report.ID,
+				"note":      note,
+			},
+		})
+	}
+
+	report, err = cfg.DBQueries.GetReport(ctx, report.ID)
+	if err != nil {
+		log.Printf("Error finding report: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to find report")
+		return
+	}
+
+	cfg.respondWithReport(w, r, report)
+}
+
+// Resolves the report and does what the moderator chose in one go, so a
+// report is never left resolved without its action or the other way round.
+// Returns false if the report had already been resolved
+func (cfg *ApiConfig) applyReportAction(ctx context.Context, report database.Report, moderatorID uuid.UUID, action, note, status string, suspendedUntil sql.NullTime) (bool, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	q := database.New(tx)
+
+	// Only one moderator gets to resolve it
+	resolved, err := q.ResolveReport(ctx, database.ResolveReportParams{
+		ID:     report.ID,
+		Status: status,
+	})
+	if err != nil || resolved == 0 {
+		return false, err
+	}
+
+	switch action {
+	case reportActionHideChirp, reportActionDeleteChirp:
+		// Every other open report about the chirp is dealt with too. This has
+		// to happen before deleting, deleting takes the chirp id off them
+		err = q.ResolveChirpReports(ctx, report.ChirpID)
+		if err != nil {
+			return false, err
+		}
+
+		if action == reportActionHideChirp {
+			_, err = q.HideChirp(ctx, report.ChirpID.UUID)
+		} else {
+			err = removeChirp(ctx, q, report.ChirpID.UUID)
+		}
+		if err != nil {
+			return false, err
+		}
+
+	case reportActionSuspendUser:
+		_, err = setUserState(ctx, q, report.ReportedUserID, userStateSuspended, suspendedUntil)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = q.CreateReportAction(ctx, database.CreateReportActionParams{
+		ReportID:    report.ID,
+		ModeratorID: uuid.NullUUID{UUID: moderatorID, Valid: true},
+		Action:      action,
+		Note:        note,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActOnReportOnlyOnce(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	bob := createTestUser(t, cfg, "bob@example.com")
+	mod := createTestUser(t, cfg, "mod@example.com")
+	setTestRole(t, cfg, mod.ID, auth.RoleModerator)
+	modToken, err := cfg.jwtKeys.MakeSessionJWT(mod.ID, mod.ID, auth.RoleModerator, time.Hour)
+	require.NoError(t, err)
+
+	chirpID := createTestChirp(t, cfg, bob.ID, "a very reportable chirp").ID.String()
+	rec := serveTest(cfg.reportChirp, "POST", "/api/chirps/"+chirpID+"/report", testToken(t, cfg, alice.ID), `{"category":"spam","details":"buy now"}`, "chirpID", chirpID)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var report reportResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+
+	act := cfg.requireRole(auth.RoleModerator, cfg.actOnReport)
+	target := "/admin/reports/" + report.ID.String() + "/actions"
+	rec = serveTest(act, "POST", target, modToken, `{"action":"hide_chirp","note":"spam"}`, "reportID", report.ID.String())
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// Already dealt with, so it can't be dismissed afterwards
+	rec = serveTest(act, "POST", target, modToken, `{"action":"dismiss","note":"changed my mind"}`, "reportID", report.ID.String())
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = serveTest(cfg.getReport, "GET", "/admin/reports/"+report.ID.String(), modToken, "", "reportID", report.ID.String())
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, reportStatusActioned, report.Status)
+	assert.Len(t, report.Actions, 1)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Tim-Restart/chirpy/internal/audit"
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type staffKey struct{}
+
+// Who requireRole let through, for the handler behind it
+type staff struct {
+	userID uuid.UUID
+	role   string
+}
+
+// Wraps a handler so only logged in users with at least role can reach it
+// The role is looked up on every request rather than trusted from the
+// token, so demoting someone takes effect straight away. Whatever the
+// handler does goes in the audit log
+func (cfg *ApiConfig) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid or missing token")
+			return
+		}
+
+		// Bots don't get to be admins
+		if auth.IsAccessToken(token) {
+			cfg.auditAdminDenied(r, uuid.Nil, "access_token", "", role)
+			respondWithError(w, http.StatusForbidden, "Personal access tokens can't be used here")
+			return
+		}
+
+		claims, err := cfg.jwtKeys.AccessClaims(token)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid or missing token")
+			return
+		}
+		userID, err := uuid.Parse(claims.Subject)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid or missing token")
+			return
+		}
+
+		// Neither do apps acting for them
+		if claims.ClientID != "" {
+			cfg.auditAdminDenied(r, userID, "app_token", "", role)
+			respondWithError(w, http.StatusForbidden, "App tokens can't be used here")
+			return
+		}
+
+		// The same lookup turns away suspended staff
+		currentRole, err := cfg.checkUserAccess(r.Context(), userID)
+		if err != nil {
+			var stateErr *accountStateError
+			if errors.As(err, &stateErr) {
+				cfg.auditAdminDenied(r, userID, "account_state", currentRole, role)
+			}
+			respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+			return
+		}
+
+		if !auth.RoleAtLeast(currentRole, role) {
+			cfg.auditAdminDenied(r, userID, "role", currentRole, role)
+			respondWithError(w, http.StatusForbidden, "This endpoint needs the "+role+" role")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), staffKey{}, staff{userID: userID, role: currentRole})
+		cfg.auditAdminRequest(w, r.WithContext(ctx), userID, next)
+	}
+}
+
+// Who's making a request that's already been through requireRole, and their role
+func (cfg *ApiConfig) staffUser(r *http.Request) (uuid.UUID, string, error) {
+	s, ok := r.Context().Value(staffKey{}).(staff)
+	if !ok {
+		return uuid.Nil, "", errors.New("request didn't go through requireRole")
+	}
+	return s.userID, s.role, nil
+}
+
+// Makes the user with this email an admin, but only if there are no admins
+// yet, so ADMIN_EMAIL can be left set without handing out admin later
+func bootstrapAdmin(ctx context.Context, dbQueries *database.Queries, email string) error {
+	promoted, err := dbQueries.PromoteFirstAdmin(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if promoted > 0 {
+		log.Printf("Made %s the first admin", email)
+	}
+	return nil
+}
+
+// Changes a user's role, admins only
+func (cfg *ApiConfig) setUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	var params struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !auth.ValidRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, "Role must be user, moderator or admin")
+		return
+	}
+
+	// The role before, for the audit log
+	before, err := cfg.DBQueries.GetUserState(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting user role: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to set role")
+		return
+	}
+
+	updated, err := cfg.DBQueries.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   userID,
+		Role: params.Role,
+	})
+	if err != nil {
+		log.Printf("Error setting user role: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to set role")
+		return
+	}
+
+	if updated == 0 {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	adminID, _, _ := cfg.staffUser(r)
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditRoleChanged,
+		ActorID:    actor(adminID),
+		TargetType: "user",
+		TargetID:   userID.String(),
+		Metadata:   map[string]any{"before": before.Role, "after": params.Role},
+	})
+
+	// Role checks use the database, but their tokens still say the old role,
+	// signing them out everywhere gets rid of those too
+	err = cfg.DBQueries.RevokeOtherSessions(r.Context(), database.RevokeOtherSessionsParams{
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Error revoking sessions after role change: %s", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
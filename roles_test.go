@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireRoleUsesCurrentRole(t *testing.T) {
+	cfg := newTestConfig(t)
+	admin := createTestUser(t, cfg, "admin@example.com")
+	setTestRole(t, cfg, admin.ID, auth.RoleAdmin)
+
+	// The token says admin for the next hour whatever happens
+	token, err := cfg.jwtKeys.MakeSessionJWT(admin.ID, admin.ID, auth.RoleAdmin, time.Hour)
+	require.NoError(t, err)
+
+	handler := cfg.requireRole(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		_, role, err := cfg.staffUser(r)
+		require.NoError(t, err)
+		assert.Equal(t, auth.RoleAdmin, role)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	rec := serveTest(handler, "GET", "/admin/users", token, "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	setTestRole(t, cfg, admin.ID, auth.RoleUser)
+
+	rec = serveTest(handler, "GET", "/admin/users", token, "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+// Wiping the database needs PLATFORM=dev as well as an admin
+func TestResetNeedsDevPlatform(t *testing.T) {
+	cfg := &ApiConfig{platform: "production"}
+	rec := serveTest(cfg.metricsResetHandler, "POST", "/admin/reset", "", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// A single search hit, the chirp plus how well it matched
+type searchResult struct {
+	Chirp
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type searchResponse struct {
+	Results []searchResult `json:"results"`
+}
+
+// ts_headline marks the matches with these (any in the body are removed
+// first), so the snippet can be escaped before they become <mark> tags
+const (
+	snippetStart = "\ue000"
+	snippetStop  = "\ue001"
+)
+
+// Escapes a snippet so it's safe to show as HTML, with the matches in <mark>
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, snippetStart, "<mark>")
+	return strings.ReplaceAll(snippet, snippetStop, "</mark>")
+}
+
+// Turns what the user typed into a Postgres tsquery string
+// "quoted words" become a phrase, a trailing * is a prefix match,
+// and everything else has to match (AND)
+func buildSearchQuery(q string) (string, error) {
+	var terms []string
+
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		if q[0] == '"' {
+			// Phrase - read up to the closing quote (or the end if there isn't one)
+			end := strings.IndexByte(q[1:], '"')
+			phrase := q[1:]
+			if end >= 0 {
+				phrase = q[1 : end+1]
+				q = q[end+2:]
+			} else {
+				q = ""
+			}
+
+			if words := searchWords(phrase); len(words) > 0 {
+				terms = append(terms, "("+strings.Join(words, " <-> ")+")")
+			}
+			continue
+		}
+
+		// Plain term - runs until the next space or quote
+		end := strings.IndexFunc(q, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+		term := q
+		if end >= 0 {
+			term = q[:end]
+			q = q[end:]
+		} else {
+			q = ""
+		}
+
+		prefix := strings.HasSuffix(term, "*")
+		words := searchWords(term)
+		if len(words) == 0 {
+			continue
+		}
+		if prefix {
+			words[len(words)-1] += ":*"
+		}
+		if len(words) == 1 {
+			terms = append(terms, words[0])
+		} else {
+			terms = append(terms, "("+strings.Join(words, " <-> ")+")")
+		}
+	}
+
+	if len(terms) == 0 {
+		return "", errors.New("search query has no searchable words")
+	}
+
+	return strings.Join(terms, " & "), nil
+}
+
+// Splits text into lower case words, dropping anything tsquery would treat as an operator
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Parses an optional RFC3339 time from the query string
+func parseTimeParam(r *http.Request, name string) (sql.NullTime, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return sql.NullTime{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return sql.NullTime{}, errors.New(name + " must be an RFC3339 timestamp")
+	}
+
+	return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+}
+
+// Searches chirp bodies and returns them ranked by relevance
+// Supports author_id, since and until filters, and limit/offset paging
+
+func (cfg *ApiConfig) searchChirps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	tsQuery, err := buildSearchQuery(query.Get("q"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	viewer := cfg.optionalUser(r)
+	params := database.SearchChirpsParams{
+		Query:    tsQuery,
+		ViewerID: viewer,
+	}
+
+	if s := query.Get("author_id"); s != "" {
+		author, err := uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid author ID format")
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: author, Valid: true}
+	}
+
+	params.Since, err = parseTimeParam(r, "since")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params.Until, err = parseTimeParam(r, "until")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	params.Limit = int32(limit)
+	params.Offset = int32(offset)
+
+	rows, err := cfg.DBQueries.SearchChirps(r.Context(), params)
+	if err != nil {
+		log.Printf("Error searching chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to search chirps")
+		return
+	}
+
+	resp := searchResponse{Results: []searchResult{}}
+	for _, row := range rows {
+		resp.Results = append(resp.Results, searchResult{
+			Chirp: chirpFromDB(database.Chirp{
+				ID:            row.ID,
+				CreatedAt:     row.CreatedAt,
+				UpdatedAt:     row.UpdatedAt,
+				Body:          row.Body,
+				UserID:        row.UserID,
+				InReplyTo:     row.InReplyTo,
+				ThreadRootID:  row.ThreadRootID,
+				DeletedAt:     row.DeletedAt,
+				Kind:          row.Kind,
+				ReferenceID:   row.ReferenceID,
+				RevisionCount: row.RevisionCount,
+				HiddenAt:      row.HiddenAt,
+			}),
+			Rank:    row.Rank,
+			Snippet: highlightSnippet(row.Snippet),
+		})
+	}
+
+	chirps := make([]*Chirp, 0, len(resp.Results))
+	for i := range resp.Results {
+		chirps = append(chirps, &resp.Results[i].Chirp)
+	}
+
+	err = cfg.decorateChirps(r.Context(), viewer, chirps...)
+	if err != nil {
+		log.Printf("Error counting likes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to search chirps")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+		return
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSearchQuery(t *testing.T) {
+
+	// Plain words are ANDed together
+	q, err := buildSearchQuery("golang chirps")
+	assert.NoError(t, err)
+	assert.Equal(t, "golang & chirps", q)
+
+	// Quoted words become a phrase and a trailing * is a prefix match
+	q, err = buildSearchQuery(`"hello world" chirp*`)
+	assert.NoError(t, err)
+	assert.Equal(t, "(hello <-> world) & chirp:*", q)
+
+	// tsquery operators typed by the user are stripped out
+	q, err = buildSearchQuery("cats | !dogs")
+	assert.NoError(t, err)
+	assert.Equal(t, "cats & dogs", q)
+
+	// Nothing searchable is an error
+	_, err = buildSearchQuery(`  "" !! `)
+	assert.Error(t, err)
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	snippet := "look at <img src=x onerror=alert(1)> this " + snippetStart + "kerfuffle" + snippetStop + " & more"
+	assert.Equal(t, "look at &lt;img src=x onerror=alert(1)&gt; this <mark>kerfuffle</mark> &amp; more", highlightSnippet(snippet))
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/audit"
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// A device the user is logged in on
+type sessionResponse struct {
+	ID          uuid.UUID `json:"id"`
+	DeviceLabel string    `json:"device_label"`
+	UserAgent   string    `json:"user_agent"`
+	IPAddress   string    `json:"ip_address"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+	Current     bool      `json:"current"`
+
+	// Set when the session is an OAuth app acting for the user
+	ClientID *uuid.UUID `json:"client_id,omitempty"`
+	Scopes   []string   `json:"scopes,omitempty"`
+}
+
+// The address the request came from, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Makes a readable name like "Firefox on Linux" from a user agent
+func deviceLabel(userAgent string) string {
+	browser := ""
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(userAgent, "curl/"):
+		browser = "curl"
+	}
+
+	system := ""
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		system = "Android"
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		system = "iOS"
+	case strings.Contains(userAgent, "Windows"):
+		system = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"), strings.Contains(userAgent, "Macintosh"):
+		system = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		system = "Linux"
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "Unknown device"
+}
+
+// Starts a new session for a login, the label is made up from the
+// user agent if the client didn't send one
+func (cfg *ApiConfig) startSession(r *http.Request, userID uuid.UUID, label string) (database.Session, error) {
+	userAgent := r.UserAgent()
+
+	label = strings.TrimSpace(label)
+	if label == "" {
+		label = deviceLabel(userAgent)
+	}
+
+	return cfg.DBQueries.CreateSession(r.Context(), database.CreateSessionParams{
+		UserID:      userID,
+		UserAgent:   userAgent,
+		IpAddress:   clientIP(r),
+		DeviceLabel: label,
+	})
+}
+
+// The session the request's access token was issued for, if it says
+func (cfg *ApiConfig) currentSession(r *http.Request) uuid.NullUUID {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+
+	sessionID, err := cfg.jwtKeys.SessionFromJWT(token)
+	if err != nil || sessionID == uuid.Nil {
+		return uuid.NullUUID{}
+	}
+
+	return uuid.NullUUID{UUID: sessionID, Valid: true}
+}
+
+// Lists the devices the authenticated user is logged in on
+func (cfg *ApiConfig) getSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	sessions, err := cfg.DBQueries.ListActiveSessions(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing sessions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch sessions")
+		return
+	}
+
+	current := cfg.currentSession(r)
+
+	resp := []sessionResponse{}
+	for _, session := range sessions {
+		item := sessionResponse{
+			ID:          session.ID,
+			DeviceLabel: session.DeviceLabel,
+			UserAgent:   session.UserAgent,
+			IPAddress:   session.IpAddress,
+			CreatedAt:   session.CreatedAt,
+			LastUsedAt:  session.LastUsedAt,
+			Current:     current.Valid && current.UUID == session.ID,
+		}
+		if session.ClientID.Valid {
+			item.ClientID = &session.ClientID.UUID
+			item.Scopes = session.Scopes
+		}
+		resp = append(resp, item)
+	}
+
+	err = respondWithJSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Logs out one of the authenticated user's sessions
+// Access tokens already issued keep working until they expire (an hour at most)
+func (cfg *ApiConfig) deleteSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID format")
+		return
+	}
+
+	revoked, err := cfg.DBQueries.RevokeSession(r.Context(), database.RevokeSessionParams{
+		ID:     sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Error revoking session: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to revoke session")
+		return
+	}
+
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditRevoke,
+		ActorID:    actor(userID),
+		TargetType: "session",
+		TargetID:   sessionID.String(),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Logs out every session except the one making the request
+func (cfg *ApiConfig) revokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	err = cfg.DBQueries.RevokeOtherSessions(r.Context(), database.RevokeOtherSessionsParams{
+		UserID: userID,
+		KeepID: cfg.currentSession(r),
+	})
+	if err != nil {
+		log.Printf("Error revoking sessions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to revoke sessions")
+		return
+	}
+
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditRevoke,
+		ActorID:    actor(userID),
+		TargetType: "user",
+		TargetID:   userID.String(),
+		Metadata:   map[string]any{"all_sessions": true},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
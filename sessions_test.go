@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func refreshTestToken(cfg *ApiConfig, token string) (*http.Response, string) {
+	rec := serveTest(cfg.refresh, "POST", "/api/refresh", token, "")
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec.Result(), body.RefreshToken
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	cfg := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+	first := loginTestUser(t, cfg, "alice@example.com").Refresh_Token
+
+	resp, second := refreshTestToken(cfg, first)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotEmpty(t, second)
+
+	resp, third := refreshTestToken(cfg, second)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotEmpty(t, third)
+
+	// Someone replaying the first token looks like it was stolen...
+	resp, _ = refreshTestToken(cfg, first)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// ...so every token in the family stops working, including the newest
+	for _, token := range []string{second, third} {
+		resp, _ = refreshTestToken(cfg, token)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestRefreshTokenFamiliesAreSeparate(t *testing.T) {
+	cfg := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+	laptop := loginTestUser(t, cfg, "alice@example.com").Refresh_Token
+	phone := loginTestUser(t, cfg, "alice@example.com").Refresh_Token
+
+	resp, _ := refreshTestToken(cfg, laptop)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = refreshTestToken(cfg, laptop)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// Only the laptop's login is revoked
+	resp, _ = refreshTestToken(cfg, phone)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDeviceLabel(t *testing.T) {
+	assert.Equal(t, "Firefox on Linux", deviceLabel("Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"))
+	assert.Equal(t, "Safari on iOS", deviceLabel("Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"))
+	assert.Equal(t, "curl", deviceLabel("curl/8.5.0"))
+	assert.Equal(t, "Unknown device", deviceLabel(""))
+}
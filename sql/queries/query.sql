@@ -1,96 +1,912 @@
--- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
-VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
-)
-RETURNING *;
-
--- name: NewChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
-)
-RETURNING *;
-
--- name: GetChirps :many
-SELECT * FROM chirps 
-ORDER BY created_at ASC;
-
--- name: GetChirp :one
-SELECT * 
-FROM chirps
-WHERE ID = $1;
-
--- name: GetEmail :one
-SELECT *
-FROM users
-WHERE email = $1;
-
--- name: DeleteAllUsers :exec
-DELETE FROM users;
-
--- name: RefreshTokenExpiry :one
-SELECT expires_at 
-FROM refresh_tokens
-WHERE user_id = $1;
-
--- name: SaveRefToken :exec
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
-VALUES (
-    $1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', NULL
-);
-
--- name: GetUserFromRefreshToken :many
-SELECT user_id, expires_at, revoked_at
-FROM refresh_tokens
-WHERE token = $1;
-
--- name: RevokeToken :exec
-UPDATE refresh_tokens
-SET updated_at = NOW(), revoked_at = NOW()
-WHERE token = $1;
-
--- name: UpdateUser :exec
-UPDATE users
-SET email = $2, hashed_password = $3, updated_at = NOW()
-WHERE id = $1;
-
--- name: UserFromToken :one
-SELECT user_id
-FROM refresh_tokens
-WHERE token = $1;
-
--- name: GetUserEmail :one
-SELECT email
-FROM users
-WHERE id = $1;
-
--- name: GetUserOfChirp :one
-SELECT user_id
-FROM chirps
-WHERE id = $1;
-
--- name: DeleteChirp :exec
-DELETE FROM chirps
-WHERE id = $1;
-
--- name: UpgradeToRed :exec
-UPDATE users
-SET is_chirpy_red = true
-WHERE id = $1;
-
--- name: CheckUser :one
-SELECT id
-FROM users
-WHERE id = $1;
-
--- name: IsChirpyRed :one
-SELECT is_chirpy_red
-FROM users
-WHERE id = $1;
-
--- name: ChirpsFrom :many
-SELECT body 
-FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
+-- name: CreateUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3
+)
+RETURNING *;
+
+-- name: NewChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, thread_root_id, kind, reference_id)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetChirps :many
+SELECT * FROM chirps 
+ORDER BY created_at ASC;
+
+-- name: GetChirp :one
+SELECT * 
+FROM chirps
+WHERE ID = $1;
+
+-- name: GetEmail :one
+SELECT *
+FROM users
+WHERE email = $1;
+
+-- name: DeleteAllUsers :exec
+DELETE FROM users;
+
+-- name: RefreshTokenExpiry :one
+SELECT expires_at 
+FROM refresh_tokens
+WHERE user_id = $1;
+
+-- name: SaveRefToken :exec
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
+VALUES (
+    $1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', NULL, $3
+);
+
+-- name: GetUserFromRefreshToken :many
+SELECT user_id, expires_at, revoked_at, family_id
+FROM refresh_tokens
+WHERE token = $1;
+
+-- name: RotateRefreshToken :one
+WITH old AS (
+    UPDATE refresh_tokens
+    SET revoked_at = NOW(), updated_at = NOW()
+    WHERE token = sqlc.arg('token')
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+    AND family_id IN (SELECT id FROM sessions WHERE revoked_at IS NULL AND client_id IS NULL)
+    RETURNING user_id, family_id
+)
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
+SELECT sqlc.arg('new_token'), NOW(), NOW(), old.user_id, NOW() + INTERVAL '60 days', NULL, old.family_id
+FROM old
+RETURNING user_id, family_id;
+
+-- name: RevokeTokenFamily :exec
+WITH tokens AS (
+    UPDATE refresh_tokens
+    SET updated_at = NOW(), revoked_at = NOW()
+    WHERE family_id = $1 AND revoked_at IS NULL
+)
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeToken :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE token = $1;
+
+-- name: UpdateUser :exec
+UPDATE users
+SET email = $2, hashed_password = $3, updated_at = NOW(),
+    email_verified_at = CASE WHEN email = $2 THEN email_verified_at END
+WHERE id = $1;
+
+-- name: UserFromToken :one
+SELECT user_id
+FROM refresh_tokens
+WHERE token = $1;
+
+-- name: GetUserEmail :one
+SELECT email
+FROM users
+WHERE id = $1;
+
+-- name: GetUserOfChirp :one
+SELECT user_id
+FROM chirps
+WHERE id = $1;
+
+-- name: DeleteChirp :execrows
+DELETE FROM chirps
+WHERE id = $1
+AND NOT EXISTS (
+    SELECT 1 FROM chirps replies WHERE replies.in_reply_to = $1
+);
+
+-- name: TombstoneChirp :exec
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpgradeToRed :exec
+UPDATE users
+SET is_chirpy_red = true
+WHERE id = $1;
+
+-- name: CheckUser :one
+SELECT id
+FROM users
+WHERE id = $1;
+
+-- name: IsChirpyRed :one
+SELECT is_chirpy_red
+FROM users
+WHERE id = $1;
+
+-- name: ChirpsFrom :many
+SELECT body 
+FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListChirpsAsc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+AND hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, sqlc.narg('viewer_id')::uuid)
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+AND hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, sqlc.narg('viewer_id')::uuid)
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirps :many
+SELECT chirps.*,
+    ts_rank(search_vector, query)::real AS rank,
+    ts_headline('english', translate(body, E'\uE000\uE001', ''), query, E'StartSel=\uE000, StopSel=\uE001, MaxFragments=2')::text AS snippet
+FROM chirps, to_tsquery('english', sqlc.arg('query')) query
+WHERE search_vector @@ query
+AND deleted_at IS NULL
+AND hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, sqlc.narg('viewer_id')::uuid)
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since')::timestamp)
+AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until')::timestamp)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: CountFollowers :one
+SELECT COUNT(*)
+FROM follows
+WHERE followee_id = $1;
+
+-- name: CountFollowing :one
+SELECT COUNT(*)
+FROM follows
+WHERE follower_id = $1;
+
+-- name: ListFollowers :many
+SELECT follower_id AS user_id, created_at
+FROM follows
+WHERE followee_id = sqlc.arg('user_id')
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, follower_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at DESC, follower_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListFollowing :many
+SELECT followee_id AS user_id, created_at
+FROM follows
+WHERE follower_id = sqlc.arg('user_id')
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, followee_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at DESC, followee_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: TimelineChirps :many
+SELECT chirps.*
+FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg('follower_id')
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, NULL)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT c.id, c.in_reply_to, 1 AS depth
+    FROM chirps c
+    WHERE c.id = (SELECT p.in_reply_to FROM chirps p WHERE p.id = sqlc.arg('id'))
+    UNION ALL
+    SELECT c.id, c.in_reply_to, a.depth + 1
+    FROM chirps c
+    JOIN ancestors a ON c.id = a.in_reply_to
+)
+SELECT chirps.*
+FROM chirps
+JOIN ancestors ON ancestors.id = chirps.id
+ORDER BY ancestors.depth DESC;
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT c.id, 1 AS depth, ARRAY[to_char(c.created_at, 'YYYYMMDDHH24MISSUS') || c.id::text] AS path
+    FROM chirps c
+    WHERE c.in_reply_to = sqlc.arg('id')
+    UNION ALL
+    SELECT c.id, d.depth + 1, d.path || (to_char(c.created_at, 'YYYYMMDDHH24MISSUS') || c.id::text)
+    FROM chirps c
+    JOIN descendants d ON c.in_reply_to = d.id
+)
+SELECT chirps.*, descendants.depth::int AS depth
+FROM chirps
+JOIN descendants ON descendants.id = chirps.id
+ORDER BY descendants.path
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: LikeChirp :exec
+INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id, chirp_id) DO NOTHING;
+
+-- name: UnlikeChirp :exec
+DELETE FROM chirp_likes
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: CountChirpLikes :many
+SELECT chirp_id, COUNT(*) AS like_count
+FROM chirp_likes
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+GROUP BY chirp_id;
+
+-- name: LikedChirpIDs :many
+SELECT chirp_id
+FROM chirp_likes
+WHERE user_id = sqlc.arg('user_id')
+AND chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[]);
+
+-- name: ListChirpLikes :many
+SELECT user_id, created_at
+FROM chirp_likes
+WHERE chirp_id = sqlc.arg('chirp_id')
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, user_id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at DESC, user_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListUserLikes :many
+SELECT chirps.*, chirp_likes.created_at AS liked_at
+FROM chirp_likes
+JOIN chirps ON chirps.id = chirp_likes.chirp_id
+WHERE chirp_likes.user_id = sqlc.arg('user_id')
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, sqlc.narg('viewer_id')::uuid)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirp_likes.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY chirp_likes.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetChirpsByIDs :many
+SELECT *
+FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: EditChirp :one
+WITH old AS (
+    SELECT id, body
+    FROM chirps
+    WHERE id = sqlc.arg('id')
+    AND created_at > NOW() - make_interval(secs => sqlc.arg('edit_window_seconds')::float8)
+    FOR UPDATE
+), saved AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+    SELECT gen_random_uuid(), old.id, old.body, NOW()
+    FROM old
+)
+UPDATE chirps
+SET body = sqlc.arg('body'), updated_at = NOW(), revision_count = chirps.revision_count + 1
+FROM old
+WHERE chirps.id = old.id
+RETURNING chirps.*;
+
+-- name: ListChirpRevisions :many
+SELECT *
+FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY created_at DESC;
+
+-- name: TagChirp :exec
+WITH tags AS (
+    INSERT INTO hashtags (id, tag, created_at)
+    SELECT gen_random_uuid(), t, NOW()
+    FROM unnest(sqlc.arg('tags')::text[]) AS t
+    ON CONFLICT (tag) DO UPDATE SET tag = EXCLUDED.tag
+    RETURNING id
+)
+INSERT INTO chirp_hashtags (chirp_id, hashtag_id, created_at)
+SELECT sqlc.arg('chirp_id'), tags.id, NOW()
+FROM tags
+ON CONFLICT (chirp_id, hashtag_id) DO NOTHING;
+
+-- name: UntagChirp :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = sqlc.arg('chirp_id')
+AND hashtag_id NOT IN (SELECT id FROM hashtags WHERE tag = ANY(sqlc.arg('keep')::text[]));
+
+-- name: ListHashtagChirps :many
+SELECT chirps.*
+FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE hashtags.tag = sqlc.arg('tag')
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, sqlc.narg('viewer_id')::uuid)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: TrendingHashtags :many
+SELECT hashtags.tag,
+    COUNT(*) AS uses,
+    SUM(POWER(0.5, EXTRACT(EPOCH FROM (NOW() - chirp_hashtags.created_at)) / sqlc.arg('half_life_seconds')::float8))::float8 AS score
+FROM chirp_hashtags
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+WHERE chirp_hashtags.created_at >= NOW() - make_interval(secs => sqlc.arg('window_seconds')::float8)
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, NULL)
+GROUP BY hashtags.tag
+ORDER BY score DESC, hashtags.tag ASC
+LIMIT sqlc.arg('limit');
+
+-- name: SetUsername :exec
+UPDATE users
+SET username = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetUsersByUsernames :many
+SELECT id, username
+FROM users
+WHERE username = ANY(sqlc.arg('usernames')::text[]);
+
+-- name: AddChirpMentions :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, start_offset, end_offset, created_at)
+SELECT sqlc.arg('chirp_id'),
+    unnest(sqlc.arg('user_ids')::uuid[]),
+    unnest(sqlc.arg('start_offsets')::int[]),
+    unnest(sqlc.arg('end_offsets')::int[]),
+    NOW()
+ON CONFLICT (chirp_id, start_offset) DO NOTHING;
+
+-- name: ClearChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
+
+-- name: ListChirpMentions :many
+SELECT chirp_id, user_id, start_offset, end_offset
+FROM chirp_mentions
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_id, start_offset;
+
+-- name: ListUserMentions :many
+SELECT *
+FROM chirps
+WHERE deleted_at IS NULL
+AND hidden_at IS NULL
+AND chirp_author_visible(chirps.user_id, NULL)
+AND EXISTS (
+    SELECT 1 FROM chirp_mentions
+    WHERE chirp_mentions.chirp_id = chirps.id
+    AND chirp_mentions.user_id = sqlc.arg('user_id')
+)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: CreateNotification :exec
+INSERT INTO notifications (id, user_id, kind, actor_id, chirp_id, group_key, created_at)
+SELECT gen_random_uuid(), sqlc.arg('user_id'), sqlc.arg('kind'), sqlc.narg('actor_id'), sqlc.narg('chirp_id'), sqlc.narg('group_key'), NOW()
+WHERE NOT EXISTS (
+    SELECT 1 FROM notifications
+    WHERE user_id = sqlc.arg('user_id')
+    AND kind = sqlc.arg('kind')
+    AND actor_id IS NOT DISTINCT FROM sqlc.narg('actor_id')::uuid
+    AND chirp_id IS NOT DISTINCT FROM sqlc.narg('chirp_id')::uuid
+);
+
+-- name: GetNotification :one
+SELECT *
+FROM notifications
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListNotificationGroups :many
+SELECT
+    (array_agg(id ORDER BY created_at DESC))[1]::uuid AS id,
+    kind,
+    chirp_id,
+    COUNT(DISTINCT actor_id) AS actor_count,
+    COALESCE((array_agg(actor_id ORDER BY created_at DESC) FILTER (WHERE actor_id IS NOT NULL))[1:3], '{}')::uuid[] AS recent_actor_ids,
+    MAX(created_at)::timestamp AS latest_at,
+    COUNT(*) FILTER (WHERE read_at IS NULL) AS unread_count
+FROM notifications
+WHERE user_id = sqlc.arg('user_id')
+GROUP BY COALESCE(group_key, id::text), kind, chirp_id
+HAVING NOT sqlc.arg('unread_only')::bool OR COUNT(*) FILTER (WHERE read_at IS NULL) > 0
+ORDER BY latest_at DESC, id DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(DISTINCT COALESCE(group_key, id::text))
+FROM notifications
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationGroupRead :exec
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = sqlc.arg('user_id')
+AND read_at IS NULL
+AND COALESCE(group_key, id::text) = (
+    SELECT COALESCE(n.group_key, n.id::text)
+    FROM notifications AS n
+    WHERE n.id = sqlc.arg('id') AND n.user_id = sqlc.arg('user_id')
+);
+
+-- name: MarkAllNotificationsRead :exec
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: CreateSession :one
+INSERT INTO sessions (id, user_id, user_agent, ip_address, device_label, created_at, last_used_at, revoked_at)
+VALUES (
+    gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW(), NULL
+)
+RETURNING *;
+
+-- name: GetSession :one
+SELECT *
+FROM sessions
+WHERE id = $1;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_used_at = NOW(), user_agent = $2, ip_address = $3
+WHERE id = $1;
+
+-- name: ListActiveSessions :many
+SELECT *
+FROM sessions
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND EXISTS (
+    SELECT 1 FROM refresh_tokens
+    WHERE refresh_tokens.family_id = sessions.id
+    AND refresh_tokens.revoked_at IS NULL
+    AND refresh_tokens.expires_at > NOW()
+)
+ORDER BY last_used_at DESC;
+
+-- name: RevokeSession :execrows
+WITH tokens AS (
+    UPDATE refresh_tokens
+    SET updated_at = NOW(), revoked_at = NOW()
+    WHERE family_id = (
+        SELECT s.id FROM sessions AS s
+        WHERE s.id = sqlc.arg('id') AND s.user_id = sqlc.arg('user_id')
+    )
+    AND revoked_at IS NULL
+)
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = sqlc.arg('id') AND user_id = sqlc.arg('user_id') AND revoked_at IS NULL;
+
+-- name: RevokeOtherSessions :exec
+WITH tokens AS (
+    UPDATE refresh_tokens
+    SET updated_at = NOW(), revoked_at = NOW()
+    WHERE user_id = sqlc.arg('user_id')
+    AND revoked_at IS NULL
+    AND (sqlc.narg('keep_id')::uuid IS NULL OR family_id <> sqlc.narg('keep_id')::uuid)
+)
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE user_id = sqlc.arg('user_id')
+AND revoked_at IS NULL
+AND (sqlc.narg('keep_id')::uuid IS NULL OR id <> sqlc.narg('keep_id')::uuid);
+
+-- name: GetUser :one
+SELECT *
+FROM users
+WHERE id = $1;
+
+-- name: StartTOTPEnrollment :execrows
+INSERT INTO user_totp (user_id, secret, confirmed_at, last_counter, created_at)
+VALUES ($1, $2, NULL, 0, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_counter = 0, created_at = NOW()
+WHERE user_totp.confirmed_at IS NULL;
+
+-- name: GetUserTOTP :one
+SELECT *
+FROM user_totp
+WHERE user_id = $1;
+
+-- name: ConfirmTOTP :execrows
+UPDATE user_totp
+SET confirmed_at = NOW(), last_counter = $2
+WHERE user_id = $1 AND confirmed_at IS NULL AND last_counter < $2;
+
+-- name: UseTOTPCounter :execrows
+UPDATE user_totp
+SET last_counter = $2
+WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_counter < $2;
+
+-- name: DeleteTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: AddRecoveryCodes :exec
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at, used_at)
+SELECT gen_random_uuid(), sqlc.arg('user_id'), unnest(sqlc.arg('code_hashes')::text[]), NOW(), NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CreateEmailToken :exec
+INSERT INTO email_tokens (token_hash, user_id, purpose, email, created_at, expires_at, used_at)
+VALUES ($1, $2, $3, $4, NOW(), $5, NULL);
+
+-- name: ExpireEmailTokens :exec
+UPDATE email_tokens
+SET used_at = NOW()
+WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL;
+
+-- name: UseEmailToken :one
+UPDATE email_tokens
+SET used_at = NOW()
+WHERE token_hash = $1
+AND purpose = $2
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING user_id, email;
+
+-- name: MarkEmailVerified :execrows
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL;
+
+-- name: SetPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: AddLoginFailure :one
+INSERT INTO login_failures (lock_key, failures, last_failure_at, locked_until)
+VALUES (
+    sqlc.arg('lock_key'), 1, sqlc.arg('now'),
+    CASE WHEN sqlc.arg('free_attempts')::int <= 1
+        THEN sqlc.arg('now')::timestamp + make_interval(secs => LEAST(sqlc.arg('max_delay_seconds')::float8, sqlc.arg('base_delay_seconds')::float8 * POWER(2, 1 - sqlc.arg('free_attempts')::int)))
+    END
+)
+ON CONFLICT (lock_key) DO UPDATE
+SET failures = CASE WHEN login_failures.last_failure_at < sqlc.arg('since') THEN 1 ELSE login_failures.failures + 1 END,
+    last_failure_at = EXCLUDED.last_failure_at,
+    locked_until = CASE WHEN (CASE WHEN login_failures.last_failure_at < sqlc.arg('since') THEN 1 ELSE login_failures.failures + 1 END) >= sqlc.arg('free_attempts')::int
+        THEN EXCLUDED.last_failure_at + make_interval(secs => LEAST(sqlc.arg('max_delay_seconds')::float8, sqlc.arg('base_delay_seconds')::float8 * POWER(2, LEAST((CASE WHEN login_failures.last_failure_at < sqlc.arg('since') THEN 1 ELSE login_failures.failures + 1 END) - sqlc.arg('free_attempts')::int, 62))))
+    END
+WHERE login_failures.locked_until IS NULL OR login_failures.locked_until <= EXCLUDED.last_failure_at
+RETURNING *;
+
+-- name: ForgiveLoginFailure :exec
+UPDATE login_failures
+SET failures = GREATEST(failures - 1, 0), locked_until = NULL
+WHERE lock_key = $1;
+
+-- name: GetLoginFailures :one
+SELECT *
+FROM login_failures
+WHERE lock_key = $1;
+
+-- name: DeleteLoginFailures :exec
+DELETE FROM login_failures
+WHERE lock_key = $1;
+
+-- name: ListLoginFailures :many
+SELECT *
+FROM login_failures
+WHERE last_failure_at > sqlc.arg('since') OR locked_until > sqlc.arg('since')
+ORDER BY last_failure_at DESC;
+
+-- name: DeleteOldLoginFailures :exec
+DELETE FROM login_failures
+WHERE last_failure_at < $1
+AND (locked_until IS NULL OR locked_until <= $1);
+
+-- name: CreateAccessToken :one
+INSERT INTO access_tokens (id, user_id, name, token_hash, scopes, created_at, expires_at, last_used_at, revoked_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW(), $5, NULL, NULL)
+RETURNING *;
+
+-- name: GetAccessTokenByHash :one
+SELECT *
+FROM access_tokens
+WHERE token_hash = $1;
+
+-- name: ListAccessTokens :many
+SELECT *
+FROM access_tokens
+WHERE user_id = $1 AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: RevokeAccessToken :execrows
+UPDATE access_tokens
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: TouchAccessToken :exec
+UPDATE access_tokens
+SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: GetUserRole :one
+SELECT role
+FROM users
+WHERE id = $1;
+
+-- name: SetUserRole :execrows
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: PromoteFirstAdmin :execrows
+UPDATE users
+SET role = 'admin', updated_at = NOW()
+WHERE email = $1
+AND NOT EXISTS (SELECT 1 FROM users WHERE role = 'admin');
+
+-- name: RehashPassword :exec
+UPDATE users
+SET hashed_password = sqlc.arg('new_hash')
+WHERE id = sqlc.arg('id') AND hashed_password = sqlc.arg('old_hash');
+
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, owner_id, name, secret_hash, redirect_uris, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW())
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT *
+FROM oauth_clients
+WHERE id = $1;
+
+-- name: ListOAuthClients :many
+SELECT *
+FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND owner_id = $2;
+
+-- name: CreateOAuthCode :exec
+INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, redirect_uri_sent, scopes, code_challenge, created_at, expires_at, used_at, session_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), $8, NULL, NULL);
+
+-- name: UseOAuthCode :one
+UPDATE oauth_codes
+SET used_at = NOW()
+WHERE code_hash = $1
+AND used_at IS NULL
+AND expires_at > NOW()
+RETURNING *;
+
+-- name: GetOAuthCode :one
+SELECT *
+FROM oauth_codes
+WHERE code_hash = $1;
+
+-- name: SetOAuthCodeSession :exec
+UPDATE oauth_codes
+SET session_id = $2
+WHERE code_hash = $1;
+
+-- name: DeleteExpiredOAuthCodes :exec
+DELETE FROM oauth_codes
+WHERE expires_at < $1;
+
+-- name: CreateOAuthSession :one
+INSERT INTO sessions (id, user_id, user_agent, ip_address, device_label, created_at, last_used_at, revoked_at, client_id, scopes)
+VALUES (
+    gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW(), NULL, $5, $6
+)
+RETURNING *;
+
+-- name: RotateOAuthRefreshToken :one
+WITH old AS (
+    UPDATE refresh_tokens
+    SET revoked_at = NOW(), updated_at = NOW()
+    WHERE token = sqlc.arg('token')
+    AND revoked_at IS NULL
+    AND expires_at > NOW()
+    AND family_id IN (
+        SELECT id FROM sessions
+        WHERE revoked_at IS NULL AND client_id = sqlc.arg('client_id')
+    )
+    RETURNING user_id, family_id
+)
+INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
+SELECT sqlc.arg('new_token'), NOW(), NOW(), old.user_id, NOW() + INTERVAL '60 days', NULL, old.family_id
+FROM old
+RETURNING user_id, family_id;
+
+-- name: CreateModerationRule :one
+INSERT INTO moderation_rules (id, pattern, action, created_by, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW())
+RETURNING *;
+
+-- name: ListModerationRules :many
+SELECT *
+FROM moderation_rules
+ORDER BY created_at;
+
+-- name: DeleteModerationRule :one
+DELETE FROM moderation_rules
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateReport :one
+INSERT INTO reports (id, reporter_id, chirp_id, chirp_body, reported_user_id, category, details, status, created_at, resolved_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, 'open', NOW(), NULL)
+RETURNING *;
+
+-- name: GetReport :one
+SELECT *
+FROM reports
+WHERE id = $1;
+
+-- name: ListReports :many
+SELECT *
+FROM reports
+WHERE (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status')::text)
+AND (sqlc.narg('category')::text IS NULL OR category = sqlc.narg('category')::text)
+AND (sqlc.narg('chirp_id')::uuid IS NULL OR chirp_id = sqlc.narg('chirp_id')::uuid)
+AND (sqlc.narg('reported_user_id')::uuid IS NULL OR reported_user_id = sqlc.narg('reported_user_id')::uuid)
+AND (
+    sqlc.narg('cursor_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ResolveReport :execrows
+UPDATE reports
+SET status = $2, resolved_at = NOW()
+WHERE id = $1 AND status = 'open';
+
+-- name: ResolveChirpReports :exec
+UPDATE reports
+SET status = 'actioned', resolved_at = NOW()
+WHERE chirp_id = $1 AND status = 'open';
+
+-- name: CreateReportAction :one
+INSERT INTO report_actions (id, report_id, moderator_id, action, note, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW())
+RETURNING *;
+
+-- name: ListReportActions :many
+SELECT *
+FROM report_actions
+WHERE report_id = ANY(sqlc.arg('report_ids')::uuid[])
+ORDER BY created_at ASC;
+
+-- name: HideChirp :execrows
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE id = $1 AND hidden_at IS NULL;
+
+-- name: SetUserState :execrows
+UPDATE users
+SET status = $2, suspended_until = $3, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetUserState :one
+SELECT status, suspended_until, role
+FROM users
+WHERE id = $1;
+
+-- name: ListHiddenUsers :many
+SELECT id
+FROM users
+WHERE id = ANY(sqlc.arg('ids')::uuid[])
+AND status IN ('shadow_banned', 'deactivated');
+
+-- name: LockAuditEvents :exec
+SELECT pg_advisory_xact_lock(hashtext('audit_events'));
+
+-- name: GetLastAuditHash :one
+SELECT hash
+FROM audit_events
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: CreateAuditEvent :one
+INSERT INTO audit_events (created_at, action, actor_id, target_type, target_id, ip_address, request_id, metadata, prev_hash, hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING *;
+
+-- name: ListAuditEvents :many
+SELECT *
+FROM audit_events
+WHERE (sqlc.narg('action')::text IS NULL OR action = sqlc.narg('action') OR starts_with(action, sqlc.narg('action') || '.'))
+AND (sqlc.narg('actor_id')::uuid IS NULL OR actor_id = sqlc.narg('actor_id'))
+AND (sqlc.narg('target_type')::text IS NULL OR target_type = sqlc.narg('target_type'))
+AND (sqlc.narg('target_id')::text IS NULL OR target_id = sqlc.narg('target_id'))
+AND (sqlc.narg('ip_address')::text IS NULL OR ip_address = sqlc.narg('ip_address'))
+AND (sqlc.narg('request_id')::text IS NULL OR request_id = sqlc.narg('request_id'))
+AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since'))
+AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until'))
+AND (sqlc.narg('before_id')::bigint IS NULL OR id < sqlc.narg('before_id'))
+ORDER BY id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListAuditEventsAfter :many
+SELECT *
+FROM audit_events
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2;
+
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets (bucket_key, tokens, updated_at)
+VALUES (sqlc.arg('bucket_key'), sqlc.arg('capacity')::float8 - 1, sqlc.arg('now'))
+ON CONFLICT (bucket_key) DO UPDATE
+SET tokens = LEAST(sqlc.arg('capacity')::float8, rate_limit_buckets.tokens + GREATEST(EXTRACT(EPOCH FROM EXCLUDED.updated_at - rate_limit_buckets.updated_at)::float8, 0) * sqlc.arg('rate')::float8) - 1,
+    updated_at = GREATEST(EXCLUDED.updated_at, rate_limit_buckets.updated_at)
+WHERE LEAST(sqlc.arg('capacity')::float8, rate_limit_buckets.tokens + GREATEST(EXTRACT(EPOCH FROM EXCLUDED.updated_at - rate_limit_buckets.updated_at)::float8, 0) * sqlc.arg('rate')::float8) >= 1
+RETURNING tokens;
+
+-- name: GetRateLimitBucket :one
+SELECT *
+FROM rate_limit_buckets
+WHERE bucket_key = $1;
+
+-- name: DeleteRateLimitBuckets :exec
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1;
@@ -1,20 +1,20 @@
--- +goose Up
--- +goose StatementBegin
-CREATE TABLE refresh_tokens(
-    token TEXT PRIMARY KEY NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    user_id UUID NOT NULL,
-    CONSTRAINT fk_users
-    FOREIGN KEY (user_id)
-    REFERENCES users(id)
-    ON DELETE CASCADE,
-    expires_at TIMESTAMP NOT NULL,
-    revoked_at TIMESTAMP
-);
--- +goose StatementEnd
-
--- +goose Down
--- +goose StatementBegin
-DROP TABLE IF EXISTS refresh_tokens;
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE refresh_tokens(
+    token TEXT PRIMARY KEY NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    user_id UUID NOT NULL,
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS refresh_tokens;
 -- +goose StatementEnd
\ No newline at end of file
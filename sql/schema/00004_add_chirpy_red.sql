@@ -1,7 +1,7 @@
--- +goose Up
-ALTER TABLE users
-ADD COLUMN is_chirpy_red BOOLEAN DEFAULT false;
-
--- +goose Down
-ALTER TABLE users
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN is_chirpy_red BOOLEAN DEFAULT false;
+
+-- +goose Down
+ALTER TABLE users
 DROP COLUMN is_chirpy_red;
\ No newline at end of file
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE follows(
+    follower_id UUID NOT NULL,
+    followee_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id),
+    CONSTRAINT fk_follower
+    FOREIGN KEY (follower_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+    CONSTRAINT fk_followee
+    FOREIGN KEY (followee_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+    CONSTRAINT no_self_follow CHECK (follower_id <> followee_id)
+);
+-- +goose StatementEnd
+
+CREATE INDEX follows_followee_created_at_idx ON follows (followee_id, created_at, follower_id);
+CREATE INDEX follows_follower_created_at_idx ON follows (follower_id, created_at, followee_id);
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS follows;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN in_reply_to UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN thread_root_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX chirps_in_reply_to_idx ON chirps (in_reply_to);
+CREATE INDEX chirps_thread_root_id_idx ON chirps (thread_root_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS chirps_thread_root_id_idx;
+DROP INDEX IF EXISTS chirps_in_reply_to_idx;
+
+ALTER TABLE chirps
+DROP COLUMN deleted_at,
+DROP COLUMN thread_root_id,
+DROP COLUMN in_reply_to;
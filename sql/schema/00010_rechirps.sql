@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN kind TEXT NOT NULL DEFAULT 'chirp' CHECK (kind IN ('chirp', 'rechirp', 'quote')),
+ADD COLUMN reference_id UUID REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE INDEX chirps_reference_id_idx ON chirps (reference_id);
+CREATE UNIQUE INDEX chirps_one_rechirp_per_user_idx ON chirps (user_id, reference_id) WHERE kind = 'rechirp';
+
+-- +goose Down
+DROP INDEX IF EXISTS chirps_one_rechirp_per_user_idx;
+DROP INDEX IF EXISTS chirps_reference_id_idx;
+
+ALTER TABLE chirps
+DROP COLUMN reference_id,
+DROP COLUMN kind;
@@ -0,0 +1,26 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN revision_count INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementBegin
+CREATE TABLE chirp_revisions(
+    id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+    chirp_id UUID NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_chirps
+    FOREIGN KEY (chirp_id)
+    REFERENCES chirps(id)
+    ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+CREATE INDEX chirp_revisions_chirp_created_at_idx ON chirp_revisions (chirp_id, created_at);
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS chirp_revisions;
+-- +goose StatementEnd
+
+ALTER TABLE chirps
+DROP COLUMN revision_count;
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE hashtags(
+    id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+    tag TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE chirp_hashtags(
+    chirp_id UUID NOT NULL,
+    hashtag_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (chirp_id, hashtag_id),
+    CONSTRAINT fk_chirps
+    FOREIGN KEY (chirp_id)
+    REFERENCES chirps(id)
+    ON DELETE CASCADE,
+    CONSTRAINT fk_hashtags
+    FOREIGN KEY (hashtag_id)
+    REFERENCES hashtags(id)
+    ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+CREATE INDEX chirp_hashtags_hashtag_created_at_idx ON chirp_hashtags (hashtag_id, created_at);
+CREATE INDEX chirp_hashtags_created_at_idx ON chirp_hashtags (created_at);
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS chirp_hashtags;
+DROP TABLE IF EXISTS hashtags;
+-- +goose StatementEnd
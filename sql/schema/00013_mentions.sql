@@ -0,0 +1,32 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN username TEXT UNIQUE;
+
+-- +goose StatementBegin
+CREATE TABLE chirp_mentions(
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    start_offset INTEGER NOT NULL,
+    end_offset INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (chirp_id, start_offset),
+    CONSTRAINT fk_chirps
+    FOREIGN KEY (chirp_id)
+    REFERENCES chirps(id)
+    ON DELETE CASCADE,
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+CREATE INDEX chirp_mentions_user_idx ON chirp_mentions (user_id, chirp_id);
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS chirp_mentions;
+-- +goose StatementEnd
+
+ALTER TABLE users
+DROP COLUMN username;
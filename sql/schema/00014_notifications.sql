@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE notifications(
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('follow', 'like', 'reply', 'mention', 'rechirp', 'quote', 'chirpy_red')),
+    actor_id UUID,
+    chirp_id UUID,
+    group_key TEXT,
+    created_at TIMESTAMP NOT NULL,
+    read_at TIMESTAMP,
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+    CONSTRAINT fk_actors
+    FOREIGN KEY (actor_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+    CONSTRAINT fk_chirps
+    FOREIGN KEY (chirp_id)
+    REFERENCES chirps(id)
+    ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+CREATE INDEX notifications_user_created_at_idx ON notifications (user_id, created_at DESC);
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS notifications;
+-- +goose StatementEnd
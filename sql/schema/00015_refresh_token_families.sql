@@ -0,0 +1,20 @@
+-- +goose Up
+-- Every refresh token belongs to a family started at login, rotating a
+-- token keeps the family so reuse of an old token can revoke all of them
+ALTER TABLE refresh_tokens
+ADD COLUMN family_id UUID;
+
+UPDATE refresh_tokens
+SET family_id = gen_random_uuid()
+WHERE family_id IS NULL;
+
+ALTER TABLE refresh_tokens
+ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX refresh_tokens_family_idx ON refresh_tokens (family_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS refresh_tokens_family_idx;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN family_id;
@@ -0,0 +1,44 @@
+-- +goose Up
+-- A session is one login on one device, its id is the refresh token family
+-- +goose StatementBegin
+CREATE TABLE sessions(
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    device_label TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+CREATE INDEX sessions_user_idx ON sessions (user_id, last_used_at DESC);
+
+-- Existing token families become sessions we don't know the device for
+INSERT INTO sessions (id, user_id, created_at, last_used_at, revoked_at)
+SELECT family_id,
+    (array_agg(user_id))[1],
+    MIN(created_at),
+    MAX(updated_at),
+    CASE WHEN bool_and(revoked_at IS NOT NULL) THEN MAX(revoked_at) END
+FROM refresh_tokens
+GROUP BY family_id;
+
+ALTER TABLE refresh_tokens
+ADD CONSTRAINT fk_sessions
+FOREIGN KEY (family_id)
+REFERENCES sessions(id)
+ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP CONSTRAINT IF EXISTS fk_sessions;
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sessions;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+
+-- Only a hash of each token is stored, the token itself is in the email
+-- +goose StatementBegin
+CREATE TABLE email_tokens(
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL,
+    purpose TEXT NOT NULL CHECK (purpose IN ('verify_email', 'reset_password')),
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+CREATE INDEX email_tokens_user_idx ON email_tokens (user_id, purpose);
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS email_tokens;
+-- +goose StatementEnd
+
+ALTER TABLE users
+DROP COLUMN email_verified_at;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Failed login attempts per email address or IP, see internal/lockout
+-- +goose StatementBegin
+CREATE TABLE login_failures(
+    lock_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS login_failures;
+-- +goose StatementEnd
@@ -0,0 +1,53 @@
+-- +goose Up
+-- Third party apps registered by users, public clients (like mobile apps)
+-- have no secret and rely on PKCE alone
+-- +goose StatementBegin
+CREATE TABLE oauth_clients(
+    id UUID PRIMARY KEY,
+    owner_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    secret_hash TEXT,
+    redirect_uris TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_users
+    FOREIGN KEY (owner_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+CREATE INDEX oauth_clients_owner_idx ON oauth_clients (owner_id, created_at);
+
+-- Authorization codes waiting to be swapped for tokens, only the hash is kept
+-- +goose StatementBegin
+CREATE TABLE oauth_codes(
+    code_hash TEXT PRIMARY KEY,
+    client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    session_id UUID
+);
+-- +goose StatementEnd
+
+-- An app's tokens are a session like any login, with the scopes the user agreed to
+ALTER TABLE sessions
+ADD COLUMN client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE,
+ADD COLUMN scopes TEXT[];
+
+-- +goose Down
+ALTER TABLE sessions
+DROP COLUMN scopes,
+DROP COLUMN client_id;
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS oauth_codes;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS oauth_clients;
+-- +goose StatementEnd
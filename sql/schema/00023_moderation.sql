@@ -0,0 +1,33 @@
+-- +goose Up
+-- Words and phrases added by admins on top of the ones in the config file
+-- +goose StatementBegin
+CREATE TABLE moderation_rules(
+    id UUID PRIMARY KEY,
+    pattern TEXT NOT NULL UNIQUE,
+    action TEXT NOT NULL CHECK (action IN ('mask', 'reject', 'flag')),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL
+);
+-- +goose StatementEnd
+
+-- Chirps that matched a flag rule, waiting for a moderator to look at them
+-- +goose StatementBegin
+CREATE TABLE moderation_flags(
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    patterns TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP
+);
+-- +goose StatementEnd
+
+CREATE INDEX moderation_flags_open_idx ON moderation_flags (created_at) WHERE resolved_at IS NULL;
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS moderation_flags;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS moderation_rules;
+-- +goose StatementEnd
@@ -0,0 +1,93 @@
+-- +goose Up
+-- Moderators can hide a chirp without deleting it, and suspend accounts
+ALTER TABLE chirps
+ADD COLUMN hidden_at TIMESTAMP;
+
+ALTER TABLE users
+ADD COLUMN suspended_until TIMESTAMP;
+
+-- Chirps and accounts reported by users, or flagged by the moderation rules
+-- when there's no reporter. The chirp's body is copied in case it's edited
+-- or deleted before anyone looks at it
+-- +goose StatementBegin
+CREATE TABLE reports(
+    id UUID PRIMARY KEY,
+    reporter_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    chirp_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+    chirp_body TEXT,
+    reported_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category TEXT NOT NULL CHECK (category IN ('spam', 'harassment', 'hate', 'violence', 'sexual', 'self_harm', 'misinformation', 'impersonation', 'other', 'moderation_rule')),
+    details TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'dismissed', 'actioned')),
+    created_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP
+);
+-- +goose StatementEnd
+
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at, id);
+
+-- Each user can only have one open report about the same chirp or account,
+-- account reports are the ones with no chirp body
+CREATE UNIQUE INDEX reports_open_chirp_idx ON reports (reporter_id, chirp_id) WHERE status = 'open';
+CREATE UNIQUE INDEX reports_open_account_idx ON reports (reporter_id, reported_user_id) WHERE status = 'open' AND chirp_body IS NULL;
+
+-- What moderators did about a report and why
+-- +goose StatementBegin
+CREATE TABLE report_actions(
+    id UUID PRIMARY KEY,
+    report_id UUID NOT NULL REFERENCES reports(id) ON DELETE CASCADE,
+    moderator_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL CHECK (action IN ('dismiss', 'hide_chirp', 'delete_chirp', 'suspend_user')),
+    note TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+-- +goose StatementEnd
+
+CREATE INDEX report_actions_report_idx ON report_actions (report_id, created_at);
+
+-- Flags from the moderation rules go in the same queue now
+-- +goose StatementBegin
+INSERT INTO reports (id, reporter_id, chirp_id, chirp_body, reported_user_id, category, details, status, created_at, resolved_at)
+SELECT moderation_flags.id, NULL, chirps.id, chirps.body, chirps.user_id, 'moderation_rule',
+    'Matched ' || array_to_string(moderation_flags.patterns, ', '),
+    CASE WHEN moderation_flags.resolved_at IS NULL THEN 'open' ELSE 'dismissed' END,
+    moderation_flags.created_at, moderation_flags.resolved_at
+FROM moderation_flags
+JOIN chirps ON chirps.id = moderation_flags.chirp_id;
+-- +goose StatementEnd
+
+DROP TABLE moderation_flags;
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE TABLE moderation_flags(
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    patterns TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP
+);
+-- +goose StatementEnd
+
+CREATE INDEX moderation_flags_open_idx ON moderation_flags (created_at) WHERE resolved_at IS NULL;
+
+-- +goose StatementBegin
+INSERT INTO moderation_flags (id, chirp_id, patterns, created_at, resolved_at)
+SELECT id, chirp_id, string_to_array(substring(details FROM 9), ', '), created_at, resolved_at
+FROM reports
+WHERE category = 'moderation_rule' AND chirp_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS report_actions;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS reports;
+-- +goose StatementEnd
+
+ALTER TABLE users
+DROP COLUMN suspended_until;
+
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
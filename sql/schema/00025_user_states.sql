@@ -0,0 +1,15 @@
+-- +goose Up
+-- Suspended users have suspended_until set and are active again once it's
+-- passed, shadow banned users' chirps are only shown to themselves
+ALTER TABLE users
+ADD COLUMN status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended', 'shadow_banned', 'deactivated'));
+
+UPDATE users
+SET status = 'suspended'
+WHERE suspended_until > NOW();
+
+CREATE INDEX users_hidden_status_idx ON users (id) WHERE status IN ('shadow_banned', 'deactivated');
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN status;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Token buckets shared between servers, a missing bucket is a full one
+CREATE TABLE rate_limit_buckets(
+    bucket_key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX rate_limit_buckets_updated_at_idx ON rate_limit_buckets (updated_at);
+
+-- +goose Down
+DROP TABLE rate_limit_buckets;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Whether the app sent a redirect_uri to /oauth/authorize, if it did it has
+-- to send the same one again to swap the code (RFC 6749 4.1.3)
+ALTER TABLE oauth_codes ADD COLUMN redirect_uri_sent BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX oauth_codes_expires_at_idx ON oauth_codes (expires_at);
+
+-- +goose Down
+DROP INDEX oauth_codes_expires_at_idx;
+ALTER TABLE oauth_codes DROP COLUMN redirect_uri_sent;
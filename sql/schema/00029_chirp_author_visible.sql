@@ -0,0 +1,12 @@
+-- +goose Up
+-- Shadow banned and deactivated users' chirps are hidden from everyone but
+-- themselves, viewer_id is NULL when nobody is logged in
+-- +goose StatementBegin
+CREATE FUNCTION chirp_author_visible(author_id UUID, viewer_id UUID) RETURNS BOOLEAN AS $$
+    SELECT (viewer_id IS NOT NULL AND author_id = viewer_id)
+        OR NOT EXISTS (SELECT 1 FROM users WHERE users.id = author_id AND users.status IN ('shadow_banned', 'deactivated'));
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION chirp_author_visible(UUID, UUID);
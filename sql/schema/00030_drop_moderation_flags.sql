@@ -0,0 +1,8 @@
+-- +goose Up
+-- 00024 already moves moderation flags into reports, this makes sure the
+-- old table is gone wherever that didn't happen
+DROP INDEX IF EXISTS moderation_flags_open_idx;
+DROP TABLE IF EXISTS moderation_flags;
+
+-- +goose Down
+-- Nothing to put back, flags live in reports now
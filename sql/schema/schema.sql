@@ -1,34 +1,372 @@
-CREATE TABLE users(
-	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-	created_at TIMESTAMP NOT NULL,
-	updated_at TIMESTAMP NOT NULL,
-	email TEXT NOT NULL UNIQUE,
-    hashed_password TEXT NOT NULL,
-    is_chirpy_red BOOLEAN DEFAULT false
-);
-
-CREATE TABLE chirps(
-    id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
-    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    body TEXT NOT NULL,
-    user_id UUID NOT NULL,
-    CONSTRAINT fk_users
-    FOREIGN KEY (user_id)
-    REFERENCES users(id)
-    ON DELETE CASCADE
-);
-
-CREATE TABLE refresh_tokens(
-    token TEXT PRIMARY KEY NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    user_id UUID NOT NULL,
-    CONSTRAINT fk_users
-    FOREIGN KEY (user_id)
-    REFERENCES users(id)
-    ON DELETE CASCADE,
-    expires_at TIMESTAMP NOT NULL,
-    revoked_at TIMESTAMP
-);
-
+CREATE TABLE users(
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+    hashed_password TEXT NOT NULL,
+    is_chirpy_red BOOLEAN DEFAULT false,
+    username TEXT UNIQUE,
+    email_verified_at TIMESTAMP,
+    role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin')),
+    suspended_until TIMESTAMP,
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended', 'shadow_banned', 'deactivated'))
+);
+
+CREATE INDEX users_hidden_status_idx ON users (id) WHERE status IN ('shadow_banned', 'deactivated');
+
+CREATE FUNCTION chirp_author_visible(author_id UUID, viewer_id UUID) RETURNS BOOLEAN AS $$
+    SELECT (viewer_id IS NOT NULL AND author_id = viewer_id)
+        OR NOT EXISTS (SELECT 1 FROM users WHERE users.id = author_id AND users.status IN ('shadow_banned', 'deactivated'));
+$$ LANGUAGE sql STABLE;
+
+CREATE TABLE chirps(
+    id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    body TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', body)) STORED,
+    in_reply_to UUID REFERENCES chirps(id) ON DELETE SET NULL,
+    thread_root_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+    deleted_at TIMESTAMP,
+    kind TEXT NOT NULL DEFAULT 'chirp' CHECK (kind IN ('chirp', 'rechirp', 'quote')),
+    reference_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+    revision_count INTEGER NOT NULL DEFAULT 0,
+    hidden_at TIMESTAMP,
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX chirps_created_at_id_idx ON chirps (created_at, id);
+CREATE INDEX chirps_user_created_at_id_idx ON chirps (user_id, created_at, id);
+CREATE INDEX chirps_search_vector_idx ON chirps USING GIN (search_vector);
+CREATE INDEX chirps_in_reply_to_idx ON chirps (in_reply_to);
+CREATE INDEX chirps_thread_root_id_idx ON chirps (thread_root_id);
+CREATE INDEX chirps_reference_id_idx ON chirps (reference_id);
+CREATE UNIQUE INDEX chirps_one_rechirp_per_user_idx ON chirps (user_id, reference_id) WHERE kind = 'rechirp';
+
+CREATE TABLE refresh_tokens(
+    token TEXT PRIMARY KEY NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    user_id UUID NOT NULL,
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    family_id UUID NOT NULL
+);
+
+CREATE INDEX refresh_tokens_family_idx ON refresh_tokens (family_id);
+
+CREATE TABLE follows(
+    follower_id UUID NOT NULL,
+    followee_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id),
+    CONSTRAINT fk_follower
+    FOREIGN KEY (follower_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+    CONSTRAINT fk_followee
+    FOREIGN KEY (followee_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+    CONSTRAINT no_self_follow CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX follows_followee_created_at_idx ON follows (followee_id, created_at, follower_id);
+CREATE INDEX follows_follower_created_at_idx ON follows (follower_id, created_at, followee_id);
+
+CREATE TABLE chirp_likes(
+    user_id UUID NOT NULL,
+    chirp_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, chirp_id),
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+    CONSTRAINT fk_chirps
+    FOREIGN KEY (chirp_id)
+    REFERENCES chirps(id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_likes_chirp_created_at_idx ON chirp_likes (chirp_id, created_at, user_id);
+CREATE INDEX chirp_likes_user_created_at_idx ON chirp_likes (user_id, created_at, chirp_id);
+
+CREATE TABLE chirp_revisions(
+    id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+    chirp_id UUID NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CONSTRAINT fk_chirps
+    FOREIGN KEY (chirp_id)
+    REFERENCES chirps(id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_revisions_chirp_created_at_idx ON chirp_revisions (chirp_id, created_at);
+
+CREATE TABLE hashtags(
+    id UUID PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+    tag TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE chirp_hashtags(
+    chirp_id UUID NOT NULL,
+    hashtag_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (chirp_id, hashtag_id),
+    CONSTRAINT fk_chirps
+    FOREIGN KEY (chirp_id)
+    REFERENCES chirps(id)
+    ON DELETE CASCADE,
+    CONSTRAINT fk_hashtags
+    FOREIGN KEY (hashtag_id)
+    REFERENCES hashtags(id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_hashtags_hashtag_created_at_idx ON chirp_hashtags (hashtag_id, created_at);
+CREATE INDEX chirp_hashtags_created_at_idx ON chirp_hashtags (created_at);
+
+CREATE TABLE chirp_mentions(
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    start_offset INTEGER NOT NULL,
+    end_offset INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (chirp_id, start_offset),
+    CONSTRAINT fk_chirps
+    FOREIGN KEY (chirp_id)
+    REFERENCES chirps(id)
+    ON DELETE CASCADE,
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_mentions_user_idx ON chirp_mentions (user_id, chirp_id);
+
+CREATE TABLE notifications(
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('follow', 'like', 'reply', 'mention', 'rechirp', 'quote', 'chirpy_red')),
+    actor_id UUID,
+    chirp_id UUID,
+    group_key TEXT,
+    created_at TIMESTAMP NOT NULL,
+    read_at TIMESTAMP,
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+    CONSTRAINT fk_actors
+    FOREIGN KEY (actor_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE,
+    CONSTRAINT fk_chirps
+    FOREIGN KEY (chirp_id)
+    REFERENCES chirps(id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_created_at_idx ON notifications (user_id, created_at DESC);
+
+CREATE TABLE sessions(
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    device_label TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    client_id UUID,
+    scopes TEXT[],
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX sessions_user_idx ON sessions (user_id, last_used_at DESC);
+
+ALTER TABLE refresh_tokens
+ADD CONSTRAINT fk_sessions
+FOREIGN KEY (family_id)
+REFERENCES sessions(id)
+ON DELETE CASCADE;
+
+CREATE TABLE user_totp(
+    user_id UUID PRIMARY KEY,
+    secret TEXT NOT NULL,
+    confirmed_at TIMESTAMP,
+    last_counter BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+
+CREATE TABLE recovery_codes(
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    code_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    UNIQUE (user_id, code_hash),
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+
+CREATE TABLE email_tokens(
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL,
+    purpose TEXT NOT NULL CHECK (purpose IN ('verify_email', 'reset_password')),
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX email_tokens_user_idx ON email_tokens (user_id, purpose);
+
+CREATE TABLE login_failures(
+    lock_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
+
+CREATE TABLE access_tokens(
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    CONSTRAINT fk_users
+    FOREIGN KEY (user_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX access_tokens_user_idx ON access_tokens (user_id, created_at);
+
+CREATE TABLE oauth_clients(
+    id UUID PRIMARY KEY,
+    owner_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    secret_hash TEXT,
+    redirect_uris TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_users
+    FOREIGN KEY (owner_id)
+    REFERENCES users(id)
+    ON DELETE CASCADE
+);
+
+CREATE INDEX oauth_clients_owner_idx ON oauth_clients (owner_id, created_at);
+
+CREATE TABLE oauth_codes(
+    code_hash TEXT PRIMARY KEY,
+    client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    session_id UUID,
+    redirect_uri_sent BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX oauth_codes_expires_at_idx ON oauth_codes (expires_at);
+
+ALTER TABLE sessions
+ADD CONSTRAINT fk_oauth_clients
+FOREIGN KEY (client_id)
+REFERENCES oauth_clients(id)
+ON DELETE CASCADE;
+
+CREATE TABLE moderation_rules(
+    id UUID PRIMARY KEY,
+    pattern TEXT NOT NULL UNIQUE,
+    action TEXT NOT NULL CHECK (action IN ('mask', 'reject', 'flag')),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE reports(
+    id UUID PRIMARY KEY,
+    reporter_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    chirp_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+    chirp_body TEXT,
+    reported_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category TEXT NOT NULL CHECK (category IN ('spam', 'harassment', 'hate', 'violence', 'sexual', 'self_harm', 'misinformation', 'impersonation', 'other', 'moderation_rule')),
+    details TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'dismissed', 'actioned')),
+    created_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP
+);
+
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at, id);
+CREATE UNIQUE INDEX reports_open_chirp_idx ON reports (reporter_id, chirp_id) WHERE status = 'open';
+CREATE UNIQUE INDEX reports_open_account_idx ON reports (reporter_id, reported_user_id) WHERE status = 'open' AND chirp_body IS NULL;
+
+CREATE TABLE report_actions(
+    id UUID PRIMARY KEY,
+    report_id UUID NOT NULL REFERENCES reports(id) ON DELETE CASCADE,
+    moderator_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL CHECK (action IN ('dismiss', 'hide_chirp', 'delete_chirp', 'suspend_user')),
+    note TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX report_actions_report_idx ON report_actions (report_id, created_at);
+
+CREATE TABLE audit_events(
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    action TEXT NOT NULL,
+    actor_id UUID,
+    target_type TEXT NOT NULL DEFAULT '',
+    target_id TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    metadata JSONB NOT NULL DEFAULT '{}',
+    prev_hash TEXT NOT NULL UNIQUE,
+    hash TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX audit_events_action_idx ON audit_events (action, id);
+CREATE INDEX audit_events_actor_idx ON audit_events (actor_id, id);
+CREATE INDEX audit_events_target_idx ON audit_events (target_type, target_id, id);
+
+CREATE TABLE rate_limit_buckets(
+    bucket_key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX rate_limit_buckets_updated_at_idx ON rate_limit_buckets (updated_at);
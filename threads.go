@@ -0,0 +1,131 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// A reply in a thread, depth 1 is a direct reply to the chirp being viewed
+type threadReply struct {
+	Chirp
+	Depth int32 `json:"depth"`
+}
+
+// Response for the conversation view of a chirp
+type threadResponse struct {
+	Ancestors  []Chirp       `json:"ancestors"`
+	Chirp      Chirp         `json:"chirp"`
+	Replies    []threadReply `json:"replies"`
+	NextOffset *int          `json:"next_offset,omitempty"`
+}
+
+// Returns a chirp with everything above it (root first) and a page of
+// everything below it, depth first in the order the replies were made
+
+func (cfg *ApiConfig) getThread(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Chirp ID format")
+		return
+	}
+
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dbChirp, err := cfg.DBQueries.GetChirp(ctx, chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Chirp not found")
+			return
+		}
+		log.Printf("Error finding chirp in database: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Error finding chirp")
+		return
+	}
+
+	ancestors, err := cfg.DBQueries.GetChirpAncestors(ctx, chirpID)
+	if err != nil {
+		log.Printf("Error fetching chirp ancestors: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Error fetching thread")
+		return
+	}
+
+	// Ask for one extra so we know if there's another page of replies
+	descendants, err := cfg.DBQueries.GetChirpDescendants(ctx, database.GetChirpDescendantsParams{
+		ID:     chirpID,
+		Limit:  int32(limit + 1),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		log.Printf("Error fetching chirp replies: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Error fetching thread")
+		return
+	}
+
+	resp := threadResponse{
+		Ancestors: []Chirp{},
+		Chirp:     chirpFromDB(dbChirp),
+		Replies:   []threadReply{},
+	}
+
+	for _, ancestor := range ancestors {
+		resp.Ancestors = append(resp.Ancestors, chirpFromDB(ancestor))
+	}
+
+	if len(descendants) > limit {
+		descendants = descendants[:limit]
+		next := offset + limit
+		resp.NextOffset = &next
+	}
+
+	for _, row := range descendants {
+		resp.Replies = append(resp.Replies, threadReply{
+			Chirp: chirpFromDB(database.Chirp{
+				ID:            row.ID,
+				CreatedAt:     row.CreatedAt,
+				UpdatedAt:     row.UpdatedAt,
+				Body:          row.Body,
+				UserID:        row.UserID,
+				InReplyTo:     row.InReplyTo,
+				ThreadRootID:  row.ThreadRootID,
+				DeletedAt:     row.DeletedAt,
+				Kind:          row.Kind,
+				ReferenceID:   row.ReferenceID,
+				RevisionCount: row.RevisionCount,
+				HiddenAt:      row.HiddenAt,
+			}),
+			Depth: row.Depth,
+		})
+	}
+
+	// Collect every chirp in the response so likes are counted in one go
+	chirps := []*Chirp{&resp.Chirp}
+	for i := range resp.Ancestors {
+		chirps = append(chirps, &resp.Ancestors[i])
+	}
+	for i := range resp.Replies {
+		chirps = append(chirps, &resp.Replies[i].Chirp)
+	}
+
+	err = cfg.decorateChirps(ctx, cfg.optionalUser(r), chirps...)
+	if err != nil {
+		log.Printf("Error counting likes: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Error fetching thread")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
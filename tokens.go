@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Passed to authenticatedUser for endpoints only a real login can use,
+// like managing sessions, 2FA, tokens and OAuth apps
+const sessionOnly = ""
+
+const maxTokenNameLength = 100
+
+// A personal access token or OAuth app's token was used somewhere it isn't allowed
+type scopeError struct {
+	scope string
+}
+
+func (e *scopeError) Error() string {
+	if e.scope == sessionOnly {
+		return "this needs a login, app and personal access tokens can't be used here"
+	}
+	return fmt.Sprintf("token is missing the %s scope", e.scope)
+}
+
+// What the client is told, capitalised like the rest of our errors
+func (e *scopeError) message() string {
+	msg := e.Error()
+	return strings.ToUpper(msg[:1]) + msg[1:]
+}
+
+// A personal access token as shown to its owner, the token itself is
+// only ever sent back once when it's made
+type accessTokenResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func accessTokenFromDB(token database.AccessToken) accessTokenResponse {
+	resp := accessTokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt,
+	}
+	if token.ExpiresAt.Valid {
+		resp.ExpiresAt = &token.ExpiresAt.Time
+	}
+	if token.LastUsedAt.Valid {
+		resp.LastUsedAt = &token.LastUsedAt.Time
+	}
+	return resp
+}
+
+// Looks up the user behind a personal access token, checking it's still
+// live and allowed to do what's being asked
+func (cfg *ApiConfig) accessTokenUser(ctx context.Context, token, scope string) (uuid.UUID, error) {
+	dbToken, err := cfg.DBQueries.GetAccessTokenByHash(ctx, auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, errors.New("invalid access token")
+		}
+		return uuid.Nil, err
+	}
+
+	if dbToken.RevokedAt.Valid {
+		return uuid.Nil, errors.New("access token has been revoked")
+	}
+	if dbToken.ExpiresAt.Valid && time.Now().After(dbToken.ExpiresAt.Time) {
+		return uuid.Nil, errors.New("access token has expired")
+	}
+	if scope == sessionOnly || !auth.HasScope(dbToken.Scopes, scope) {
+		return uuid.Nil, &scopeError{scope: scope}
+	}
+
+	err = cfg.DBQueries.TouchAccessToken(ctx, dbToken.ID)
+	if err != nil {
+		log.Printf("Error updating access token last used: %s", err)
+	}
+
+	return dbToken.UserID, nil
+}
+
+// Makes a new personal access token for the logged in user
+func (cfg *ApiConfig) createAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	var params struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > maxTokenNameLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Token name must be 1 to %d characters", maxTokenNameLength))
+		return
+	}
+
+	scopes, err := auth.ParseScopes(params.Scopes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// No expiry unless one is asked for
+	var expiresAt sql.NullTime
+	if params.ExpiresInDays < 0 {
+		respondWithError(w, http.StatusBadRequest, "expires_in_days can't be negative")
+		return
+	}
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().UTC().AddDate(0, 0, params.ExpiresInDays), Valid: true}
+	}
+
+	token, err := auth.MakeAccessToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token")
+		return
+	}
+
+	dbToken, err := cfg.DBQueries.CreateAccessToken(r.Context(), database.CreateAccessTokenParams{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		log.Printf("Error saving access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create token")
+		return
+	}
+
+	resp := accessTokenFromDB(dbToken)
+	resp.Token = token
+
+	err = respondWithJSON(w, http.StatusCreated, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Lists the logged in user's personal access tokens that haven't been revoked
+func (cfg *ApiConfig) getAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	tokens, err := cfg.DBQueries.ListAccessTokens(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error listing access tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to list tokens")
+		return
+	}
+
+	resp := []accessTokenResponse{}
+	for _, token := range tokens {
+		resp = append(resp, accessTokenFromDB(token))
+	}
+
+	err = respondWithJSON(w, http.StatusOK, resp)
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Revokes one of the logged in user's personal access tokens, it stops working straight away
+func (cfg *ApiConfig) revokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid token ID format")
+		return
+	}
+
+	revoked, err := cfg.DBQueries.RevokeAccessToken(r.Context(), database.RevokeAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Error revoking access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to revoke token")
+		return
+	}
+
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Token not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCredentialsBody = `{"email":"new@example.com","password":"another horse battery"}`
+
+func TestUpdateUserNeedsLogin(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	pat := createTestAccessToken(t, cfg, alice.ID, auth.ScopeProfileWrite)
+
+	// Even with profile:write a token can't take over the account
+	rec := serveTest(cfg.updateUser, "PUT", "/api/users", pat, testCredentialsBody)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	dbUser, err := cfg.DBQueries.GetUser(context.Background(), alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", dbUser.Email)
+
+	rec = serveTest(cfg.updateUser, "PUT", "/api/users", testToken(t, cfg, alice.ID), testCredentialsBody)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+// App tokens are turned away before anything is looked up
+func TestUpdateUserRejectsAppTokens(t *testing.T) {
+	cfg := &ApiConfig{jwtKeys: auth.SecretKeySet("test-secret")}
+	token, err := cfg.jwtKeys.MakeOAuthJWT(uuid.New(), uuid.New(), uuid.New(), []string{auth.ScopeProfileWrite}, time.Hour)
+	require.NoError(t, err)
+
+	rec := serveTest(cfg.updateUser, "PUT", "/api/users", token, testCredentialsBody)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestMarkNotificationsReadNeedsWriteScope(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	readOnly := createTestAccessToken(t, cfg, alice.ID, auth.ScopeChirpsRead)
+
+	rec := serveTest(cfg.markAllNotificationsRead, "POST", "/api/notifications/read", readOnly, "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	writer := createTestAccessToken(t, cfg, alice.ID, auth.ScopeChirpsWrite)
+	rec = serveTest(cfg.markAllNotificationsRead, "POST", "/api/notifications/read", writer, "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// How long after a correct password the second step can be done
+	mfaChallengeTTL = 5 * time.Minute
+
+	// How many single use recovery codes users get when turning on 2FA
+	recoveryCodeCount = 10
+
+	totpIssuer = "Chirpy"
+)
+
+// What login returns instead of tokens when 2FA is on
+type mfaChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// Request body for anything that asks for a 2FA code
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// 2FA only counts once the user has confirmed it with a code
+func (cfg *ApiConfig) twoFactorEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	totp, err := cfg.DBQueries.GetUserTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return totp.ConfirmedAt.Valid, nil
+}
+
+func (cfg *ApiConfig) sendMFAChallenge(w http.ResponseWriter, userID uuid.UUID) {
+	token, err := cfg.jwtKeys.MakeMFAToken(userID, mfaChallengeTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, mfaChallenge{MFARequired: true, MFAToken: token})
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Checks a code from the user's authenticator app, or one of their recovery codes
+// Either can only be used once
+func (cfg *ApiConfig) checkSecondFactor(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return false, nil
+	}
+
+	totp, err := cfg.DBQueries.GetUserTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !totp.ConfirmedAt.Valid {
+		return false, nil
+	}
+
+	if counter, ok := auth.ValidateTOTP(totp.Secret, code); ok {
+		// Only moves forward, so the same code can't be used twice
+		used, err := cfg.DBQueries.UseTOTPCounter(ctx, database.UseTOTPCounterParams{
+			UserID:      userID,
+			LastCounter: counter,
+		})
+		return used == 1, err
+	}
+
+	used, err := cfg.DBQueries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   userID,
+		CodeHash: auth.HashRecoveryCode(code),
+	})
+	return used == 1, err
+}
+
+// Starts setting up 2FA, returns the secret to put in an authenticator app
+// It isn't switched on until it's confirmed with a code
+func (cfg *ApiConfig) enrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	dbUser, err := cfg.DBQueries.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to set up 2FA")
+		return
+	}
+
+	started, err := cfg.DBQueries.StartTOTPEnrollment(r.Context(), database.StartTOTPEnrollmentParams{
+		UserID: userID,
+		Secret: secret,
+	})
+	if err != nil {
+		log.Printf("Error starting 2FA enrollment: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to set up 2FA")
+		return
+	}
+
+	// Nothing changes if it's already on
+	if started == 0 {
+		respondWithError(w, http.StatusConflict, "2FA is already enabled")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, map[string]string{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(secret, totpIssuer, dbUser.Email),
+	})
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Turns on 2FA once the user proves their app has the secret, and hands
+// back recovery codes, this is the only time they're shown
+func (cfg *ApiConfig) confirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	var params twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	totp, err := cfg.DBQueries.GetUserTOTP(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "2FA setup hasn't been started")
+			return
+		}
+		log.Printf("Error finding 2FA setup: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to confirm 2FA")
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		respondWithError(w, http.StatusConflict, "2FA is already enabled")
+		return
+	}
+
+	counter, ok := auth.ValidateTOTP(totp.Secret, params.Code)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to confirm 2FA")
+		return
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, auth.HashRecoveryCode(code))
+	}
+
+	confirmed, err := cfg.enableTwoFactor(r.Context(), userID, counter, hashes)
+	if err != nil {
+		log.Printf("Error confirming 2FA: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to confirm 2FA")
+		return
+	}
+	if !confirmed {
+		respondWithError(w, http.StatusConflict, "2FA is already enabled")
+		return
+	}
+
+	err = respondWithJSON(w, http.StatusOK, map[string][]string{
+		"recovery_codes": codes,
+	})
+	if err != nil {
+		log.Printf("JSON encoding error: %s", err)
+	}
+}
+
+// Turns 2FA off, needs a current code (or recovery code) as well as the access token
+func (cfg *ApiConfig) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUser(r, sessionOnly)
+	if err != nil {
+		respondWithAuthError(w, err, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	var params twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	ok, err := cfg.checkSecondFactor(r.Context(), userID, params.Code)
+	if err != nil {
+		log.Printf("Error checking 2FA code: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to disable 2FA")
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	err = cfg.removeTwoFactor(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error disabling 2FA: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to disable 2FA")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Swaps in the new recovery codes and switches 2FA on in one go, so nobody
+// ends up with 2FA and no way back in. Returns false if it was already on
+func (cfg *ApiConfig) enableTwoFactor(ctx context.Context, userID uuid.UUID, counter int64, hashes []string) (bool, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	q := database.New(tx)
+
+	err = q.DeleteRecoveryCodes(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	err = q.AddRecoveryCodes(ctx, database.AddRecoveryCodesParams{
+		UserID:     userID,
+		CodeHashes: hashes,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	confirmed, err := q.ConfirmTOTP(ctx, database.ConfirmTOTPParams{
+		UserID:      userID,
+		LastCounter: counter,
+	})
+	if err != nil || confirmed == 0 {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Drops the secret and any recovery codes together, so there are never
+// codes left over for 2FA that's been switched off
+func (cfg *ApiConfig) removeTwoFactor(ctx context.Context, userID uuid.UUID) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	q := database.New(tx)
+
+	err = q.DeleteTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = q.DeleteRecoveryCodes(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Checks the 2FA code given when logging in, with its own lockout since
+// there are only a million possible codes. wait is how long to wait if
+// they're locked out
+func (cfg *ApiConfig) checkLoginCode(ctx context.Context, r *http.Request, userID uuid.UUID, code string) (bool, time.Duration, error) {
+	if wait := attemptLogin(ctx, cfg.lockouts.mfa, userID.String()); wait > 0 {
+		return false, wait, nil
+	}
+
+	ok, err := cfg.checkSecondFactor(ctx, userID, code)
+	if err != nil {
+		return false, 0, err
+	}
+	cfg.recordMFAResult(ctx, r, userID, ok)
+	return ok, 0, nil
+}
+
+// Second step of logging in with 2FA, swaps the challenge token and a code
+// for the usual access and refresh tokens
+func (cfg *ApiConfig) loginMFA(w http.ResponseWriter, r *http.Request) {
+	type mfaRequest struct {
+		MFAToken    string `json:"mfa_token"`
+		Code        string `json:"code"`
+		DeviceLabel string `json:"device_label"`
+	}
+
+	var params mfaRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	userID, err := cfg.jwtKeys.ValidateMFAToken(params.MFAToken)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	ok, wait, err := cfg.checkLoginCode(r.Context(), r, userID, params.Code)
+	if wait > 0 {
+		respondLockedOut(w, wait)
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking 2FA code: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to log in")
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	dbUser, err := cfg.DBQueries.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	cfg.completeLogin(w, r, dbUser, params.DeviceLabel)
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/audit"
+	"github.com/Tim-Restart/chirpy/internal/auth"
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// What a moderator has done to an account
+const (
+	userStateActive = "active"
+	// Can't log in or use their tokens until suspended_until
+	userStateSuspended = "suspended"
+	// Can use everything as normal, but nobody else sees their chirps
+	userStateShadowBanned = "shadow_banned"
+	// Like a suspension that doesn't run out
+	userStateDeactivated = "deactivated"
+)
+
+// A suspended or deactivated user tried to do something
+type accountStateError struct {
+	state string
+	until time.Time
+}
+
+func (e *accountStateError) Error() string {
+	if e.state == userStateSuspended {
+		return "account suspended until " + e.until.Format(time.RFC3339)
+	}
+	return "account deactivated"
+}
+
+// What the client is told, capitalised like the rest of our errors
+func (e *accountStateError) message() string {
+	msg := e.Error()
+	return strings.ToUpper(msg[:1]) + msg[1:]
+}
+
+// The state that applies right now, suspensions end on their own once
+// suspended_until has passed
+func currentUserState(status string, suspendedUntil sql.NullTime, now time.Time) string {
+	if status == userStateSuspended && suspendedUntil.Valid && !now.Before(suspendedUntil.Time) {
+		return userStateActive
+	}
+	return status
+}
+
+// nil if the user can carry on, an accountStateError if they're locked out
+func userStateError(status string, suspendedUntil sql.NullTime) error {
+	switch currentUserState(status, suspendedUntil, time.Now().UTC()) {
+	case userStateSuspended:
+		return &accountStateError{state: userStateSuspended, until: suspendedUntil.Time}
+	case userStateDeactivated:
+		return &accountStateError{state: userStateDeactivated}
+	}
+	return nil
+}
+
+// Checked on every authenticated request, so a suspension takes effect
+// straight away rather than when the user's access token runs out
+func (cfg *ApiConfig) checkUserState(ctx context.Context, userID uuid.UUID) error {
+	_, err := cfg.checkUserAccess(ctx, userID)
+	return err
+}
+
+// Same as checkUserState, also returning the user's role as it is now
+func (cfg *ApiConfig) checkUserAccess(ctx context.Context, userID uuid.UUID) (string, error) {
+	state, err := cfg.DBQueries.GetUserState(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return state.Role, userStateError(state.Status, state.SuspendedUntil)
+}
+
+// Whether chirps by someone in this state are hidden from everyone else
+func chirpsHiddenFor(status string) bool {
+	return status == userStateShadowBanned || status == userStateDeactivated
+}
+
+// Whether someone's new chirps should stay out of everyone else's way, a
+// failed lookup counts as not hidden rather than losing tags and notifications
+func (cfg *ApiConfig) authorHidden(ctx context.Context, userID uuid.UUID) bool {
+	state, err := cfg.DBQueries.GetUserState(ctx, userID)
+	if err != nil {
+		log.Printf("Error getting user state: %v", err)
+		return false
+	}
+	return chirpsHiddenFor(state.Status)
+}
+
+// Can the viewer see chirps by author, shadow banned users always see their own
+func (cfg *ApiConfig) canSeeChirpsBy(ctx context.Context, author uuid.UUID, viewer uuid.NullUUID) (bool, error) {
+	if viewer.Valid && viewer.UUID == author {
+		return true, nil
+	}
+
+	state, err := cfg.DBQueries.GetUserState(ctx, author)
+	if err != nil {
+		return false, err
+	}
+	return !chirpsHiddenFor(state.Status), nil
+}
+
+// Moderators can act on users, only admins can act on other moderators and admins
+func (cfg *ApiConfig) canModerateUser(ctx context.Context, moderatorRole string, userID uuid.UUID) (bool, error) {
+	if auth.RoleAtLeast(moderatorRole, auth.RoleAdmin) {
+		return true, nil
+	}
+
+	role, err := cfg.DBQueries.GetUserRole(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return role == auth.RoleUser, nil
+}
+
+// When a suspension of suspendFor (e.g. "72h") from now ends, in UTC like
+// every other time we store
+func suspensionEnd(suspendFor string) (sql.NullTime, error) {
+	d, err := time.ParseDuration(suspendFor)
+	if err != nil || d <= 0 {
+		return sql.NullTime{}, errors.New("suspend_for must be a positive duration like 72h")
+	}
+	return sql.NullTime{Time: time.Now().UTC().Add(d), Valid: true}, nil
+}
+
+// setUserState in its own transaction, for when it isn't part of something bigger
+func (cfg *ApiConfig) changeUserState(ctx context.Context, userID uuid.UUID, state string, suspendedUntil sql.NullTime) (bool, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	updated, err := setUserState(ctx, database.New(tx), userID, state, suspendedUntil)
+	if err != nil || !updated {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// Changes a user's state, suspending or deactivating them signs them out
+// everywhere too. Shadow bans leave them signed in so they don't notice
+// q should be a transaction so the state never changes without the sign out
+func setUserState(ctx context.Context, q *database.Queries, userID uuid.UUID, state string, suspendedUntil sql.NullTime) (bool, error) {
+	updated, err := q.SetUserState(ctx, database.SetUserStateParams{
+		ID:             userID,
+		Status:         state,
+		SuspendedUntil: suspendedUntil,
+	})
+	if err != nil || updated == 0 {
+		return false, err
+	}
+
+	if state == userStateSuspended || state == userStateDeactivated {
+		err = q.RevokeOtherSessions(ctx, database.RevokeOtherSessionsParams{
+			UserID: userID,
+		})
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// Sets a user's state, suspend_for (e.g. "72h") is needed when suspending
+func (cfg *ApiConfig) updateUserState(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	moderatorID, moderatorRole, err := cfg.staffUser(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized: Invalid or missing token")
+		return
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	var params struct {
+		State      string `json:"state"`
+		SuspendFor string `json:"suspend_for"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var suspendedUntil sql.NullTime
+	switch params.State {
+	case userStateActive, userStateShadowBanned, userStateDeactivated:
+	case userStateSuspended:
+		suspendedUntil, err = suspensionEnd(params.SuspendFor)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		respondWithError(w, http.StatusBadRequest, "State must be active, suspended, shadow_banned or deactivated")
+		return
+	}
+
+	allowed, err := cfg.canModerateUser(ctx, moderatorRole, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		log.Printf("Error getting user role: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to set state")
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "Only admins can change the state of moderators and admins")
+		return
+	}
+
+	// The state before, for the audit log
+	before, err := cfg.DBQueries.GetUserState(ctx, userID)
+	if err != nil {
+		log.Printf("Error getting user state: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to set state")
+		return
+	}
+
+	updated, err := cfg.changeUserState(ctx, userID, params.State, suspendedUntil)
+	if err != nil {
+		log.Printf("Error setting user state: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to set state")
+		return
+	}
+	if !updated {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	cfg.recordAudit(r, audit.Event{
+		Action:     auditStateChanged,
+		ActorID:    actor(moderatorID),
+		TargetType: "user",
+		TargetID:   userID.String(),
+		Metadata: map[string]any{
+			"before": auditUserState(before.Status, before.SuspendedUntil),
+			"after":  auditUserState(params.State, suspendedUntil),
+		},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func auditUserState(status string, suspendedUntil sql.NullTime) map[string]any {
+	state := map[string]any{"status": status}
+	if suspendedUntil.Valid {
+		state["suspended_until"] = suspendedUntil.Time.UTC()
+	}
+	return state
+}
+
+// Blanks out chirps by shadow banned and deactivated users unless the viewer
+// wrote them. The list queries leave them out already, this catches threads
+// and the originals embedded in rechirps and quotes
+func (cfg *ApiConfig) hideChirpsFromHiddenUsers(ctx context.Context, viewer uuid.NullUUID, chirps ...*Chirp) error {
+	var authors []uuid.UUID
+	for _, chirp := range chirps {
+		authors = append(authors, chirp.User_ID)
+		if chirp.Embedded != nil && chirp.Embedded.Chirp != nil {
+			authors = append(authors, chirp.Embedded.User_ID)
+		}
+	}
+	if len(authors) == 0 {
+		return nil
+	}
+
+	ids, err := cfg.DBQueries.ListHiddenUsers(ctx, authors)
+	if err != nil {
+		return err
+	}
+
+	hidden := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		if !viewer.Valid || id != viewer.UUID {
+			hidden[id] = true
+		}
+	}
+	if len(hidden) == 0 {
+		return nil
+	}
+
+	for _, chirp := range chirps {
+		if hidden[chirp.User_ID] {
+			chirp.Body = ""
+			chirp.User_ID = uuid.Nil
+			chirp.Hidden = true
+		}
+		if chirp.Embedded != nil && chirp.Embedded.Chirp != nil && hidden[chirp.Embedded.User_ID] {
+			chirp.Embedded = &embeddedChirp{Unavailable: true}
+		}
+	}
+	return nil
+}
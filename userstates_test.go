@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Tim-Restart/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowBannedChirpsAreNotTagged(t *testing.T) {
+	cfg := newTestConfig(t)
+	ctx := context.Background()
+	bob := createTestUser(t, cfg, "bob@example.com")
+	_, err := cfg.DBQueries.SetUserState(ctx, database.SetUserStateParams{ID: bob.ID, Status: userStateShadowBanned})
+	require.NoError(t, err)
+
+	rec := serveTest(cfg.newChirp, "POST", "/api/chirps", testToken(t, cfg, bob.ID), `{"body":"nobody will see this #secret"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var chirp Chirp
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &chirp))
+
+	// Bob still sees the chirp, but it never made it into the hashtag
+	chirps, err := cfg.DBQueries.ListHashtagChirps(ctx, database.ListHashtagChirpsParams{
+		Tag:      "secret",
+		ViewerID: uuid.NullUUID{UUID: bob.ID, Valid: true},
+		Limit:    10,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, chirps)
+	assert.Equal(t, chirp.ID, fetchTestChirp(t, cfg, testToken(t, cfg, bob.ID), chirp.ID.String()).ID)
+}
+
+func TestCurrentUserState(t *testing.T) {
+	now := time.Now()
+	later := sql.NullTime{Time: now.Add(time.Hour), Valid: true}
+	earlier := sql.NullTime{Time: now.Add(-time.Hour), Valid: true}
+
+	assert.Equal(t, userStateSuspended, currentUserState(userStateSuspended, later, now))
+	// Suspensions run out on their own
+	assert.Equal(t, userStateActive, currentUserState(userStateSuspended, earlier, now))
+	assert.Equal(t, userStateShadowBanned, currentUserState(userStateShadowBanned, sql.NullTime{}, now))
+
+	var stateErr *accountStateError
+	assert.ErrorAs(t, userStateError(userStateSuspended, later), &stateErr)
+	assert.ErrorAs(t, userStateError(userStateDeactivated, sql.NullTime{}), &stateErr)
+	assert.Equal(t, "Account deactivated", stateErr.message())
+	assert.NoError(t, userStateError(userStateShadowBanned, sql.NullTime{}))
+	assert.NoError(t, userStateError(userStateActive, sql.NullTime{}))
+}
+
+func TestShadowBannedChirpsLikesAndRevisions(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice := createTestUser(t, cfg, "alice@example.com")
+	bob := createTestUser(t, cfg, "bob@example.com")
+	chirpID := createTestChirp(t, cfg, bob.ID, "only bob sees this").ID.String()
+	_, err := cfg.DBQueries.SetUserState(context.Background(), database.SetUserStateParams{ID: bob.ID, Status: userStateShadowBanned})
+	require.NoError(t, err)
+
+	// Nobody else can tell the chirp is there
+	rec := serveTest(cfg.likeChirp, "PUT", "/api/chirps/"+chirpID+"/like", testToken(t, cfg, alice.ID), "", "chirpID", chirpID)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = serveTest(cfg.getChirpLikes, "GET", "/api/chirps/"+chirpID+"/likes", "", "", "chirpID", chirpID)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = serveTest(cfg.getChirpRevisions, "GET", "/api/chirps/"+chirpID+"/revisions", testToken(t, cfg, alice.ID), "", "chirpID", chirpID)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// But bob still can
+	rec = serveTest(cfg.getChirpLikes, "GET", "/api/chirps/"+chirpID+"/likes", testToken(t, cfg, bob.ID), "", "chirpID", chirpID)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}